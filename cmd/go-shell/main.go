@@ -6,30 +6,75 @@ import (
 
 	"github.com/at-ishikawa/go-shell/internal/shell"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 func main() {
 	var commandLineOptions shell.Options
+	var command string
+	exitCode := 0
 
 	rootCommand := &cobra.Command{
+		Use: "go-shell [script [args...]]",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			s, err := shell.NewShell(
-				os.Stdin,
-				os.Stdout,
-				os.Stderr,
-				commandLineOptions,
-			)
-			if err != nil {
+			isCommand := cmd.Flags().Changed("command")
+			if !isCommand && len(args) == 0 && term.IsTerminal(int(os.Stdin.Fd())) {
+				s, err := shell.NewShell(
+					os.Stdin,
+					os.Stdout,
+					os.Stderr,
+					commandLineOptions,
+				)
+				if err != nil {
+					return err
+				}
+				exitCode, err = s.Run()
 				return err
 			}
-			return s.Run()
+
+			var err error
+			exitCode, err = runScript(isCommand, command, args, commandLineOptions)
+			return err
 		},
 	}
 
 	rootCommand.PersistentFlags().BoolVarP(&commandLineOptions.IsDebug, "debug", "", false, "Enable to a debug mode")
+	rootCommand.PersistentFlags().BoolVarP(&commandLineOptions.IsPipefail, "pipefail", "", false, "Return the exit status of the last failed command in a pipeline")
+	rootCommand.Flags().StringVarP(&command, "command", "c", "", "Run commands in a string. Arguments after it are $0, $1, ...")
+	// Flags after a script are its arguments
+	rootCommand.Flags().SetInterspersed(false)
 	if err := rootCommand.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	os.Exit(0)
+	os.Exit(exitCode)
+}
+
+// runScript runs commands of -c, a script file, or a stdin which isn't a terminal
+func runScript(isCommand bool, command string, args []string, options shell.Options) (int, error) {
+	isScriptFile := !isCommand && len(args) > 0
+	name := os.Args[0]
+	if len(args) > 0 {
+		name = args[0]
+		args = args[1:]
+	}
+	s, err := shell.NewScript(os.Stdin, os.Stdout, os.Stderr, name, args, options)
+	if err != nil {
+		return 1, err
+	}
+	if isCommand {
+		return s.RunCommand(command), nil
+	}
+	if !isScriptFile {
+		return s.Run(os.Stdin), nil
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		// The same exit status as bash for a script which can't be opened
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+		return 127, nil
+	}
+	defer file.Close()
+	return s.Run(file), nil
 }
@@ -10,10 +10,14 @@ type Completion interface {
 type PreviewCommandType func(row int) (string, error)
 type LiveReloading func(row int, query string) ([]string, error)
 
+// Toggling returns a header and rows to switch to by Ctrl-R, while a query is kept
+type Toggling func() (string, []string, error)
+
 type CompleteOptions struct {
 	PreviewCommand PreviewCommandType
 	Header         string
 	InitialQuery   string
 	IsAnsiColor    bool
 	LiveReloading  LiveReloading
+	Toggling       Toggling
 }
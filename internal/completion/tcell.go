@@ -21,6 +21,7 @@ type finder struct {
 	query             string
 	previewCommand    PreviewCommandType
 	liveReloading     LiveReloading
+	toggling          Toggling
 	isMultiSelectMode bool
 }
 
@@ -47,6 +48,7 @@ func newFinder(rows []string, options CompleteOptions, isMultiSelectMode bool) f
 		query:             options.InitialQuery,
 		previewCommand:    options.PreviewCommand,
 		liveReloading:     options.LiveReloading,
+		toggling:          options.Toggling,
 		isMultiSelectMode: isMultiSelectMode,
 	}
 	f.setRows(rows)
@@ -370,6 +372,24 @@ func (complete TcellCompletion) handleKeyEvent(currentFinder finder, event *tcel
 			break
 		}
 
+	case tcell.KeyCtrlR:
+		if currentFinder.toggling == nil {
+			break
+		}
+		header, rows, err := currentFinder.toggling()
+		if err != nil {
+			return currentFinder, err, true
+		}
+		currentFinder.header = header
+		currentFinder.setRows(rows)
+		currentFinder.updateQuery(query)
+		if visibleRows := currentFinder.getVisibleRows(); currentFinder.cursorRow >= len(visibleRows) {
+			currentFinder.cursorRow = len(visibleRows) - 1
+		}
+		if currentFinder.cursorRow < 0 {
+			currentFinder.cursorRow = 0
+		}
+
 	case tcell.KeyCtrlC:
 		done = true
 
@@ -525,6 +525,69 @@ func TestComplete_handleKeyEvent(t *testing.T) {
 					},
 				},
 			},
+			{
+				name: "toggling switches rows with the same query",
+				args: args{
+					finder: finder{
+						header:    "all",
+						query:     "a",
+						cursorRow: 1,
+						allRows: []finderRow{
+							{visible: true, index: 0, value: "apple"},
+							{visible: true, index: 1, value: "banana"},
+						},
+						toggling: func() (string, []string, error) {
+							return "some", []string{"dog", "cat"}, nil
+						},
+					},
+					keyEvent: tcell.NewEventKey(tcell.KeyCtrlR, emptyRune, tcell.ModCtrl),
+				},
+				want: finder{
+					header: "some",
+					query:  "a",
+					allRows: []finderRow{
+						{visible: false, index: 0, value: "dog"},
+						{visible: true, index: 1, value: "cat"},
+					},
+				},
+			},
+			{
+				name: "toggling doesn't change anything without a function",
+				args: args{
+					finder: finder{
+						allRows: []finderRow{
+							{visible: true, index: 0, value: "apple"},
+						},
+					},
+					keyEvent: tcell.NewEventKey(tcell.KeyCtrlR, emptyRune, tcell.ModCtrl),
+				},
+				want: finder{
+					allRows: []finderRow{
+						{visible: true, index: 0, value: "apple"},
+					},
+				},
+			},
+			{
+				name: "toggling causes an error",
+				args: args{
+					finder: finder{
+						allRows: []finderRow{
+							{visible: true, index: 0, value: "apple"},
+						},
+						toggling: func() (string, []string, error) {
+							return "", nil, errors.New("error")
+						},
+					},
+					keyEvent: tcell.NewEventKey(tcell.KeyCtrlR, emptyRune, tcell.ModCtrl),
+				},
+				want: finder{
+					allRows: []finderRow{
+						{visible: true, index: 0, value: "apple"},
+					},
+				},
+				wantErr:  errors.New("error"),
+				wantDone: true,
+			},
 			{
 				name: "live reloading causes an error",
 				args: args{
@@ -558,6 +621,8 @@ func TestComplete_handleKeyEvent(t *testing.T) {
 				// Set nil because functions cannot be compared: https://github.com/stretchr/testify/issues/182
 				got.liveReloading = nil
 				tc.want.liveReloading = nil
+				got.toggling = nil
+				tc.want.toggling = nil
 
 				assert.Equal(t, tc.want, got)
 				assert.Equal(t, tc.wantErr, gotErr)
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"io/fs"
 	"os"
+
+	"golang.org/x/sys/unix"
 )
 
 type Config struct {
@@ -27,17 +31,106 @@ func (c Config) GetPath() string {
 	return c.dir
 }
 
+func (c Config) filePath(filename string) string {
+	return c.dir + "/" + filename
+}
+
 func (c Config) readFile(filename string) ([]byte, error) {
-	filePath := c.dir + "/" + filename
+	filePath := c.filePath(filename)
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return []byte{}, nil
 	}
 	return os.ReadFile(filePath)
 }
 
-func (c Config) writeFile(filename string, data []byte) error {
-	filePath := c.dir + "/" + filename
-	return os.WriteFile(filePath, data, c.filePermission)
+// updateFile replaces a file with data which update returns from the current data, while holding its lock.
+// Changes of other processes are not lost because they are read by update
+func (c Config) updateFile(filename string, update func(data []byte) ([]byte, error)) error {
+	return c.withLock(filename, func() error {
+		data, err := c.readFile(filename)
+		if err != nil {
+			return err
+		}
+		data, err = update(data)
+		if err != nil {
+			return err
+		}
+		return c.replaceFile(filename, data)
+	})
+}
+
+// replaceFile writes data into a temporary file and renames it,
+// so that other processes never read a partially written file
+func (c Config) replaceFile(filename string, data []byte) error {
+	file, err := os.CreateTemp(c.dir, filename+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Chmod(c.filePermission); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), c.filePath(filename))
+}
+
+// withLock runs f while holding an exclusive lock of a file among processes.
+// The lock is taken on another file because the file itself is replaced by a rename.
+// f must not take the same lock, which blocks forever
+func (c Config) withLock(filename string, f func() error) error {
+	lockFile, err := os.OpenFile(c.filePath(filename+".lock"), os.O_RDWR|os.O_CREATE, c.filePermission)
+	if err != nil {
+		return err
+	}
+	defer lockFile.Close()
+	for {
+		err = unix.Flock(int(lockFile.Fd()), unix.LOCK_EX)
+		if !errors.Is(err, unix.EINTR) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", filename, err)
+	}
+	defer unix.Flock(int(lockFile.Fd()), unix.LOCK_UN)
+	return f()
+}
+
+// appendFile writes data at the end of a file by a single write,
+// so that data appended by other processes at the same time are not mixed
+func (c Config) appendFile(filename string, data []byte) error {
+	file, err := os.OpenFile(c.filePath(filename), os.O_WRONLY|os.O_APPEND|os.O_CREATE, c.filePermission)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (c Config) removeFile(filename string) error {
+	err := os.Remove(c.filePath(filename))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (c Config) renameFile(oldFilename string, newFilename string) error {
+	return os.Rename(c.filePath(oldFilename), c.filePath(newFilename))
 }
 
 func (c Config) makeDir() error {
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type DirectoryItem struct {
+	Path          string    `json:"path"`
+	Count         int       `json:"count"`
+	LastVisitedAt time.Time `json:"last_visited_at"`
+}
+
+// DirectoryHistory is directories which a shell visited, which are ranked by frecency
+type DirectoryHistory struct {
+	list     []DirectoryItem
+	config   *Config
+	fileName string
+	maxSize  int
+}
+
+func NewDirectoryHistory(c *Config) DirectoryHistory {
+	return DirectoryHistory{
+		config:   c,
+		fileName: "directories.json",
+		maxSize:  1000,
+	}
+}
+
+func (h *DirectoryHistory) Get() []DirectoryItem {
+	return h.list
+}
+
+func (h *DirectoryHistory) LoadFile() error {
+	fileData, err := h.config.readFile(h.fileName)
+	if err != nil {
+		return fmt.Errorf("LoadFile error: %w", err)
+	}
+	if len(fileData) == 0 {
+		return nil
+	}
+	return json.Unmarshal(fileData, &h.list)
+}
+
+// Visit records a directory into the file with directories which other shells visited
+func (h *DirectoryHistory) Visit(path string, currentTime time.Time) error {
+	return h.config.updateFile(h.fileName, func(data []byte) ([]byte, error) {
+		h.list = nil
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &h.list); err != nil {
+				return nil, err
+			}
+		}
+		h.Add(path, currentTime)
+		if len(h.list) > h.maxSize {
+			h.list = h.list[len(h.list)-h.maxSize:]
+		}
+		return json.Marshal(h.list)
+	})
+}
+
+// Add counts a visit of a directory. The most recently visited directory is the last one
+func (h *DirectoryHistory) Add(path string, currentTime time.Time) {
+	count := 1
+	result := make([]DirectoryItem, 0, len(h.list)+1)
+	for _, item := range h.list {
+		if item.Path == path {
+			count = item.Count + 1
+			continue
+		}
+		result = append(result, item)
+	}
+	h.list = append(result, DirectoryItem{
+		Path:          path,
+		Count:         count,
+		LastVisitedAt: currentTime,
+	})
+}
+
+// Rank returns directories which contain all fragments in order, from the highest frecency.
+// Fragments are matched case-insensitively
+func (h DirectoryHistory) Rank(fragments []string, currentTime time.Time) []string {
+	var items []DirectoryItem
+	for _, item := range h.list {
+		if matchFragments(item.Path, fragments) {
+			items = append(items, item)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		iFrecency := frecency(items[i], currentTime)
+		jFrecency := frecency(items[j], currentTime)
+		if iFrecency != jFrecency {
+			return iFrecency > jFrecency
+		}
+		return items[i].LastVisitedAt.After(items[j].LastVisitedAt)
+	})
+
+	paths := make([]string, 0, len(items))
+	for _, item := range items {
+		paths = append(paths, item.Path)
+	}
+	return paths
+}
+
+func matchFragments(path string, fragments []string) bool {
+	path = strings.ToLower(path)
+	for _, fragment := range fragments {
+		fragment = strings.ToLower(fragment)
+		index := strings.Index(path, fragment)
+		if index < 0 {
+			return false
+		}
+		path = path[index+len(fragment):]
+	}
+	return true
+}
+
+// frecency is a visit count weighted by how recently a directory was visited
+func frecency(item DirectoryItem, currentTime time.Time) float64 {
+	age := currentTime.Sub(item.LastVisitedAt)
+	count := float64(item.Count)
+	switch {
+	case age < time.Hour:
+		return count * 4
+	case age < 24*time.Hour:
+		return count * 2
+	case age < 7*24*time.Hour:
+		return count / 2
+	}
+	return count / 4
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectoryHistory_Add(t *testing.T) {
+	visitedAt := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name    string
+		history DirectoryHistory
+		path    string
+
+		want []DirectoryItem
+	}{
+		{
+			name: "the first visit",
+			path: "/home/user",
+			want: []DirectoryItem{
+				{Path: "/home/user", Count: 1, LastVisitedAt: visitedAt},
+			},
+		},
+		{
+			name: "a directory visited before is moved to the last",
+			history: DirectoryHistory{
+				list: []DirectoryItem{
+					{Path: "/home/user", Count: 2, LastVisitedAt: visitedAt.Add(-time.Hour)},
+					{Path: "/tmp", Count: 1, LastVisitedAt: visitedAt.Add(-time.Minute)},
+				},
+			},
+			path: "/home/user",
+			want: []DirectoryItem{
+				{Path: "/tmp", Count: 1, LastVisitedAt: visitedAt.Add(-time.Minute)},
+				{Path: "/home/user", Count: 3, LastVisitedAt: visitedAt},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.history.Add(tc.path, visitedAt)
+			assert.Equal(t, tc.want, tc.history.list)
+		})
+	}
+}
+
+func TestDirectoryHistory_Rank(t *testing.T) {
+	now := time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC)
+	history := DirectoryHistory{
+		list: []DirectoryItem{
+			{Path: "/home/user/src/go-shell", Count: 10, LastVisitedAt: now.Add(-30 * 24 * time.Hour)},
+			{Path: "/home/user/src/go-shell/internal", Count: 2, LastVisitedAt: now.Add(-time.Minute)},
+			{Path: "/home/user/Documents", Count: 3, LastVisitedAt: now.Add(-2 * time.Hour)},
+			{Path: "/tmp", Count: 1, LastVisitedAt: now.Add(-time.Minute)},
+		},
+	}
+
+	testCases := []struct {
+		name      string
+		fragments []string
+
+		want []string
+	}{
+		{
+			name: "all directories by frecency",
+			want: []string{
+				"/home/user/src/go-shell/internal",
+				"/home/user/Documents",
+				"/tmp",
+				"/home/user/src/go-shell",
+			},
+		},
+		{
+			name:      "fragments in order",
+			fragments: []string{"src", "shell"},
+			want: []string{
+				"/home/user/src/go-shell/internal",
+				"/home/user/src/go-shell",
+			},
+		},
+		{
+			name:      "fragments are case-insensitive",
+			fragments: []string{"docu"},
+			want:      []string{"/home/user/Documents"},
+		},
+		{
+			name:      "fragments in a different order",
+			fragments: []string{"shell", "src"},
+			want:      []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := history.Rank(tc.fragments, now)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDirectoryHistory_Visit(t *testing.T) {
+	tmpConfig, err := NewConfig(t.TempDir())
+	require.NoError(t, err)
+	visitedAt := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	history := NewDirectoryHistory(tmpConfig)
+	require.NoError(t, history.Visit("/tmp", visitedAt))
+	// Another shell visits a directory
+	other := NewDirectoryHistory(tmpConfig)
+	require.NoError(t, other.Visit("/home/user", visitedAt.Add(time.Second)))
+	require.NoError(t, history.Visit("/tmp", visitedAt.Add(2*time.Second)))
+
+	got := NewDirectoryHistory(tmpConfig)
+	require.NoError(t, got.LoadFile())
+	assert.Equal(t, []DirectoryItem{
+		{Path: "/home/user", Count: 1, LastVisitedAt: visitedAt.Add(time.Second)},
+		{Path: "/tmp", Count: 2, LastVisitedAt: visitedAt.Add(2 * time.Second)},
+	}, got.Get())
+	_, err = os.Stat(tmpConfig.GetPath() + "/directories.json")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Execution is a record of a command run once, unlike HistoryItem which aggregates runs of the same command
+type Execution struct {
+	Command string `json:"command"`
+	// Dir is the working directory where the command started
+	Dir        string         `json:"dir,omitempty"`
+	StartedAt  time.Time      `json:"started_at"`
+	Time       *ExecutionTime `json:"time,omitempty"`
+	ExitStatus int            `json:"exit_status"`
+	// SessionID is different for each shell process
+	SessionID string            `json:"session_id,omitempty"`
+	Hostname  string            `json:"hostname,omitempty"`
+	Context   map[string]string `json:"context,omitempty"`
+}
+
+// ExecutionLog is an append-only file of executions with a JSON record per line.
+// Older executions are dropped when the file gets larger than maxFileSize
+type ExecutionLog struct {
+	config      *Config
+	fileName    string
+	maxFileSize int64
+}
+
+func NewExecutionLog(c *Config) ExecutionLog {
+	return ExecutionLog{
+		config:      c,
+		fileName:    "executions.jsonl",
+		maxFileSize: 50 * 1024 * 1024,
+	}
+}
+
+// Append adds executions at the end of the log
+func (l ExecutionLog) Append(executions ...Execution) error {
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	for _, execution := range executions {
+		if err := encoder.Encode(execution); err != nil {
+			return err
+		}
+	}
+	return l.config.withLock(l.fileName, func() error {
+		if err := l.trim(int64(data.Len())); err != nil {
+			return err
+		}
+		return l.config.appendFile(l.fileName, data.Bytes())
+	})
+}
+
+// trim drops the older half of the log if appending size bytes makes it larger than maxFileSize
+func (l ExecutionLog) trim(size int64) error {
+	fileInfo, err := os.Stat(l.config.filePath(l.fileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fileInfo.Size()+size <= l.maxFileSize {
+		return nil
+	}
+	data, err := l.config.readFile(l.fileName)
+	if err != nil {
+		return err
+	}
+	data = data[len(data)/2:]
+	data = data[bytes.IndexByte(data, '\n')+1:]
+	return l.config.replaceFile(l.fileName, data)
+}
+
+// Load reads all executions from the oldest one
+func (l ExecutionLog) Load() ([]Execution, error) {
+	data, err := l.config.readFile(l.fileName)
+	if err != nil {
+		return nil, err
+	}
+	var executions []Execution
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		var execution Execution
+		// A broken line doesn't stop reading the rest of the log
+		if err := json.Unmarshal(line, &execution); err != nil {
+			continue
+		}
+		executions = append(executions, execution)
+	}
+	return executions, nil
+}
+
+// Find returns executions started in dir or its subdirectories at or after since, from the oldest one.
+// An empty dir matches all directories, and a zero since matches all times
+func (l ExecutionLog) Find(dir string, since time.Time) ([]Execution, error) {
+	executions, err := l.Load()
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Clean(dir)
+	var result []Execution
+	for _, execution := range executions {
+		if execution.StartedAt.Before(since) {
+			continue
+		}
+		if dir != "." && !isInDir(execution.Dir, dir) {
+			continue
+		}
+		result = append(result, execution)
+	}
+	return result, nil
+}
+
+func isInDir(path string, dir string) bool {
+	if path == dir || dir == "/" {
+		return true
+	}
+	return strings.HasPrefix(path, dir+"/")
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecutionLog_Find(t *testing.T) {
+	now := time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC)
+	executions := []Execution{
+		{Command: "make", Dir: "/home/user/repo", StartedAt: now.Add(-10 * 24 * time.Hour)},
+		{Command: "go test ./...", Dir: "/home/user/repo/internal", StartedAt: now.Add(-time.Hour), ExitStatus: 1},
+		{Command: "ls", Dir: "/home/user/repository", StartedAt: now.Add(-time.Hour)},
+		{Command: "pwd", Dir: "/home/user", StartedAt: now},
+	}
+
+	testCases := []struct {
+		name  string
+		dir   string
+		since time.Time
+		want  []Execution
+	}{
+		{
+			name: "all executions",
+			want: executions,
+		},
+		{
+			name: "a directory and its subdirectories",
+			dir:  "/home/user/repo/",
+			want: executions[:2],
+		},
+		{
+			name:  "since a time",
+			dir:   "/home/user/repo",
+			since: now.Add(-7 * 24 * time.Hour),
+			want:  executions[1:2],
+		},
+		{
+			name: "the root directory",
+			dir:  "/",
+			want: executions,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewConfig(t.TempDir())
+			require.NoError(t, err)
+			executionLog := NewExecutionLog(c)
+			require.NoError(t, executionLog.Append(executions[:1]...))
+			require.NoError(t, executionLog.Append(executions[1:]...))
+
+			got, err := executionLog.Find(tc.dir, tc.since)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestExecutionLog_Append(t *testing.T) {
+	c, err := NewConfig(t.TempDir())
+	require.NoError(t, err)
+	executionLog := NewExecutionLog(c)
+	executionLog.maxFileSize = 500
+
+	var want []string
+	for i := 0; i < 20; i++ {
+		execution := Execution{Command: string(rune('a' + i)), StartedAt: time.Date(2023, 1, 1, 0, 0, i, 0, time.UTC)}
+		require.NoError(t, executionLog.Append(execution))
+		want = append(want, execution.Command)
+	}
+	// A broken line is skipped
+	require.NoError(t, c.appendFile(executionLog.fileName, []byte("{\n")))
+
+	got, err := executionLog.Load()
+	require.NoError(t, err)
+	gotCommands := make([]string, 0, len(got))
+	for _, execution := range got {
+		gotCommands = append(gotCommands, execution.Command)
+	}
+	// Older executions are dropped to keep the log small
+	assert.Less(t, len(gotCommands), len(want))
+	assert.Equal(t, want[len(want)-len(gotCommands):], gotCommands)
+}
@@ -1,107 +1,432 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"reflect"
+	"os"
+	"sort"
 	"strings"
 	"time"
 
 	"go.uber.org/zap"
 )
 
+// HistoryItem aggregates executions of the same command in the same context.
+// Each execution is recorded in ExecutionLog
 type HistoryItem struct {
-	Command string `json:"command"`
-	// @deprecated
-	Status int `json:"status,omitempty"`
+	Command         string    `json:"command"`
+	LastSucceededAt time.Time `json:"last_succeeded_at"`
+	LastFailedAt    time.Time `json:"last_failed_at,omitempty"`
+	// LastExitStatus is the exit status of the last execution
+	LastExitStatus int               `json:"last_exit_status,omitempty"`
+	Count          int               `json:"count"`
+	Context        map[string]string `json:"context,omitempty"`
+	// ExecutionTime is how long the command took last time
+	ExecutionTime *ExecutionTime `json:"execution_time,omitempty"`
+	// Dirs are recent working directories where the command was run, from the oldest one
+	Dirs []string `json:"dirs,omitempty"`
+}
 
-	// @deprecated
-	RunAt time.Time `json:"run_at,omitempty"`
+// legacyHistoryItem has fields which older versions wrote instead of the fields of the last execution
+type legacyHistoryItem struct {
+	HistoryItem
+	Status int       `json:"status,omitempty"`
+	RunAt  time.Time `json:"run_at,omitempty"`
+}
 
-	LastSucceededAt time.Time         `json:"last_succeeded_at"`
-	LastFailedAt    time.Time         `json:"last_failed_at,omitempty"`
-	Count           int               `json:"count"`
-	Context         map[string]string `json:"context,omitempty"`
+// migrate moves the status and the time of the last execution into the current fields.
+// It returns the execution if the item has its time
+func (item legacyHistoryItem) migrate() (HistoryItem, *Execution) {
+	result := item.HistoryItem
+	if item.Status != 0 && result.LastExitStatus == 0 {
+		result.LastExitStatus = item.Status
+	}
+	if item.RunAt.IsZero() {
+		return result, nil
+	}
+	if item.Status == 0 && result.LastSucceededAt.IsZero() {
+		result.LastSucceededAt = item.RunAt
+	}
+	if item.Status != 0 && result.LastFailedAt.IsZero() {
+		result.LastFailedAt = item.RunAt
+	}
+	if result.Count == 0 {
+		result.Count = 1
+	}
+	return result, &Execution{
+		Command:    item.Command,
+		StartedAt:  item.RunAt,
+		ExitStatus: item.Status,
+		Context:    item.Context,
+	}
 }
 
+// ExecutionTime is the elapsed real time and the CPU time of a command
+type ExecutionTime struct {
+	Real   time.Duration `json:"real"`
+	User   time.Duration `json:"user"`
+	System time.Duration `json:"system"`
+}
+
+// minRecordsToCompact avoids rewriting a small history file frequently
+const minRecordsToCompact = 1000
+
 type History struct {
-	list        []HistoryItem
-	index       int
-	config      *Config
-	fileName    string
-	maxSize     int
-	currentTime time.Time
+	// list is items from the oldest one. An item replaced by a later one with the same command and context,
+	// or dropped over maxSize, stays in list until it's compacted, so adding an item doesn't move other items
+	list []HistoryItem
+	// indexes are positions of the current items in list by historyItemKey. It's nil until items are added after list is set
+	indexes map[string]int
+	// first is a position in list which has no current items before it
+	first int
+	// items caches the current items for Get, which is nil after list changes
+	items   []HistoryItem
+	config  *Config
+	storage HistoryStorage
+	// executionLog is nil if executions are not recorded
+	executionLog *ExecutionLog
+	sessionID    string
+	hostname     string
+	// legacyFileName is a JSON array of items, which is migrated into the storage
+	legacyFileName string
+	maxSize        int
+	currentTime    time.Time
+	// recordCount is the number of records read from the storage since it was compacted
+	recordCount int
+
+	// navigation is commands for Previous and Next, which don't change while a user navigates them
+	// even if commands of other shells are merged. It's nil until navigation starts
+	navigation []string
+	// index is the position in navigation, where len(navigation) is the input line
+	index int
+	// isLocalOrder shows commands of the current shell before ones of other shells in Previous and StartWith
+	isLocalOrder bool
+	// sessionKeys are commands and contexts run in the current shell
+	sessionKeys map[string]bool
+	// location ranks commands run in the current directory or repository first in StartWith
+	location HistoryLocation
+	// ranked caches items ranked for StartWith, which is nil after items change
+	ranked    []HistoryItem
+	rankedKey rankedHistoryKey
+}
+
+// rankedHistoryKey is what ranked items depend on other than items themselves
+type rankedHistoryKey struct {
+	location     HistoryLocation
+	scope        HistoryScope
+	isLocalOrder bool
 }
 
 func NewHistory(c *Config) History {
+	executionLog := NewExecutionLog(c)
+	hostname, _ := os.Hostname()
 	return History{
-		config:   c,
-		fileName: "history.json",
-		maxSize:  1000,
+		config:         c,
+		storage:        newJSONLinesHistoryStorage(c, "history.jsonl"),
+		executionLog:   &executionLog,
+		sessionID:      newSessionID(),
+		hostname:       hostname,
+		legacyFileName: "history.json",
+		maxSize:        100000,
 	}
 }
 
+// newSessionID returns a random ID to tell executions of a shell from ones of other shells
+func newSessionID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
+
+// SessionID is the ID of the current shell in executions
+func (h *History) SessionID() string {
+	return h.sessionID
+}
+
+// FindExecutions returns executions in dir or its subdirectories since a time, from the oldest one
+func (h *History) FindExecutions(dir string, since time.Time) ([]Execution, error) {
+	if h.executionLog == nil {
+		return nil, nil
+	}
+	return h.executionLog.Find(dir, since)
+}
+
+// Get returns the current items from the oldest one
 func (h *History) Get() []HistoryItem {
-	return h.list
+	if h.items == nil {
+		h.indexItems()
+		for i := h.first; i < len(h.list); i++ {
+			if h.isCurrent(i) {
+				h.items = append(h.items, h.list[i])
+			}
+		}
+	}
+	return h.items
+}
+
+// size returns the number of the current items
+func (h *History) size() int {
+	h.indexItems()
+	return len(h.indexes)
+}
+
+// indexItems makes indexes if list was set without them
+func (h *History) indexItems() {
+	if h.indexes == nil {
+		h.indexes = indexHistoryItems(h.list)
+	}
+}
+
+// isCurrent returns true if an item in list isn't replaced by a later one or dropped
+func (h *History) isCurrent(i int) bool {
+	item := h.list[i]
+	j, ok := h.indexes[historyItemKey(item.Command, item.Context)]
+	return ok && i == j
+}
+
+// put appends an item to list, which replaces an item with the same command and context
+func (h *History) put(item HistoryItem) {
+	h.indexItems()
+	h.list = append(h.list, item)
+	h.indexes[historyItemKey(item.Command, item.Context)] = len(h.list) - 1
+	h.items = nil
+	h.ranked = nil
+}
+
+// dropOldItems keeps the latest maxSize items
+func (h *History) dropOldItems() {
+	for h.size() > h.maxSize {
+		if h.isCurrent(h.first) {
+			item := h.list[h.first]
+			delete(h.indexes, historyItemKey(item.Command, item.Context))
+			h.items = nil
+			h.ranked = nil
+		}
+		h.first++
+	}
+}
+
+// compactList removes replaced and dropped items from list once they're more than the current items
+func (h *History) compactList() {
+	if len(h.list)-h.size() <= h.size() {
+		return
+	}
+	items := h.Get()
+	h.list = items[:len(items):len(items)]
+	h.indexes = indexHistoryItems(h.list)
+	h.first = 0
 }
 
 func (h *History) LoadFile() error {
-	fileData, err := h.config.readFile(h.fileName)
+	records, err := h.storage.Load()
 	if err != nil {
 		return fmt.Errorf("LoadFile error: %w", err)
 	}
-	if len(fileData) == 0 {
-		return nil
+	if len(records) == 0 {
+		err = h.storage.Lock(func() error {
+			// Another shell may have migrated it
+			records, err = h.storage.Load()
+			if err != nil || len(records) > 0 {
+				return err
+			}
+			records, err = h.migrateLegacyFile()
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", h.legacyFileName, err)
+		}
 	}
 
-	if err := json.Unmarshal(fileData, &h.list); err != nil {
-		return err
+	h.list = nil
+	h.indexes = nil
+	h.first = 0
+	h.items = nil
+	h.ranked = nil
+	h.recordCount = 0
+	h.merge(records)
+	return nil
+}
+
+// migrateLegacyFile moves items of the JSON array file into the storage, and keeps the file as a backup with .bak.
+// The deprecated status and run_at fields are migrated into the last execution of each item and the execution log
+func (h *History) migrateLegacyFile() ([]HistoryItem, error) {
+	fileData, err := h.config.readFile(h.legacyFileName)
+	if err != nil || len(fileData) == 0 {
+		return nil, err
+	}
+	var legacyItems []legacyHistoryItem
+	if err := json.Unmarshal(fileData, &legacyItems); err != nil {
+		return nil, err
+	}
+	items := make([]HistoryItem, 0, len(legacyItems))
+	var executions []Execution
+	for _, legacyItem := range legacyItems {
+		item, execution := legacyItem.migrate()
+		items = append(items, item)
+		if execution != nil {
+			executions = append(executions, *execution)
+		}
+	}
+	items = mergeHistoryItems(nil, items)
+	if h.executionLog != nil && len(executions) > 0 {
+		if err := h.executionLog.Append(executions...); err != nil {
+			return nil, err
+		}
 	}
+	if err := h.storage.Compact(items); err != nil {
+		return nil, err
+	}
+	return items, h.config.renameFile(h.legacyFileName, h.legacyFileName+".bak")
+}
 
-	h.index = len(h.list)
-	return nil
+// merge adds records read from the storage, and keeps the latest maxSize items
+func (h *History) merge(records []HistoryItem) {
+	h.recordCount += len(records)
+	for _, record := range records {
+		h.put(record)
+	}
+	h.dropOldItems()
+	h.compactList()
+	if h.navigation == nil {
+		h.index = h.size()
+	}
 }
 
-func (h History) saveFile() error {
-	if len(h.list) > h.maxSize {
-		firstIndex := len(h.list) - h.maxSize
-		h.list = h.list[firstIndex:]
+// Refresh merges commands which other shells stored since the last time.
+// Navigation by Previous and Next continues with the same commands
+func (h *History) Refresh() error {
+	if h.storage == nil {
+		return nil
 	}
-	marshaledJson, err := json.Marshal(h.list)
+	records, err := h.storage.LoadNew()
 	if err != nil {
 		return err
 	}
-	return h.config.writeFile(h.fileName, marshaledJson)
+	h.merge(records)
+	return nil
 }
 
-func (h History) StartWith(inputCommand string, status int) string {
-	for i := len(h.list) - 1; i >= 0; i-- {
-		item := h.list[i]
-		if strings.HasPrefix(item.Command, inputCommand) && item.Status == status {
-			return item.Command
+// SetLocalOrder changes whether commands of the current shell are shown before ones of other shells
+func (h *History) SetLocalOrder(isLocalOrder bool) {
+	h.isLocalOrder = isLocalOrder
+}
+
+// SetLocation changes the current directory and repository to rank commands
+func (h *History) SetLocation(location HistoryLocation) {
+	h.location = location
+}
+
+func (h *History) Location() HistoryLocation {
+	return h.location
+}
+
+// orderedItems returns items from the oldest one.
+// With the local order, items of the current shell are after ones of other shells
+func (h *History) orderedItems() []HistoryItem {
+	if !h.isLocalOrder || len(h.sessionKeys) == 0 {
+		return h.Get()
+	}
+	items := make([]HistoryItem, 0, h.size())
+	var sessionItems []HistoryItem
+	for _, item := range h.Get() {
+		if h.sessionKeys[historyItemKey(item.Command, item.Context)] {
+			sessionItems = append(sessionItems, item)
+			continue
+		}
+		items = append(items, item)
+	}
+	return append(items, sessionItems...)
+}
+
+// ResetNavigation makes Previous start from the latest command again
+func (h *History) ResetNavigation() {
+	h.navigation = nil
+	h.index = h.size()
+}
+
+// compact rewrites the storage if it has many records replaced by later ones
+func (h *History) compact() error {
+	if h.recordCount <= minRecordsToCompact || h.recordCount <= 2*h.size() {
+		return nil
+	}
+	if err := h.storage.Compact(h.Get()); err != nil {
+		return err
+	}
+	h.recordCount = h.size()
+	return nil
+}
+
+// mergeHistoryItems appends records to a list, where a record replaces an item with the same command and context
+func mergeHistoryItems(list []HistoryItem, records []HistoryItem) []HistoryItem {
+	items := append(list[:len(list):len(list)], records...)
+	lastIndexes := make(map[string]int, len(items))
+	for i, item := range items {
+		lastIndexes[historyItemKey(item.Command, item.Context)] = i
+	}
+	result := make([]HistoryItem, 0, len(lastIndexes))
+	for i, item := range items {
+		if lastIndexes[historyItemKey(item.Command, item.Context)] == i {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func historyItemKey(command string, context map[string]string) string {
+	names := make([]string, 0, len(context))
+	for name := range context {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	key.WriteString(command)
+	for _, name := range names {
+		key.WriteString("\x00" + name + "=" + context[name])
+	}
+	return key.String()
+}
+
+// rankedItems returns items ranked by the location in a scope.
+// They're cached until items, the location or the order change
+func (h *History) rankedItems(scope HistoryScope) []HistoryItem {
+	key := rankedHistoryKey{
+		location:     h.location,
+		scope:        scope,
+		isLocalOrder: h.isLocalOrder,
+	}
+	if h.ranked == nil || h.rankedKey != key {
+		h.ranked = h.location.Rank(h.orderedItems(), scope)
+		h.rankedKey = key
+	}
+	return h.ranked
+}
+
+// StartWith returns the latest command which starts with an input even if it failed last time,
+// preferring commands run in the current directory, and then ones in the current repository
+func (h *History) StartWith(inputCommand string) string {
+	items := h.rankedItems(HistoryScopeGlobal)
+	for i := len(items) - 1; i >= 0; i-- {
+		if strings.HasPrefix(items[i].Command, inputCommand) {
+			return items[i].Command
 		}
 	}
 	return ""
 }
 
-func (h *History) Sync(
-	command string,
-	status int,
-	currentContext map[string]string,
-	logger *zap.Logger,
-) chan struct{} {
+// Sync adds an execution to the history and stores it with other shells' commands merged.
+// The working directory, the session and the host are recorded in the execution log
+func (h *History) Sync(execution Execution, logger *zap.Logger) chan struct{} {
 	ch := make(chan struct{})
 	go func() {
 		defer func() {
 			ch <- struct{}{}
 		}()
 
-		if err := h.LoadFile(); err != nil {
-			logger.Error("Failed to load a history file",
-				zap.Error(err),
-			)
-			return
-		}
 		var currentTime time.Time
 		if !h.currentTime.Equal(time.Time{}) {
 			currentTime = h.currentTime
@@ -109,33 +434,65 @@ func (h *History) Sync(
 			currentTime = time.Now()
 		}
 
-		h.Add(command, status, currentContext, currentTime)
-		if err := h.saveFile(); err != nil {
-			logger.Error("Failed to save a history file",
-				zap.Error(err),
-			)
+		err := h.storage.Lock(func() error {
+			// Commands of other shells are merged before counting the command
+			records, err := h.storage.LoadNew()
+			if err != nil {
+				return fmt.Errorf("failed to load a history file: %w", err)
+			}
+			h.merge(records)
+
+			item := h.add(execution.Command, execution.ExitStatus, execution.Context, execution.Time, execution.Dir, currentTime)
+			if err := h.storage.Append(item); err != nil {
+				return fmt.Errorf("failed to save a history file: %w", err)
+			}
+			if err := h.compact(); err != nil {
+				return fmt.Errorf("failed to compact a history file: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			logger.Error("Failed to sync a history", zap.Error(err))
+		}
+
+		if h.executionLog == nil {
 			return
 		}
+		if execution.StartedAt.IsZero() {
+			execution.StartedAt = currentTime
+			if execution.Time != nil {
+				execution.StartedAt = currentTime.Add(-execution.Time.Real)
+			}
+		}
+		execution.SessionID = h.sessionID
+		execution.Hostname = h.hostname
+		if err := h.executionLog.Append(execution); err != nil {
+			logger.Error("Failed to record an execution", zap.Error(err))
+		}
 	}()
 
 	return ch
 }
 
 func (h *History) Add(command string, status int, currentContext map[string]string, currentTime time.Time) {
+	h.add(command, status, currentContext, nil, "", currentTime)
+}
+
+// add counts an execution of a command, and moves its item to the end
+func (h *History) add(command string, status int, currentContext map[string]string, executionTime *ExecutionTime, dir string, currentTime time.Time) HistoryItem {
 	var lastSucceededAt time.Time
 	var lastFailedAt time.Time
+	var dirs []string
 	count := 1
 
-	result := make([]HistoryItem, 0, len(h.list))
-	for _, item := range h.list {
-		if command == item.Command && reflect.DeepEqual(item.Context, currentContext) {
-			// remove this element
-			lastSucceededAt = item.LastSucceededAt
-			lastFailedAt = item.LastFailedAt
-			count = item.Count + 1
-			continue
-		}
-		result = append(result, item)
+	h.indexItems()
+	key := historyItemKey(command, currentContext)
+	if i, ok := h.indexes[key]; ok {
+		item := h.list[i]
+		lastSucceededAt = item.LastSucceededAt
+		lastFailedAt = item.LastFailedAt
+		dirs = item.Dirs
+		count = item.Count + 1
 	}
 
 	if status == 0 {
@@ -144,29 +501,62 @@ func (h *History) Add(command string, status int, currentContext map[string]stri
 		lastFailedAt = currentTime
 	}
 
-	h.list = append(result, HistoryItem{
+	item := HistoryItem{
 		Command:         command,
 		LastSucceededAt: lastSucceededAt,
 		LastFailedAt:    lastFailedAt,
+		LastExitStatus:  status,
 		Context:         currentContext,
 		Count:           count,
-	})
-	h.index = len(h.list)
+		ExecutionTime:   executionTime,
+		Dirs:            addDir(dirs, dir),
+	}
+	h.put(item)
+	h.compactList()
+	if h.sessionKeys == nil {
+		h.sessionKeys = make(map[string]bool)
+	}
+	h.sessionKeys[key] = true
+	h.ResetNavigation()
+	return item
+}
+
+// indexHistoryItems returns positions of items by historyItemKey
+func indexHistoryItems(items []HistoryItem) map[string]int {
+	indexes := make(map[string]int, len(items))
+	for i, item := range items {
+		indexes[historyItemKey(item.Command, item.Context)] = i
+	}
+	return indexes
+}
+
+// startNavigation takes commands for Previous and Next if a user starts navigating them
+func (h *History) startNavigation() {
+	if h.navigation != nil {
+		return
+	}
+	items := h.orderedItems()
+	h.navigation = make([]string, 0, len(items))
+	for _, item := range items {
+		h.navigation = append(h.navigation, item.Command)
+	}
 }
 
 func (h *History) Previous() string {
+	h.startNavigation()
 	if h.index > 0 {
 		h.index--
-		return h.list[h.index].Command
+		return h.navigation[h.index]
 	}
 	return ""
 }
 
 func (h *History) Next() (string, bool) {
-	if len(h.list)-1 > h.index {
+	h.startNavigation()
+	if len(h.navigation)-1 > h.index {
 		h.index++
-		return h.list[h.index].Command, true
-	} else if len(h.list) > h.index {
+		return h.navigation[h.index], true
+	} else if len(h.navigation) > h.index {
 		h.index++
 		return "", true
 	}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"sort"
+)
+
+// maxDirsPerItem is the number of recent directories kept in a history item
+const maxDirsPerItem = 10
+
+// HistoryScope is where commands were run, from the widest one
+type HistoryScope int
+
+const (
+	HistoryScopeGlobal HistoryScope = iota
+	HistoryScopeRepository
+	HistoryScopeDirectory
+)
+
+func (s HistoryScope) String() string {
+	switch s {
+	case HistoryScopeRepository:
+		return "repository"
+	case HistoryScopeDirectory:
+		return "directory"
+	}
+	return "global"
+}
+
+// Next returns the scope to toggle to, which cycles from the global one to narrower ones
+func (s HistoryScope) Next() HistoryScope {
+	switch s {
+	case HistoryScopeGlobal:
+		return HistoryScopeDirectory
+	case HistoryScopeDirectory:
+		return HistoryScopeRepository
+	}
+	return HistoryScopeGlobal
+}
+
+// HistoryLocation is the current directory, and the root of its git repository if it's in a repository
+type HistoryLocation struct {
+	Dir           string
+	RepositoryDir string
+}
+
+// Match returns the narrowest scope where an item was run
+func (l HistoryLocation) Match(item HistoryItem) HistoryScope {
+	scope := HistoryScopeGlobal
+	for _, dir := range item.Dirs {
+		if l.Dir != "" && dir == l.Dir {
+			return HistoryScopeDirectory
+		}
+		if l.RepositoryDir != "" && isInDir(dir, l.RepositoryDir) {
+			scope = HistoryScopeRepository
+		}
+	}
+	return scope
+}
+
+// Rank returns items in a scope from the oldest one,
+// where items run in the current directory are after ones in the repository, and they are after the others
+func (l HistoryLocation) Rank(items []HistoryItem, scope HistoryScope) []HistoryItem {
+	scopes := make([]HistoryScope, 0, len(items))
+	result := make([]HistoryItem, 0, len(items))
+	for _, item := range items {
+		itemScope := l.Match(item)
+		if itemScope < scope {
+			continue
+		}
+		scopes = append(scopes, itemScope)
+		result = append(result, item)
+	}
+	sort.Stable(rankedHistoryItems{items: result, scopes: scopes})
+	return result
+}
+
+type rankedHistoryItems struct {
+	items  []HistoryItem
+	scopes []HistoryScope
+}
+
+func (r rankedHistoryItems) Len() int {
+	return len(r.items)
+}
+
+func (r rankedHistoryItems) Less(i, j int) bool {
+	return r.scopes[i] < r.scopes[j]
+}
+
+func (r rankedHistoryItems) Swap(i, j int) {
+	r.items[i], r.items[j] = r.items[j], r.items[i]
+	r.scopes[i], r.scopes[j] = r.scopes[j], r.scopes[i]
+}
+
+// addDir moves a directory to the end of recent directories
+func addDir(dirs []string, dir string) []string {
+	if dir == "" {
+		return dirs
+	}
+	result := make([]string, 0, len(dirs)+1)
+	for _, d := range dirs {
+		if d != dir {
+			result = append(result, d)
+		}
+	}
+	result = append(result, dir)
+	if len(result) > maxDirsPerItem {
+		result = result[len(result)-maxDirsPerItem:]
+	}
+	return result
+}
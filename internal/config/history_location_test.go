@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryLocation_Rank(t *testing.T) {
+	items := []HistoryItem{
+		{Command: "in the directory", Dirs: []string{"/tmp", "/home/user/repo"}},
+		{Command: "in the repository", Dirs: []string{"/home/user/repo/internal"}},
+		{Command: "in another repository", Dirs: []string{"/home/user/repository"}},
+		{Command: "without directories"},
+	}
+	location := HistoryLocation{Dir: "/home/user/repo", RepositoryDir: "/home/user/repo"}
+
+	testCases := []struct {
+		name     string
+		location HistoryLocation
+		scope    HistoryScope
+		want     []string
+	}{
+		{
+			name:     "rank all items",
+			location: location,
+			scope:    HistoryScopeGlobal,
+			want:     []string{"in another repository", "without directories", "in the repository", "in the directory"},
+		},
+		{
+			name:     "items in the repository",
+			location: location,
+			scope:    HistoryScopeRepository,
+			want:     []string{"in the repository", "in the directory"},
+		},
+		{
+			name:     "items in the directory",
+			location: location,
+			scope:    HistoryScopeDirectory,
+			want:     []string{"in the directory"},
+		},
+		{
+			name:  "no repository",
+			scope: HistoryScopeRepository,
+			want:  []string{},
+		},
+		{
+			name:  "keep the order without a location",
+			scope: HistoryScopeGlobal,
+			want:  []string{"in the directory", "in the repository", "in another repository", "without directories"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := []string{}
+			for _, item := range tc.location.Rank(items, tc.scope) {
+				got = append(got, item.Command)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestAddDir(t *testing.T) {
+	var dirs []string
+	for i := 0; i < maxDirsPerItem+2; i++ {
+		dirs = addDir(dirs, fmt.Sprintf("/dir%d", i))
+	}
+	dirs = addDir(dirs, "/dir5")
+	dirs = addDir(dirs, "")
+
+	// The oldest directories are dropped, and a directory run again is moved to the end
+	want := []string{"/dir2", "/dir3", "/dir4"}
+	for i := 6; i < maxDirsPerItem+2; i++ {
+		want = append(want, fmt.Sprintf("/dir%d", i))
+	}
+	assert.Equal(t, append(want, "/dir5"), dirs)
+}
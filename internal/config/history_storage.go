@@ -0,0 +1,175 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+)
+
+// HistoryStorage stores records of history items.
+// A later record replaces an earlier one with the same command and context
+type HistoryStorage interface {
+	// Lock runs f while other shells can't write the storage.
+	// Append and Compact are called in f so that records of other shells are merged before writing
+	Lock(f func() error) error
+	// Load reads all records from the oldest one
+	Load() ([]HistoryItem, error)
+	// LoadNew reads records appended by any shell since the last Load or LoadNew.
+	// If the storage was compacted by another shell, it reads all records
+	LoadNew() ([]HistoryItem, error)
+	// Append adds a record without rewriting other records
+	Append(item HistoryItem) error
+	// Compact replaces all records with items, which don't have the same command and context
+	Compact(items []HistoryItem) error
+}
+
+// jsonLinesHistoryStorage is an append-only file with a JSON record per line
+type jsonLinesHistoryStorage struct {
+	config   *Config
+	fileName string
+	// file is kept open to know if it's replaced by compaction.
+	// While it's open, a new file never has the same inode
+	file *os.File
+	// offset is the size of the file which was read last time
+	offset int64
+	// size is the size of the file when it was checked last time, to skip reading it if it's not changed
+	size int64
+}
+
+func newJSONLinesHistoryStorage(c *Config, fileName string) *jsonLinesHistoryStorage {
+	return &jsonLinesHistoryStorage{
+		config:   c,
+		fileName: fileName,
+		size:     -1,
+	}
+}
+
+func (s *jsonLinesHistoryStorage) Lock(f func() error) error {
+	return s.config.withLock(s.fileName, f)
+}
+
+func (s *jsonLinesHistoryStorage) Load() ([]HistoryItem, error) {
+	s.closeFile()
+	return s.LoadNew()
+}
+
+func (s *jsonLinesHistoryStorage) LoadNew() ([]HistoryItem, error) {
+	fileInfo, err := s.openFile()
+	if err != nil {
+		return nil, err
+	}
+	if s.file == nil {
+		return nil, nil
+	}
+	// The file is only appended unless it's replaced, so it's not changed if it has the same size
+	if fileInfo.Size() == s.size {
+		return nil, nil
+	}
+
+	if fileInfo.Size() < s.offset {
+		s.offset = 0
+	}
+	data, err := io.ReadAll(io.NewSectionReader(s.file, s.offset, fileInfo.Size()-s.offset))
+	if err != nil {
+		return nil, err
+	}
+	s.size = fileInfo.Size()
+	// A last line without a newline may still be written by another shell
+	end := bytes.LastIndexByte(data, '\n') + 1
+	s.offset += int64(end)
+	return parseHistoryRecords(data[:end]), nil
+}
+
+// openFile opens the file if it's not opened yet or it was replaced, and reads it from the beginning.
+// It returns the current information of the file, and file is nil if it doesn't exist
+func (s *jsonLinesHistoryStorage) openFile() (os.FileInfo, error) {
+	filePath := s.config.filePath(s.fileName)
+	fileInfo, err := os.Stat(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		s.closeFile()
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.file != nil {
+		if openedInfo, err := s.file.Stat(); err == nil && os.SameFile(openedInfo, fileInfo) {
+			return fileInfo, nil
+		}
+		s.closeFile()
+	}
+
+	file, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The file may be replaced again after os.Stat
+	fileInfo, err = file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	s.file = file
+	return fileInfo, nil
+}
+
+func (s *jsonLinesHistoryStorage) closeFile() {
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = nil
+	s.offset = 0
+	s.size = -1
+}
+
+// parseHistoryRecords skips broken lines so that the rest of a history can be still used.
+// Deprecated fields in records are migrated
+func parseHistoryRecords(data []byte) []HistoryItem {
+	var items []HistoryItem
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		var legacyItem legacyHistoryItem
+		if err := json.Unmarshal(line, &legacyItem); err != nil {
+			continue
+		}
+		item, _ := legacyItem.migrate()
+		items = append(items, item)
+	}
+	return items
+}
+
+func (s *jsonLinesHistoryStorage) Append(item HistoryItem) error {
+	line, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return s.config.appendFile(s.fileName, append(line, '\n'))
+}
+
+func (s *jsonLinesHistoryStorage) Compact(items []HistoryItem) error {
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	for _, item := range items {
+		if err := encoder.Encode(item); err != nil {
+			return err
+		}
+	}
+	// The lock is already held by Lock
+	if err := s.config.replaceFile(s.fileName, data.Bytes()); err != nil {
+		return err
+	}
+	s.closeFile()
+	if _, err := s.openFile(); err != nil {
+		return err
+	}
+	s.offset = int64(data.Len())
+	s.size = s.offset
+	return nil
+}
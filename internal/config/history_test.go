@@ -1,12 +1,17 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 )
 
 func newHistoryFromCommands(strs []string) []HistoryItem {
@@ -76,48 +81,346 @@ func TestHistory_Previous(t *testing.T) {
 	}
 }
 
-func TestHistory_SaveFile(t *testing.T) {
-	dir := os.TempDir()
-	fmt.Println(dir)
-	tmpConfig, err := NewConfig(dir)
-	assert.NoError(t, err)
+func TestHistory_LoadFile(t *testing.T) {
 	now := time.Date(2023, 1, 1, 1, 1, 1, 1, time.UTC)
+	items := []HistoryItem{
+		{Command: "command1", LastSucceededAt: now.Add(1), LastFailedAt: now.Add(2), Count: 1, Context: map[string]string{"key": "value"}},
+		{Command: "command2", LastSucceededAt: now.Add(10), LastFailedAt: now.Add(20), Count: 2},
+		{Command: "command3", LastSucceededAt: now.Add(30), Count: 1, ExecutionTime: &ExecutionTime{Real: time.Second, User: time.Millisecond, System: time.Microsecond}},
+	}
 
 	testCases := []struct {
-		name string
-		want History
+		name        string
+		legacyItems []HistoryItem
+		records     []HistoryItem
+		maxSize     int
+		want        []HistoryItem
 	}{
 		{
-			name: "file doesn't exist",
-			want: History{
-				fileName: "tmp-want.json",
-				maxSize:  10,
-				config:   tmpConfig,
-				list: []HistoryItem{
-					{Command: "command1", LastSucceededAt: now.Add(1), LastFailedAt: now.Add(2), Count: 1, Context: map[string]string{"key": "value"}},
-					{Command: "command2", LastSucceededAt: now.Add(10), LastFailedAt: now.Add(20), Count: 2},
-				},
-				currentTime: now,
+			name: "no file",
+		},
+		{
+			name:    "records replaced by later ones",
+			records: append(append([]HistoryItem{}, items...), HistoryItem{Command: "command1", Count: 2, Context: map[string]string{"key": "value"}}),
+			maxSize: 10,
+			want: []HistoryItem{
+				items[1],
+				items[2],
+				{Command: "command1", Count: 2, Context: map[string]string{"key": "value"}},
 			},
 		},
+		{
+			name:    "keep the latest items",
+			records: items,
+			maxSize: 2,
+			want:    items[1:],
+		},
+		{
+			name:        "migrate a JSON file",
+			legacyItems: items,
+			maxSize:     10,
+			want:        items,
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			assert.NoError(t, tc.want.saveFile())
+			c, err := NewConfig(t.TempDir())
+			require.NoError(t, err)
+			history := NewHistory(c)
+			history.maxSize = tc.maxSize
+			if tc.legacyItems != nil {
+				data, err := json.Marshal(tc.legacyItems)
+				require.NoError(t, err)
+				require.NoError(t, c.replaceFile(history.legacyFileName, data))
+			}
+			for _, record := range tc.records {
+				require.NoError(t, history.storage.Append(record))
+			}
+
+			require.NoError(t, history.LoadFile())
+			assert.Equal(t, tc.want, history.Get())
+			assert.Equal(t, len(tc.want), history.index)
+			if tc.legacyItems == nil {
+				return
+			}
+
+			// The migrated history is loaded from the storage after the JSON file is renamed as a backup
+			_, err = os.Stat(c.filePath(history.legacyFileName))
+			assert.True(t, os.IsNotExist(err))
+			backup, err := c.readFile(history.legacyFileName + ".bak")
+			require.NoError(t, err)
+			var gotBackup []HistoryItem
+			require.NoError(t, json.Unmarshal(backup, &gotBackup))
+			assert.Equal(t, tc.legacyItems, gotBackup)
+			got := NewHistory(c)
+			require.NoError(t, got.LoadFile())
+			assert.Equal(t, tc.want, got.Get())
+		})
+	}
+}
+
+func TestHistory_Sync(t *testing.T) {
+	c, err := NewConfig(t.TempDir())
+	require.NoError(t, err)
+	logger := zap.NewNop()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Two shells share a history file
+	history1 := NewHistory(c)
+	history1.currentTime = now
+	require.NoError(t, history1.LoadFile())
+	history2 := NewHistory(c)
+	history2.currentTime = now
+	require.NoError(t, history2.LoadFile())
+
+	<-history1.Sync(Execution{Command: "command1", Dir: "/home/user/repo"}, logger)
+	<-history2.Sync(Execution{Command: "command2", ExitStatus: 1}, logger)
+	<-history2.Sync(Execution{Command: "command1", Dir: "/home/user", Time: &ExecutionTime{Real: time.Second}}, logger)
+	want := []HistoryItem{
+		{Command: "command2", LastFailedAt: now, LastExitStatus: 1, Count: 1},
+		{Command: "command1", LastSucceededAt: now, Count: 2, ExecutionTime: &ExecutionTime{Real: time.Second}, Dirs: []string{"/home/user/repo", "/home/user"}},
+	}
+	assert.Equal(t, want, history2.Get())
 
-			got := History{
-				fileName:    tc.want.fileName,
-				maxSize:     tc.want.maxSize,
-				config:      tc.want.config,
-				currentTime: tc.want.currentTime,
+	got := NewHistory(c)
+	require.NoError(t, got.LoadFile())
+	assert.Equal(t, want, got.Get())
+	assert.Equal(t, 3, got.recordCount)
+
+	// Each execution is recorded separately from the aggregated items
+	executions, err := got.FindExecutions("", time.Time{})
+	require.NoError(t, err)
+	hostname, _ := os.Hostname()
+	assert.Equal(t, []Execution{
+		{Command: "command1", Dir: "/home/user/repo", StartedAt: now, SessionID: history1.SessionID(), Hostname: hostname},
+		{Command: "command2", StartedAt: now, ExitStatus: 1, SessionID: history2.SessionID(), Hostname: hostname},
+		{Command: "command1", Dir: "/home/user", StartedAt: now.Add(-time.Second), Time: &ExecutionTime{Real: time.Second}, SessionID: history2.SessionID(), Hostname: hostname},
+	}, executions)
+	assert.NotEqual(t, history1.SessionID(), history2.SessionID())
+}
+
+func TestHistory_LoadFileWithDeprecatedFields(t *testing.T) {
+	runAt := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	c, err := NewConfig(t.TempDir())
+	require.NoError(t, err)
+	history := NewHistory(c)
+	require.NoError(t, c.replaceFile(history.legacyFileName, []byte(`[
+		{"command": "succeeded", "status": 0, "run_at": "2023-01-01T00:00:00Z"},
+		{"command": "failed", "status": 2, "run_at": "2023-01-01T00:00:00Z", "count": 3},
+		{"command": "current", "last_succeeded_at": "2023-01-01T00:00:00Z", "count": 1}
+	]`)))
+	require.NoError(t, history.storage.Append(HistoryItem{Command: "record"}))
+	require.NoError(t, c.appendFile("history.jsonl", []byte(`{"command": "old record", "status": 1}`+"\n")))
+
+	// Records in the storage are migrated when they're read
+	require.NoError(t, history.LoadFile())
+	assert.Equal(t, []HistoryItem{
+		{Command: "record"},
+		{Command: "old record", LastExitStatus: 1},
+	}, history.Get())
+
+	// The legacy file is migrated with executions if the storage is empty
+	require.NoError(t, c.removeFile("history.jsonl"))
+	require.NoError(t, history.LoadFile())
+	assert.Equal(t, []HistoryItem{
+		{Command: "succeeded", LastSucceededAt: runAt, Count: 1},
+		{Command: "failed", LastFailedAt: runAt, LastExitStatus: 2, Count: 3},
+		{Command: "current", LastSucceededAt: runAt, Count: 1},
+	}, history.Get())
+	executions, err := history.FindExecutions("", time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, []Execution{
+		{Command: "succeeded", StartedAt: runAt},
+		{Command: "failed", StartedAt: runAt, ExitStatus: 2},
+	}, executions)
+}
+
+func TestHistory_SyncInParallel(t *testing.T) {
+	const writers = 8
+	const commandsPerWriter = 300
+	// Each writer is a shell process which runs a shared command and its own commands,
+	// and the history file is compacted while they write
+	if writerID := os.Getenv("GO_SHELL_TEST_HISTORY_WRITER"); writerID != "" {
+		c, err := NewConfig(os.Getenv("GO_SHELL_TEST_HOME"))
+		require.NoError(t, err)
+		history := NewHistory(c)
+		require.NoError(t, history.LoadFile())
+		for j := 0; j < commandsPerWriter; j++ {
+			command := "shared"
+			if j%2 == 1 {
+				command = fmt.Sprintf("writer%s-%d", writerID, j%10)
 			}
-			assert.NoError(t, got.LoadFile())
-			assert.Equal(t, tc.want.list, got.list)
-			assert.Equal(t, len(tc.want.list), got.index)
+			<-history.Sync(Execution{Command: command}, zap.NewNop())
+		}
+		return
+	}
+
+	homeDir := t.TempDir()
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHistory_SyncInParallel$")
+		cmd.Env = append(os.Environ(),
+			fmt.Sprintf("GO_SHELL_TEST_HISTORY_WRITER=%d", i),
+			"GO_SHELL_TEST_HOME="+homeDir,
+		)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if output, err := cmd.CombinedOutput(); err != nil {
+				t.Errorf("a writer failed: %v\n%s", err, output)
+			}
+		}()
+	}
+	wg.Wait()
+
+	c, err := NewConfig(homeDir)
+	require.NoError(t, err)
+	got := NewHistory(c)
+	require.NoError(t, got.LoadFile())
+	counts := make(map[string]int)
+	for _, item := range got.Get() {
+		counts[item.Command] = item.Count
+	}
+	want := map[string]int{
+		"shared": writers * commandsPerWriter / 2,
+	}
+	for i := 0; i < writers; i++ {
+		for j := 1; j < 10; j += 2 {
+			want[fmt.Sprintf("writer%d-%d", i, j)] = commandsPerWriter / 10
+		}
+	}
+	assert.Equal(t, want, counts)
+}
+
+func TestHistory_Refresh(t *testing.T) {
+	c, err := NewConfig(t.TempDir())
+	require.NoError(t, err)
+	logger := zap.NewNop()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	otherShell := NewHistory(c)
+	otherShell.currentTime = now
+	require.NoError(t, otherShell.LoadFile())
+	<-otherShell.Sync(Execution{Command: "other1"}, logger)
+
+	history := NewHistory(c)
+	history.currentTime = now
+	require.NoError(t, history.LoadFile())
+	<-history.Sync(Execution{Command: "local1"}, logger)
+	<-otherShell.Sync(Execution{Command: "other2"}, logger)
+
+	// Commands of another shell are merged, and navigation continues with the same commands
+	assert.Equal(t, "local1", history.Previous())
+	<-otherShell.Sync(Execution{Command: "other3"}, logger)
+	require.NoError(t, history.Refresh())
+	assert.Equal(t, "other1", history.Previous())
+	assert.Equal(t, "", history.Previous())
+	got, ok := history.Next()
+	assert.Equal(t, "local1", got)
+	assert.True(t, ok)
+
+	history.ResetNavigation()
+	assert.Equal(t, "other3", history.Previous())
+	assert.Equal(t, "other3", history.StartWith("o"))
+
+	// Commands of the current shell are before ones of other shells in the local order
+	history.SetLocalOrder(true)
+	history.ResetNavigation()
+	var gotCommands []string
+	for command := history.Previous(); command != ""; command = history.Previous() {
+		gotCommands = append(gotCommands, command)
+	}
+	assert.Equal(t, []string{"local1", "other3", "other2", "other1"}, gotCommands)
+	assert.Equal(t, "local1", history.StartWith(""))
+}
+
+func TestHistory_StartWith(t *testing.T) {
+	history := &History{}
+	history.add("make build", 0, nil, nil, "/home/user/repo/cmd", time.Time{})
+	history.add("make test", 0, nil, nil, "/home/user/repo", time.Time{})
+	history.add("make all", 0, nil, nil, "/tmp", time.Time{})
+	// A command which failed last time is also a candidate
+	history.add("make fail", 1, nil, nil, "/tmp", time.Time{})
+
+	testCases := []struct {
+		name     string
+		location HistoryLocation
+		want     string
+	}{
+		{
+			name: "the latest command without a location",
+			want: "make fail",
+		},
+		{
+			name:     "a command in the current directory",
+			location: HistoryLocation{Dir: "/home/user/repo", RepositoryDir: "/home/user/repo"},
+			want:     "make test",
+		},
+		{
+			name:     "a command in the current repository",
+			location: HistoryLocation{Dir: "/home/user/repo/internal", RepositoryDir: "/home/user/repo"},
+			want:     "make test",
+		},
+		{
+			name:     "a command in another directory",
+			location: HistoryLocation{Dir: "/home/user/other"},
+			want:     "make fail",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			history.SetLocation(tc.location)
+			assert.Equal(t, tc.want, history.StartWith("make"))
 		})
 	}
 }
 
+func TestHistory_StartWithCache(t *testing.T) {
+	history := &History{maxSize: 10}
+	history.SetLocation(HistoryLocation{Dir: "/home/user/repo"})
+	history.add("make test", 0, nil, nil, "/home/user/repo", time.Time{})
+	history.add("make all", 0, nil, nil, "/tmp", time.Time{})
+	assert.Equal(t, "make test", history.StartWith("make"))
+
+	// Items ranked once are reused while nothing changes
+	ranked := history.ranked
+	assert.Equal(t, "make test", history.StartWith("make t"))
+	assert.Same(t, &ranked[0], &history.ranked[0])
+
+	// The cache is invalidated by a command added by the current shell or merged from other shells
+	history.add("make build", 0, nil, nil, "/home/user/repo", time.Time{})
+	assert.Equal(t, "make build", history.StartWith("make"))
+	history.merge([]HistoryItem{{Command: "make lint", Dirs: []string{"/home/user/repo"}}})
+	assert.Equal(t, "make lint", history.StartWith("make"))
+
+	// and by another location
+	history.SetLocation(HistoryLocation{Dir: "/tmp"})
+	assert.Equal(t, "make all", history.StartWith("make"))
+}
+
+func TestHistory_Compact(t *testing.T) {
+	c, err := NewConfig(t.TempDir())
+	require.NoError(t, err)
+	history := NewHistory(c)
+	history.currentTime = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, history.LoadFile())
+
+	logger := zap.NewNop()
+	for i := 0; i <= minRecordsToCompact; i++ {
+		<-history.Sync(Execution{Command: fmt.Sprintf("command%d", i%2)}, logger)
+	}
+	// Records are read in the next Sync, and compacted after it
+	<-history.Sync(Execution{Command: "command2"}, logger)
+	assert.Equal(t, 3, history.recordCount)
+
+	got := NewHistory(c)
+	require.NoError(t, got.LoadFile())
+	assert.Equal(t, history.Get(), got.Get())
+	assert.Equal(t, 3, got.recordCount)
+	assert.Equal(t, []string{"command1", "command0", "command2"}, []string{got.Get()[0].Command, got.Get()[1].Command, got.Get()[2].Command})
+	assert.Equal(t, minRecordsToCompact/2, got.Get()[0].Count)
+}
+
 func TestHistory_Next(t *testing.T) {
 	testCases := []struct {
 		name      string
@@ -180,6 +483,43 @@ func TestHistory_Next(t *testing.T) {
 	}
 }
 
+func TestHistory_AddWithIndexes(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := History{maxSize: 10}
+	for _, command := range []string{"a", "b", "c", "a", "b"} {
+		history.Add(command, 0, nil, now)
+	}
+	// Records of other shells move items like commands of the current shell
+	history.merge([]HistoryItem{{Command: "a", Count: 5}})
+	history.Add("c", 0, nil, now)
+	history.Add("a", 0, nil, now)
+
+	assert.Equal(t, []HistoryItem{
+		{Command: "b", Count: 2, LastSucceededAt: now},
+		{Command: "c", Count: 2, LastSucceededAt: now},
+		{Command: "a", Count: 6, LastSucceededAt: now},
+	}, history.Get())
+	assert.Equal(t, indexHistoryItems(history.list), history.indexes)
+}
+
+func TestHistory_MergeDropsOldItems(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := History{maxSize: 3}
+	for i := 0; i < 100; i++ {
+		history.merge([]HistoryItem{{Command: fmt.Sprintf("command%d", i%5), Count: i}})
+		history.Add(fmt.Sprintf("command%d", i%4), 0, nil, now)
+		// Replaced and dropped items are removed once they're more than the current items
+		assert.LessOrEqual(t, len(history.list), 2*history.size())
+	}
+
+	assert.Equal(t, []HistoryItem{
+		{Command: "command2", Count: 98, LastSucceededAt: now},
+		{Command: "command4", Count: 99},
+		{Command: "command3", Count: 99, LastSucceededAt: now},
+	}, history.Get())
+	assert.Equal(t, 3, history.index)
+}
+
 func TestHistory_Add(t *testing.T) {
 	commandRunAt := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
 
@@ -262,9 +602,10 @@ func TestHistory_Add(t *testing.T) {
 					Count:   1,
 				},
 				{
-					Command:      "command2",
-					Count:        1,
-					LastFailedAt: commandRunAt,
+					Command:        "command2",
+					Count:          1,
+					LastFailedAt:   commandRunAt,
+					LastExitStatus: 1,
 					Context: map[string]string{
 						"key": "value",
 					},
@@ -300,9 +641,10 @@ func TestHistory_Add(t *testing.T) {
 					},
 				},
 				{
-					Command:      "command1",
-					Count:        1,
-					LastFailedAt: commandRunAt,
+					Command:        "command1",
+					Count:          1,
+					LastFailedAt:   commandRunAt,
+					LastExitStatus: 1,
 					Context: map[string]string{
 						"key": "value2",
 					},
@@ -353,6 +695,7 @@ func TestHistory_Add(t *testing.T) {
 					Count:           3,
 					LastSucceededAt: time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
 					LastFailedAt:    commandRunAt,
+					LastExitStatus:  1,
 					Context: map[string]string{
 						"key": "value",
 					},
@@ -365,8 +708,43 @@ func TestHistory_Add(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.history.Add(tc.command, tc.status, tc.context, commandRunAt)
-			assert.Equal(t, tc.wantList, tc.history.list)
+			assert.Equal(t, tc.wantList, tc.history.Get())
 			assert.Equal(t, tc.wantIndex, tc.history.index)
 		})
 	}
 }
+
+func TestJSONLinesHistoryStorage_LoadNew(t *testing.T) {
+	c, err := NewConfig(t.TempDir())
+	require.NoError(t, err)
+	storage := newJSONLinesHistoryStorage(c, "history.jsonl")
+	require.NoError(t, storage.Append(HistoryItem{Command: "command1"}))
+
+	got, err := storage.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []HistoryItem{{Command: "command1"}}, got)
+
+	// Nothing is read while the file doesn't change
+	got, err = storage.LoadNew()
+	require.NoError(t, err)
+	assert.Empty(t, got)
+	offset := storage.offset
+
+	// A line which is being written is read after it's completed
+	require.NoError(t, c.appendFile("history.jsonl", []byte(`{"command": "comm`)))
+	got, err = storage.LoadNew()
+	require.NoError(t, err)
+	assert.Empty(t, got)
+	assert.Equal(t, offset, storage.offset)
+	require.NoError(t, c.appendFile("history.jsonl", []byte(`and2"}`+"\n")))
+	got, err = storage.LoadNew()
+	require.NoError(t, err)
+	assert.Equal(t, []HistoryItem{{Command: "command2"}}, got)
+
+	// A file replaced by another shell is read from the beginning
+	other := newJSONLinesHistoryStorage(c, "history.jsonl")
+	require.NoError(t, other.Compact([]HistoryItem{{Command: "command3"}}))
+	got, err = storage.LoadNew()
+	require.NoError(t, err)
+	assert.Equal(t, []HistoryItem{{Command: "command3"}}, got)
+}
@@ -0,0 +1,288 @@
+package expansion
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// GlobOptions are options for pathname expansion compatible with bash's shopt
+type GlobOptions struct {
+	// IsDotGlob makes wildcards match file names starting with a dot
+	IsDotGlob bool
+	// IsGlobStar makes ** match files and directories recursively
+	IsGlobStar bool
+	// Dir is the directory where relative patterns are matched instead of the current directory
+	Dir string
+}
+
+// HasGlobPattern returns true if a pattern has an unescaped *, ? or [
+func HasGlobPattern(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '*', '?', '[':
+			return true
+		}
+	}
+	return false
+}
+
+// EscapeGlobPattern escapes characters in a string so that it matches only itself
+func EscapeGlobPattern(str string) string {
+	var sb strings.Builder
+	for _, c := range str {
+		if strings.ContainsRune(`*?[]\`, c) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// UnescapeGlobPattern removes backslashes escaping characters in a pattern
+func UnescapeGlobPattern(pattern string) string {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			i++
+		}
+		sb.WriteByte(pattern[i])
+	}
+	return sb.String()
+}
+
+// MatchName returns true if a file name matches a pattern.
+// A file name starting with a dot has to be matched by an explicit dot unless isDotGlob is true,
+// and . and .. are never matched by wildcards
+func MatchName(pattern string, name string, isDotGlob bool) bool {
+	if strings.HasPrefix(name, ".") && !strings.HasPrefix(pattern, ".") && !strings.HasPrefix(pattern, `\.`) {
+		if !isDotGlob || name == "." || name == ".." {
+			return false
+		}
+	}
+	return MatchPattern(pattern, name)
+}
+
+// MatchPattern returns true if a whole string matches a pattern with *, ? and [...]
+func MatchPattern(pattern string, str string) bool {
+	// The position to retry when a character after * doesn't match
+	starPattern, starStr := -1, -1
+	p, s := 0, 0
+	for s < len(str) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starPattern, starStr = p, s
+				p++
+				continue
+			case '?':
+				_, size := utf8.DecodeRuneInString(str[s:])
+				p++
+				s += size
+				continue
+			case '[':
+				c, size := utf8.DecodeRuneInString(str[s:])
+				if matched, end, ok := matchBracket(pattern[p:], c); ok {
+					if matched {
+						p += end
+						s += size
+						continue
+					}
+				} else if str[s] == '[' {
+					// An unclosed [ matches itself
+					p++
+					s++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) && pattern[p+1] == str[s] {
+					p += 2
+					s++
+					continue
+				}
+			default:
+				if pattern[p] == str[s] {
+					p++
+					s++
+					continue
+				}
+			}
+		}
+		if starPattern < 0 {
+			return false
+		}
+		_, size := utf8.DecodeRuneInString(str[starStr:])
+		starStr += size
+		p, s = starPattern+1, starStr
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchBracket matches a character with a bracket expression like [a-z] or [!0-9] at the beginning of a pattern.
+// It returns the length of the bracket expression, and false if it's not closed
+func matchBracket(pattern string, c rune) (matched bool, end int, ok bool) {
+	i := 1
+	isNegated := false
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		isNegated = true
+		i++
+	}
+	for isFirst := true; i < len(pattern); isFirst = false {
+		if pattern[i] == ']' && !isFirst {
+			return matched != isNegated, i + 1, true
+		}
+
+		low, size := decodeBracketRune(pattern[i:])
+		i += size
+		high := low
+		if i+1 < len(pattern) && pattern[i] == '-' && pattern[i+1] != ']' {
+			high, size = decodeBracketRune(pattern[i+1:])
+			i += 1 + size
+		}
+		if low <= c && c <= high {
+			matched = true
+		}
+	}
+	return false, 0, false
+}
+
+func decodeBracketRune(pattern string) (rune, int) {
+	if pattern[0] == '\\' && len(pattern) > 1 {
+		c, size := utf8.DecodeRuneInString(pattern[1:])
+		return c, size + 1
+	}
+	return utf8.DecodeRuneInString(pattern)
+}
+
+// Glob returns sorted paths matching a pattern.
+// Unlike filepath.Glob, it supports ** and handles dotfiles like a shell
+func Glob(pattern string, options GlobOptions) ([]string, error) {
+	components := strings.Split(pattern, "/")
+	paths := []string{""}
+	if strings.HasPrefix(pattern, "/") {
+		paths = []string{"/"}
+		components = components[1:]
+	}
+
+	for i, component := range components {
+		isLast := i == len(components)-1
+		var nextPaths []string
+		for _, path := range paths {
+			matches, err := globComponent(path, component, isLast, options)
+			if err != nil {
+				return nil, err
+			}
+			nextPaths = append(nextPaths, matches...)
+		}
+		paths = nextPaths
+		if len(paths) == 0 {
+			return nil, nil
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func globComponent(parent string, component string, isLast bool, options GlobOptions) ([]string, error) {
+	join := func(name string) string {
+		if parent == "" || strings.HasSuffix(parent, "/") {
+			return parent + name
+		}
+		return parent + "/" + name
+	}
+	dir := parent
+	if dir == "" {
+		dir = "."
+	}
+
+	if component == "" {
+		// A trailing slash matches only directories
+		if isLast {
+			if info, err := os.Stat(options.fsPath(dir)); err != nil || !info.IsDir() {
+				return nil, nil
+			}
+		}
+		return []string{join("")}, nil
+	}
+	if !HasGlobPattern(component) {
+		path := join(UnescapeGlobPattern(component))
+		if _, err := os.Lstat(options.fsPath(path)); err != nil {
+			return nil, nil
+		}
+		return []string{path}, nil
+	}
+	if component == "**" && options.IsGlobStar {
+		return globStar(parent, dir, isLast, options)
+	}
+
+	entries, err := os.ReadDir(options.fsPath(dir))
+	if err != nil {
+		// Unreadable directories don't match anything like shells
+		return nil, nil
+	}
+	var matches []string
+	for _, entry := range entries {
+		if MatchName(component, entry.Name(), options.IsDotGlob) {
+			matches = append(matches, join(entry.Name()))
+		}
+	}
+	return matches, nil
+}
+
+// globStar returns a parent and all directories under it, and files as well if ** is the last component
+func globStar(parent string, dir string, isLast bool, options GlobOptions) ([]string, error) {
+	var matches []string
+	// ** matches zero directories as well
+	if parent != "" || !isLast {
+		matches = append(matches, parent)
+	}
+	root := options.fsPath(dir)
+	err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if path == root {
+			return nil
+		}
+		if rel, err := filepath.Rel(root, path); err == nil {
+			path = filepath.Join(dir, rel)
+		}
+		if !MatchName("*", entry.Name(), options.IsDotGlob) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.IsDir() && !isLast {
+			return nil
+		}
+		if parent == "" {
+			path = strings.TrimPrefix(path, "./")
+		}
+		matches = append(matches, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("filepath.WalkDir failed: %w", err)
+	}
+	return matches, nil
+}
+
+// fsPath returns a path to access a file, which is relative to Dir if it's set
+func (options GlobOptions) fsPath(path string) string {
+	if options.Dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(options.Dir, path)
+}
@@ -0,0 +1,184 @@
+package expansion
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchPattern(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		str     string
+		want    bool
+	}{
+		{pattern: "*.log", str: "app.log", want: true},
+		{pattern: "*.log", str: "app.log.1", want: false},
+		{pattern: "a*b*c", str: "aXbYbZc", want: true},
+		{pattern: "a?c", str: "abc", want: true},
+		{pattern: "a?c", str: "aあc", want: true},
+		{pattern: "a?c", str: "ac", want: false},
+		{pattern: "[a-c]x", str: "bx", want: true},
+		{pattern: "[!a-c]x", str: "bx", want: false},
+		{pattern: "[^a-c]x", str: "dx", want: true},
+		{pattern: "[]a]", str: "]", want: true},
+		{pattern: "[a-]", str: "-", want: true},
+		{pattern: "a[", str: "a[", want: true},
+		{pattern: `\*`, str: "*", want: true},
+		{pattern: `\*`, str: "a", want: false},
+		{pattern: "*", str: "", want: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.pattern+" "+tc.str, func(t *testing.T) {
+			got := MatchPattern(tc.pattern, tc.str)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestMatchName(t *testing.T) {
+	testCases := []struct {
+		name      string
+		pattern   string
+		fileName  string
+		isDotGlob bool
+		want      bool
+	}{
+		{
+			name:     "a wildcard doesn't match a dotfile",
+			pattern:  "*rc",
+			fileName: ".bashrc",
+			want:     false,
+		},
+		{
+			name:     "an explicit dot matches a dotfile",
+			pattern:  ".*rc",
+			fileName: ".bashrc",
+			want:     true,
+		},
+		{
+			name:      "a wildcard matches a dotfile with dotglob",
+			pattern:   "*rc",
+			fileName:  ".bashrc",
+			isDotGlob: true,
+			want:      true,
+		},
+		{
+			name:      "a wildcard never matches ..",
+			pattern:   "*",
+			fileName:  "..",
+			isDotGlob: true,
+			want:      false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := MatchName(tc.pattern, tc.fileName, tc.isDotGlob)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestGlob(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, file := range []string{
+		"a.log",
+		"b.log",
+		".hidden.log",
+		"c.txt",
+		"internal/",
+		"internal/x.go",
+		"internal/shell/",
+		"internal/shell/y.go",
+		"internal/.git/",
+		"internal/.git/z.go",
+	} {
+		path := filepath.Join(tempDir, file)
+		if strings.HasSuffix(file, "/") {
+			require.NoError(t, os.Mkdir(path, os.ModePerm))
+		} else {
+			require.NoError(t, os.WriteFile(path, []byte{}, os.ModePerm))
+		}
+	}
+	currentDir, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(tempDir))
+	defer os.Chdir(currentDir)
+
+	testCases := []struct {
+		name    string
+		pattern string
+		options GlobOptions
+		want    []string
+	}{
+		{
+			name:    "a wildcard",
+			pattern: "*.log",
+			want:    []string{"a.log", "b.log"},
+		},
+		{
+			name:    "dotglob",
+			pattern: "*.log",
+			options: GlobOptions{IsDotGlob: true},
+			want:    []string{".hidden.log", "a.log", "b.log"},
+		},
+		{
+			name:    "no match",
+			pattern: "*.md",
+		},
+		{
+			name:    "directories only with a trailing slash",
+			pattern: "*/",
+			want:    []string{"internal/"},
+		},
+		{
+			name:    "an absolute path",
+			pattern: tempDir + "/[ab].log",
+			want:    []string{tempDir + "/a.log", tempDir + "/b.log"},
+		},
+		{
+			name:    "an escaped pattern",
+			pattern: `\*.log`,
+		},
+		{
+			name:    "** without globstar is the same as *",
+			pattern: "**/*.go",
+			want:    []string{"internal/x.go"},
+		},
+		{
+			name:    "** with globstar",
+			pattern: "**/*.go",
+			options: GlobOptions{IsGlobStar: true},
+			want:    []string{"internal/shell/y.go", "internal/x.go"},
+		},
+		{
+			name:    "** at the end with globstar",
+			pattern: "internal/**",
+			options: GlobOptions{IsGlobStar: true},
+			want:    []string{"internal", "internal/shell", "internal/shell/y.go", "internal/x.go"},
+		},
+		{
+			name:    "a relative pattern in another directory",
+			pattern: "*/*.go",
+			options: GlobOptions{Dir: filepath.Join(tempDir, "internal")},
+			want:    []string{"shell/y.go"},
+		},
+		{
+			name:    "** with globstar in another directory",
+			pattern: "**/*.go",
+			options: GlobOptions{IsGlobStar: true, Dir: filepath.Join(tempDir, "internal")},
+			want:    []string{"shell/y.go", "x.go"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, gotErr := Glob(tc.pattern, tc.options)
+			assert.NoError(t, gotErr)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
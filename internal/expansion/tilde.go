@@ -0,0 +1,39 @@
+package expansion
+
+import (
+	"os/user"
+	"strings"
+)
+
+var lookupUser = user.Lookup
+
+// HomeDir returns a directory for a tilde prefix like ~ or ~user.
+// It returns false if a user doesn't exist
+func HomeDir(tildePrefix string, homeDir string) (string, bool) {
+	if !strings.HasPrefix(tildePrefix, "~") {
+		return "", false
+	}
+	name := tildePrefix[1:]
+	if name == "" {
+		return homeDir, true
+	}
+	u, err := lookupUser(name)
+	if err != nil {
+		return "", false
+	}
+	return u.HomeDir, true
+}
+
+// ExpandTilde expands a tilde prefix before the first slash of a path.
+// A path is returned as it is if it doesn't start with a valid tilde prefix
+func ExpandTilde(path string, homeDir string) string {
+	prefix, rest := path, ""
+	if index := strings.IndexByte(path, '/'); index >= 0 {
+		prefix, rest = path[:index], path[index:]
+	}
+	dir, ok := HomeDir(prefix, homeDir)
+	if !ok {
+		return path
+	}
+	return dir + rest
+}
@@ -0,0 +1,63 @@
+package expansion
+
+import (
+	"os/user"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandTilde(t *testing.T) {
+	lookupUser = func(name string) (*user.User, error) {
+		if name == "alice" {
+			return &user.User{Username: name, HomeDir: "/home/alice"}, nil
+		}
+		return nil, user.UnknownUserError(name)
+	}
+	defer func() {
+		lookupUser = user.Lookup
+	}()
+
+	testCases := []struct {
+		name string
+		path string
+		want string
+	}{
+		{
+			name: "a tilde",
+			path: "~",
+			want: "/home/user",
+		},
+		{
+			name: "a tilde with a path",
+			path: "~/.config/go-shell",
+			want: "/home/user/.config/go-shell",
+		},
+		{
+			name: "a tilde with a user",
+			path: "~alice/src",
+			want: "/home/alice/src",
+		},
+		{
+			name: "an unknown user",
+			path: "~unknown/src",
+			want: "~unknown/src",
+		},
+		{
+			name: "a tilde not at the beginning",
+			path: "HEAD~3",
+			want: "HEAD~3",
+		},
+		{
+			name: "a tilde after a slash",
+			path: "./~/a",
+			want: "./~/a",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ExpandTilde(tc.path, "/home/user")
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
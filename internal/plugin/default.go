@@ -7,19 +7,23 @@ import (
 	"strings"
 
 	"github.com/at-ishikawa/go-shell/internal/completion"
+	"github.com/at-ishikawa/go-shell/internal/expansion"
 )
 
 type DefaultPlugin struct {
 	completionUi completion.Completion
 	homeDir      string
+	// getDirectoryStack returns directories of pushd, which are suggested for cd
+	getDirectoryStack func() []string
 }
 
 var _ Plugin = (*DefaultPlugin)(nil)
 
-func NewDefaultPlugin(completionUi completion.Completion, homeDir string) Plugin {
+func NewDefaultPlugin(completionUi completion.Completion, homeDir string, getDirectoryStack func() []string) Plugin {
 	return &DefaultPlugin{
-		completionUi: completionUi,
-		homeDir:      homeDir,
+		completionUi:      completionUi,
+		homeDir:           homeDir,
+		getDirectoryStack: getDirectoryStack,
 	}
 }
 
@@ -50,11 +54,16 @@ func (f DefaultPlugin) Suggest(arg SuggestArg) ([]string, error) {
 	} else if arg.CurrentArgToken == ".." {
 		query = ""
 	}
+	if expansion.HasGlobPattern(query) {
+		// Files are filtered by the glob pattern instead of the query
+		query = ""
+	}
 
 	suggestedValues, err := f.readDirectory(arg.CurrentArgToken, suggestedValuesFromHistory)
 	if err != nil {
 		return nil, fmt.Errorf("f.readDirectory failed: %w", err)
 	}
+	suggestedValues = append(f.directoryStackValues(arg.Args), suggestedValues...)
 	for _, suggestedValueFromhistory := range suggestedValuesFromHistory {
 		suggestedValues = append([]string{suggestedValueFromhistory}, suggestedValues...)
 	}
@@ -75,9 +84,24 @@ func (f DefaultPlugin) Suggest(arg SuggestArg) ([]string, error) {
 	return []string{file}, nil
 }
 
+// directoryStackValues returns directories in the stack of pushd for cd
+func (f DefaultPlugin) directoryStackValues(args []string) []string {
+	if len(args) == 0 || args[0] != "cd" || f.getDirectoryStack == nil {
+		return nil
+	}
+	var values []string
+	for _, dir := range f.getDirectoryStack() {
+		if !strings.HasSuffix(dir, "/") {
+			dir += "/"
+		}
+		values = append(values, dir)
+	}
+	return values
+}
+
 func (f DefaultPlugin) readDirectory(directory string, suggestedValuesFromHistory []string) ([]string, error) {
 	currentDirectory := filepath.Dir(directory)
-	entries, err := os.ReadDir(strings.ReplaceAll(currentDirectory, "~", f.homeDir))
+	entries, err := os.ReadDir(expansion.ExpandTilde(currentDirectory, f.homeDir))
 	if err != nil {
 		return []string{}, fmt.Errorf("os.ReadDir failed: %w", err)
 	}
@@ -92,8 +116,15 @@ func (f DefaultPlugin) readDirectory(directory string, suggestedValuesFromHistor
 	}
 
 	pathSeparator := string(os.PathSeparator)
+	pattern := filepath.Base(directory)
+	if strings.HasSuffix(directory, pathSeparator) || !expansion.HasGlobPattern(pattern) {
+		pattern = ""
+	}
 	var filePaths []string
 	for _, e := range entries {
+		if pattern != "" && !expansion.MatchName(pattern, e.Name(), false) {
+			continue
+		}
 		filePath := currentDirectory + pathSeparator + e.Name()
 		if e.IsDir() {
 			filePath = filePath + "/"
@@ -106,7 +137,7 @@ func (f DefaultPlugin) readDirectory(directory string, suggestedValuesFromHistor
 	}
 
 	parentDirectory := filepath.Dir(currentDirectory + pathSeparator + ".." + pathSeparator)
-	entry, _ := os.Stat(strings.ReplaceAll(parentDirectory, "~", f.homeDir))
+	entry, _ := os.Stat(expansion.ExpandTilde(parentDirectory, f.homeDir))
 	if entry != nil {
 		filePaths = append(filePaths, parentDirectory+"/")
 	}
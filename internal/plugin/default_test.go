@@ -92,6 +92,25 @@ func TestDefaultPlugin_readDirectory(t *testing.T) {
 				osTempDir + string(os.PathSeparator),
 			},
 		},
+		{
+			name: "files matching a glob pattern",
+			fields: fields{
+				homeDir: "/home/user",
+			},
+			args: args{
+				query:                      tempDir + string(os.PathSeparator) + "*.txt",
+				suggestedValuesFromHistory: []string{},
+			},
+			files: []string{
+				"test.txt",
+				"test.log",
+				".hidden.txt",
+			},
+			want: []string{
+				tempDir + "/test.txt",
+				osTempDir + string(os.PathSeparator),
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -118,3 +137,43 @@ func TestDefaultPlugin_readDirectory(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultPlugin_directoryStackValues(t *testing.T) {
+	testCases := []struct {
+		name              string
+		getDirectoryStack func() []string
+		args              []string
+
+		want []string
+	}{
+		{
+			name: "cd",
+			getDirectoryStack: func() []string {
+				return []string{"/usr", "/"}
+			},
+			args: []string{"cd"},
+			want: []string{"/usr/", "/"},
+		},
+		{
+			name: "other commands",
+			getDirectoryStack: func() []string {
+				return []string{"/usr"}
+			},
+			args: []string{"ls"},
+		},
+		{
+			name: "no directory stack",
+			args: []string{"cd"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &DefaultPlugin{
+				getDirectoryStack: tc.getDirectoryStack,
+			}
+			got := f.directoryStackValues(tc.args)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -3,7 +3,6 @@ package plugin
 import (
 	"fmt"
 	"reflect"
-	"sort"
 	"strings"
 	"time"
 
@@ -37,7 +36,14 @@ func (h HistoryPlugin) GetContext(_ string) (map[string]string, error) {
 	return nil, nil
 }
 
-func (h HistoryPlugin) filterHistoryList(historyList []config.HistoryItem, query string) []config.HistoryItem {
+// filterHistoryList returns succeeded commands in a scope from the latest one, which are run in the same contexts of plugins.
+// Commands run in the current directory are first, and then ones in the current repository
+func (h HistoryPlugin) filterHistoryList(
+	historyList []config.HistoryItem,
+	query string,
+	location config.HistoryLocation,
+	scope config.HistoryScope,
+) []config.HistoryItem {
 	allContexts := map[string]map[string]string{}
 	for _, p := range h.plugins {
 		context, err := p.GetContext(query)
@@ -72,15 +78,34 @@ func (h HistoryPlugin) filterHistoryList(historyList []config.HistoryItem, query
 			continue
 		}
 	}
+	result = location.Rank(result, scope)
 	if len(result) == 0 {
 		return nil
 	}
-	sort.Slice(result, func(i, j int) bool {
-		return i > j
-	})
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
 	return result
 }
 
+// historyRows returns a header with a scope and rows of commands in the scope
+func (h HistoryPlugin) historyRows(
+	historyList []config.HistoryItem,
+	query string,
+	location config.HistoryLocation,
+	scope config.HistoryScope,
+) (string, []string) {
+	historyList = h.filterHistoryList(historyList, query, location, scope)
+	header := fmt.Sprintf("%-50s %20s", fmt.Sprintf("command (%s)", scope), "status")
+	rows := make([]string, 0, len(historyList))
+	for _, historyItem := range historyList {
+		rows = append(rows, fmt.Sprintf("%-50s %20d",
+			historyItem.Command,
+			historyItem.LastExitStatus))
+	}
+	return header, rows
+}
+
 func (h HistoryPlugin) Suggest(arg SuggestArg) ([]string, error) {
 	var query string
 	if len(arg.Args) > 0 {
@@ -88,20 +113,21 @@ func (h HistoryPlugin) Suggest(arg SuggestArg) ([]string, error) {
 		query = strings.Join(arg.Args, " ")
 	}
 
-	historyList := h.filterHistoryList(arg.History.Get(), query)
-	lines := make([]string, 0, len(historyList)+1)
-	lines = append(lines, fmt.Sprintf("%-50s %20s", "command", "status"))
-	for _, historyItem := range historyList {
-		lines = append(lines, fmt.Sprintf("%-50s %20d",
-			historyItem.Command,
-			historyItem.Status))
-	}
+	location := arg.History.Location()
+	scope := config.HistoryScopeGlobal
+	header, rows := h.historyRows(arg.History.Get(), query, location, scope)
 	// todo: show a preview like
 	//     item := s.history.list[index]
-	//     return fmt.Sprintf("status: %d\nRunning at: %s", item.Status, item.RunAt.Format(time.RFC3339))
-	result, err := h.completionUi.Complete(lines[1:], completion.CompleteOptions{
-		Header:       lines[0],
+	//     return fmt.Sprintf("status: %d\nRunning at: %s", item.LastExitStatus, item.LastSucceededAt.Format(time.RFC3339))
+	result, err := h.completionUi.Complete(rows, completion.CompleteOptions{
+		Header:       header,
 		InitialQuery: query,
+		// Ctrl-R switches commands in the current directory, the current repository and all of them
+		Toggling: func() (string, []string, error) {
+			scope = scope.Next()
+			header, rows := h.historyRows(arg.History.Get(), query, location, scope)
+			return header, rows, nil
+		},
 	})
 	if err != nil {
 		return []string{""}, err
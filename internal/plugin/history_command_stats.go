@@ -1,10 +1,12 @@
 package plugin
 
 import (
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/at-ishikawa/go-shell/internal/config"
+	"github.com/at-ishikawa/go-shell/internal/syntax"
 )
 
 type optionStats struct {
@@ -20,6 +22,21 @@ type commandStats struct {
 
 type HistoryCommandStats map[string]commandStats
 
+// Commands returns command names from the most frequently used one
+func (h HistoryCommandStats) Commands() []string {
+	commands := make([]string, 0, len(h))
+	for command := range h {
+		commands = append(commands, command)
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		if h[commands[i]].count != h[commands[j]].count {
+			return h[commands[i]].count > h[commands[j]].count
+		}
+		return commands[i] < commands[j]
+	})
+	return commands
+}
+
 func (h HistoryCommandStats) getSuggestedValues(args []string, currentToken string) []string {
 	if len(args) == 0 ||
 		len(args) == 1 && currentToken != "" {
@@ -140,10 +157,11 @@ func getSubCommandStats(result map[string]commandStats, args []string, currentAr
 	return result
 }
 
-func getHistoryCommandStats(historyList []config.HistoryItem) HistoryCommandStats {
+// NewHistoryCommandStats counts commands, their options and arguments in succeeded commands of a history
+func NewHistoryCommandStats(historyList []config.HistoryItem) HistoryCommandStats {
 	result := make(HistoryCommandStats)
 	for _, item := range historyList {
-		if item.Status != 0 {
+		if item.LastExitStatus != 0 {
 			continue
 		}
 
@@ -152,8 +170,17 @@ func getHistoryCommandStats(historyList []config.HistoryItem) HistoryCommandStat
 			continue
 		}
 
-		args := strings.Fields(item.Command)
-		result = getSubCommandStats(result, args, 0)
+		list, err := syntax.Parse(item.Command)
+		if err != nil {
+			continue
+		}
+		for _, command := range list.SimpleCommands() {
+			args := command.Fields()
+			if len(args) == 0 {
+				continue
+			}
+			result = getSubCommandStats(result, args, 0)
+		}
 	}
 	return result
 }
@@ -34,7 +34,7 @@ func Test_getCommandStats(t *testing.T) {
 				},
 				{
 					Command:         "failed command",
-					Status:          1,
+					LastExitStatus:  1,
 					LastSucceededAt: succeededTime,
 				},
 				{
@@ -93,6 +93,54 @@ func Test_getCommandStats(t *testing.T) {
 			},
 		},
 
+		{
+			name: "analyze each command in pipelines and lists",
+			historyList: []config.HistoryItem{
+				{
+					Command:         `git log -n 1 | grep "a b" && ls`,
+					LastSucceededAt: succeededTime,
+				},
+				{
+					Command:         `echo "unclosed`,
+					LastSucceededAt: succeededTime,
+				},
+			},
+			want: HistoryCommandStats{
+				"git": {
+					count:   1,
+					options: map[string]optionStats{},
+					args: map[string]commandStats{
+						"log": {
+							count: 1,
+							options: map[string]optionStats{
+								"-n": {
+									values: map[string]int{
+										"1": 1,
+									},
+								},
+							},
+							args: map[string]commandStats{},
+						},
+					},
+				},
+				"grep": {
+					count:   1,
+					options: map[string]optionStats{},
+					args: map[string]commandStats{
+						"a b": {
+							count:   1,
+							options: map[string]optionStats{},
+							args:    map[string]commandStats{},
+						},
+					},
+				},
+				"ls": {
+					count:   1,
+					options: map[string]optionStats{},
+					args:    map[string]commandStats{},
+				},
+			},
+		},
 		{
 			name: "no command history",
 			want: HistoryCommandStats{},
@@ -101,7 +149,7 @@ func Test_getCommandStats(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			assert.Equal(t, tc.want, getHistoryCommandStats(tc.historyList))
+			assert.Equal(t, tc.want, NewHistoryCommandStats(tc.historyList))
 		})
 	}
 }
@@ -353,3 +401,32 @@ func TestHistoryCommandStats_getSuggestedValues(t *testing.T) {
 		})
 	}
 }
+
+func TestHistoryCommandStats_Commands(t *testing.T) {
+	testCases := []struct {
+		name  string
+		stats HistoryCommandStats
+		want  []string
+	}{
+		{
+			name: "the most frequently used command first",
+			stats: HistoryCommandStats{
+				"ls":  {count: 1},
+				"git": {count: 3},
+				"cat": {count: 1},
+			},
+			want: []string{"git", "cat", "ls"},
+		},
+		{
+			name:  "no command",
+			stats: HistoryCommandStats{},
+			want:  []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.stats.Commands())
+		})
+	}
+}
@@ -1,12 +1,15 @@
 package plugin
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/at-ishikawa/go-shell/internal/completion"
 	"github.com/at-ishikawa/go-shell/internal/config"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
 )
 
 func TestHistoryPlugin_filterHistoryList(t *testing.T) {
@@ -18,6 +21,8 @@ func TestHistoryPlugin_filterHistoryList(t *testing.T) {
 		pluginFactory historyPluginFactory
 		historyList   []config.HistoryItem
 		query         string
+		location      config.HistoryLocation
+		scope         config.HistoryScope
 		want          []config.HistoryItem
 	}{
 		{
@@ -57,6 +62,53 @@ func TestHistoryPlugin_filterHistoryList(t *testing.T) {
 			},
 		},
 
+		{
+			name: "commands in the current directory and repository first",
+			pluginFactory: func(mockController *gomock.Controller) HistoryPlugin {
+				return HistoryPlugin{}
+			},
+			historyList: []config.HistoryItem{
+				{Command: "in the directory", LastSucceededAt: lastSucceededAt, Dirs: []string{"/home/user/repo"}},
+				{Command: "in the repository", LastSucceededAt: lastSucceededAt, Dirs: []string{"/home/user/repo/internal"}},
+				{Command: "in another directory", LastSucceededAt: lastSucceededAt, Dirs: []string{"/tmp"}},
+			},
+			location: config.HistoryLocation{Dir: "/home/user/repo", RepositoryDir: "/home/user/repo"},
+			scope:    config.HistoryScopeGlobal,
+			want: []config.HistoryItem{
+				{Command: "in the directory", LastSucceededAt: lastSucceededAt, Dirs: []string{"/home/user/repo"}},
+				{Command: "in the repository", LastSucceededAt: lastSucceededAt, Dirs: []string{"/home/user/repo/internal"}},
+				{Command: "in another directory", LastSucceededAt: lastSucceededAt, Dirs: []string{"/tmp"}},
+			},
+		},
+		{
+			name: "commands in the current repository",
+			pluginFactory: func(mockController *gomock.Controller) HistoryPlugin {
+				return HistoryPlugin{}
+			},
+			historyList: []config.HistoryItem{
+				{Command: "in the repository", LastSucceededAt: lastSucceededAt, Dirs: []string{"/home/user/repo/internal"}},
+				{Command: "in another directory", LastSucceededAt: lastSucceededAt, Dirs: []string{"/tmp"}},
+				{Command: "latest in the repository", LastSucceededAt: lastSucceededAt, Dirs: []string{"/home/user/repo"}},
+			},
+			location: config.HistoryLocation{Dir: "/home/user/repo/cmd", RepositoryDir: "/home/user/repo"},
+			scope:    config.HistoryScopeRepository,
+			want: []config.HistoryItem{
+				{Command: "latest in the repository", LastSucceededAt: lastSucceededAt, Dirs: []string{"/home/user/repo"}},
+				{Command: "in the repository", LastSucceededAt: lastSucceededAt, Dirs: []string{"/home/user/repo/internal"}},
+			},
+		},
+		{
+			name: "no command in the current directory",
+			pluginFactory: func(mockController *gomock.Controller) HistoryPlugin {
+				return HistoryPlugin{}
+			},
+			historyList: []config.HistoryItem{
+				{Command: "in another directory", LastSucceededAt: lastSucceededAt, Dirs: []string{"/tmp"}},
+			},
+			location: config.HistoryLocation{Dir: "/home/user"},
+			scope:    config.HistoryScopeDirectory,
+		},
+
 		{
 			name: "no command",
 			pluginFactory: func(mockController *gomock.Controller) HistoryPlugin {
@@ -85,7 +137,38 @@ func TestHistoryPlugin_filterHistoryList(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			mockController := gomock.NewController(t)
 			hp := tc.pluginFactory(mockController)
-			assert.Equal(t, tc.want, hp.filterHistoryList(tc.historyList, "query"))
+			assert.Equal(t, tc.want, hp.filterHistoryList(tc.historyList, "query", tc.location, tc.scope))
 		})
 	}
 }
+
+func TestHistoryPlugin_Suggest(t *testing.T) {
+	history := &config.History{}
+	history.Add("make test", 0, nil, time.Now())
+	history.SetLocation(config.HistoryLocation{Dir: "/home/user/repo"})
+
+	mockController := gomock.NewController(t)
+	mockCompletion := completion.NewMockCompletion(mockController)
+	mockCompletion.EXPECT().
+		Complete(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(rows []string, options completion.CompleteOptions) (string, error) {
+			assert.Equal(t, []string{fmt.Sprintf("%-50s %20d", "make test", 0)}, rows)
+			assert.Equal(t, fmt.Sprintf("%-50s %20s", "command (global)", "status"), options.Header)
+
+			// Ctrl-R switches to commands in the current directory, and then ones in the current repository
+			header, rows, err := options.Toggling()
+			assert.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("%-50s %20s", "command (directory)", "status"), header)
+			assert.Empty(t, rows)
+			header, _, err = options.Toggling()
+			assert.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("%-50s %20s", "command (repository)", "status"), header)
+			return fmt.Sprintf("%-50s %20d", "make test", 0), nil
+		}).
+		Times(1)
+
+	hp := NewHistoryPlugin(nil, mockCompletion, zap.NewNop())
+	got, err := hp.Suggest(SuggestArg{History: history})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"make test"}, got)
+}
@@ -43,7 +43,7 @@ func (arg SuggestArg) Suggest(completionUi completion.Completion) ([]string, err
 }
 
 func (arg SuggestArg) GetSuggestedValues() ([]string, error) {
-	historyCommandStats := getHistoryCommandStats(arg.History.Get())
+	historyCommandStats := NewHistoryCommandStats(arg.History.Get())
 	return historyCommandStats.getSuggestedValues(arg.Args, arg.CurrentArgToken), nil
 }
 
@@ -0,0 +1,99 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/at-ishikawa/go-shell/internal/syntax"
+)
+
+// aliasFileName is the startup file for aliases in the config directory
+const aliasFileName = "aliases"
+
+// alias runs the alias command.
+// alias name=value defines an alias, alias name shows it, and alias without arguments shows all aliases
+func (cr *commandRunner) alias(args []string, stdout *os.File) error {
+	names := make([]string, 0, len(cr.aliases))
+	if len(args) == 0 {
+		for name := range cr.aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	var notFoundNames []string
+	for _, arg := range args {
+		name, value, hasValue := strings.Cut(arg, "=")
+		if hasValue {
+			if name == "" || strings.ContainsAny(name, " \t\n|&;()<>$`\\\"'/") {
+				return fmt.Errorf("alias: %s: invalid alias name", name)
+			}
+			cr.aliases[name] = value
+			continue
+		}
+		if _, ok := cr.aliases[name]; !ok {
+			notFoundNames = append(notFoundNames, name)
+			continue
+		}
+		names = append(names, name)
+	}
+
+	for _, name := range names {
+		if _, err := fmt.Fprintf(stdout, "alias %s=%s\n", name, quoteAliasValue(cr.aliases[name])); err != nil {
+			return fmt.Errorf("alias: %w", err)
+		}
+	}
+	if len(notFoundNames) > 0 {
+		return fmt.Errorf("alias: %s: not found", strings.Join(notFoundNames, ", "))
+	}
+	return nil
+}
+
+func quoteAliasValue(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// unalias runs the unalias command. unalias -a removes all aliases
+func (cr *commandRunner) unalias(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("unalias: usage: unalias [-a] name [name ...]")
+	}
+	if args[0] == "-a" {
+		for name := range cr.aliases {
+			delete(cr.aliases, name)
+		}
+		return nil
+	}
+
+	for _, name := range args {
+		if _, ok := cr.aliases[name]; !ok {
+			return fmt.Errorf("unalias: %s: not found", name)
+		}
+		delete(cr.aliases, name)
+	}
+	return nil
+}
+
+// expandAlias replaces the command name in arguments with its alias
+func expandAlias(aliases map[string]string, args []string) []string {
+	if len(args) == 0 {
+		return args
+	}
+	value, ok := aliases[args[0]]
+	if !ok {
+		return args
+	}
+
+	// Only words before an operator are used like a command in a pipeline
+	tokens, _ := syntax.Tokenize(value)
+	var result []string
+	for _, token := range tokens {
+		if token.Type != syntax.WordToken {
+			break
+		}
+		result = append(result, token.Word.Unquoted())
+	}
+	return append(result, args[1:]...)
+}
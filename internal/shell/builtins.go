@@ -0,0 +1,652 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/at-ishikawa/go-shell/internal/syntax"
+)
+
+// builtin is a command which runs in the shell process.
+// stdioFiles are stdin, stdout and stderr after redirections are applied
+type builtin interface {
+	run(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error)
+}
+
+type builtinFunc func(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error)
+
+func (f builtinFunc) run(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	return f(cr, args, stdioFiles)
+}
+
+// builtins are builtin commands by their names
+var builtins map[string]builtin
+
+func init() {
+	builtins = map[string]builtin{
+		".":        builtinFunc(runSource),
+		":":        builtinFunc(runTrue),
+		"alias":    builtinFunc(runAlias),
+		"bg":       builtinFunc(runBackgroundJob),
+		"break":    builtinFunc(runLoopControl("break")),
+		"cd":       builtinFunc(runChangeDir),
+		"continue": builtinFunc(runLoopControl("continue")),
+		"dirs":     builtinFunc(runDirs),
+		"echo":     builtinFunc(runEcho),
+		"exit":     builtinFunc(runExit),
+		"export":   builtinFunc(runExport),
+		"false":    builtinFunc(runFalse),
+		"fg":       builtinFunc(runForegroundJob),
+		"history":  builtinFunc(runHistory),
+		"jobs":     builtinFunc(runJobs),
+		"popd":     builtinFunc(runPopDir),
+		"pushd":    builtinFunc(runPushDir),
+		"pwd":      builtinFunc(runPwd),
+		"read":     builtinFunc(runRead),
+		"return":   builtinFunc(runReturn),
+		"shopt":    builtinFunc(runShopt),
+		"source":   builtinFunc(runSource),
+		"true":     builtinFunc(runTrue),
+		"type":     builtinFunc(runType),
+		"unalias":  builtinFunc(runUnalias),
+		"unset":    builtinFunc(runUnset),
+		"wait":     builtinFunc(runWait),
+		"which":    builtinFunc(runWhich),
+		"z":        builtinFunc(runJumpDir),
+	}
+}
+
+// exitCodeOfError returns the exit status of a builtin which fails only with an error
+func exitCodeOfError(err error) (int, error) {
+	if err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+func runChangeDir(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	return exitCodeOfError(cr.changeDir(args, stdioFiles[1]))
+}
+
+func runPushDir(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	return exitCodeOfError(cr.pushDir(args, stdioFiles[1]))
+}
+
+func runPopDir(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	return exitCodeOfError(cr.popDir(args, stdioFiles[1]))
+}
+
+func runJumpDir(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	return exitCodeOfError(cr.jumpDir(args, stdioFiles[1]))
+}
+
+func runDirs(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	return exitCodeOfError(cr.listDirs(args, stdioFiles[1]))
+}
+
+func runExport(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	return exitCodeOfError(cr.export(args, stdioFiles[1]))
+}
+
+func runShopt(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	return exitCodeOfError(cr.options.shopt(args, stdioFiles[1]))
+}
+
+func runJobs(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	return exitCodeOfError(cr.listJobs(stdioFiles[1]))
+}
+
+func runBackgroundJob(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	return exitCodeOfError(cr.background(args, stdioFiles[1]))
+}
+
+func runForegroundJob(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	return cr.foreground(args, stdioFiles)
+}
+
+func runLoopControl(name string) builtinFunc {
+	return func(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+		return exitCodeOfError(cr.loopControl(name, args))
+	}
+}
+
+func runReturn(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	return cr.returnFunction(args)
+}
+
+func runSource(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	if len(args) == 0 {
+		return 2, errors.New("source: filename argument required")
+	}
+	return cr.sourceFile(args[0], args[1:], stdioFiles)
+}
+
+func runAlias(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	return exitCodeOfError(cr.alias(args, stdioFiles[1]))
+}
+
+func runUnalias(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	return exitCodeOfError(cr.unalias(args))
+}
+
+func runTrue(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	return 0, nil
+}
+
+func runFalse(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	return 1, nil
+}
+
+func runPwd(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	currentDir, err := cr.currentDir()
+	if err != nil {
+		return 1, fmt.Errorf("pwd: %w", err)
+	}
+	if _, err := fmt.Fprintln(stdioFiles[1], currentDir); err != nil {
+		return 1, fmt.Errorf("pwd: %w", err)
+	}
+	return 0, nil
+}
+
+// runEcho writes arguments separated by spaces.
+// -n doesn't write a trailing newline, and -e interprets escapes like \n
+func runEcho(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	isNewline := true
+	isEscaped := false
+	for len(args) > 0 && isEchoOption(args[0]) {
+		for _, option := range args[0][1:] {
+			switch option {
+			case 'n':
+				isNewline = false
+			case 'e':
+				isEscaped = true
+			case 'E':
+				isEscaped = false
+			}
+		}
+		args = args[1:]
+	}
+
+	output := strings.Join(args, " ")
+	if isEscaped {
+		var isStopped bool
+		output, isStopped = interpretEchoEscapes(output)
+		if isStopped {
+			isNewline = false
+		}
+	}
+	if isNewline {
+		output += "\n"
+	}
+	if _, err := fmt.Fprint(stdioFiles[1], output); err != nil {
+		return 1, fmt.Errorf("echo: %w", err)
+	}
+	return 0, nil
+}
+
+func isEchoOption(arg string) bool {
+	if len(arg) < 2 || arg[0] != '-' {
+		return false
+	}
+	return strings.Trim(arg[1:], "neE") == ""
+}
+
+// interpretEchoEscapes replaces escapes of echo -e.
+// It returns true if \c stops the output
+func interpretEchoEscapes(str string) (string, bool) {
+	escapes := map[byte]string{
+		'\\': "\\",
+		'a':  "\a",
+		'b':  "\b",
+		'e':  "\x1b",
+		'f':  "\f",
+		'n':  "\n",
+		'r':  "\r",
+		't':  "\t",
+		'v':  "\v",
+	}
+	var result strings.Builder
+	for i := 0; i < len(str); i++ {
+		if str[i] != '\\' || i == len(str)-1 {
+			result.WriteByte(str[i])
+			continue
+		}
+		i++
+		if str[i] == 'c' {
+			return result.String(), true
+		}
+		if str[i] == '0' {
+			// \0nnn is a character of an octal number up to 3 digits
+			end := i + 1
+			for end < len(str) && end < i+4 && str[end] >= '0' && str[end] <= '7' {
+				end++
+			}
+			value, _ := strconv.ParseUint("0"+str[i+1:end], 8, 8)
+			result.WriteByte(byte(value))
+			i = end - 1
+			continue
+		}
+		if escape, ok := escapes[str[i]]; ok {
+			result.WriteString(escape)
+			continue
+		}
+		result.WriteByte('\\')
+		result.WriteByte(str[i])
+	}
+	return result.String(), false
+}
+
+// runExit exits the shell with an exit status, or $? by default
+func runExit(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	if len(args) > 1 {
+		return 1, errors.New("exit: too many arguments")
+	}
+	exitCode := cr.lastExitCode
+	var err error
+	if len(args) > 0 {
+		exitCode, err = strconv.Atoi(args[0])
+		if err != nil {
+			// The shell exits even with an invalid argument
+			exitCode = 2
+			err = fmt.Errorf("exit: %s: numeric argument required", args[0])
+		}
+		exitCode &= 0xff
+	}
+	cr.flow = flowControl{kind: flowExit, exitCode: exitCode}
+	return exitCode, err
+}
+
+// runUnset removes shell variables, or functions with -f
+func runUnset(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	isFunction := false
+	for len(args) > 0 && (args[0] == "-f" || args[0] == "-v") {
+		isFunction = args[0] == "-f"
+		args = args[1:]
+	}
+
+	exitCode := 0
+	for _, name := range args {
+		if isFunction {
+			delete(cr.functions, name)
+			continue
+		}
+		if !syntax.IsName(name) {
+			fmt.Fprintf(stdioFiles[2], "unset: `%s': not a valid identifier\n", name)
+			exitCode = 1
+			continue
+		}
+		delete(cr.variables, name)
+		if err := cr.unsetEnv(name); err != nil {
+			return 1, err
+		}
+	}
+	return exitCode, nil
+}
+
+type commandType string
+
+const (
+	commandTypeAlias    commandType = "alias"
+	commandTypeKeyword  commandType = "keyword"
+	commandTypeFunction commandType = "function"
+	commandTypeBuiltin  commandType = "builtin"
+	commandTypeFile     commandType = "file"
+)
+
+// lookupCommand returns how a command name is interpreted in the same order as the shell does,
+// and the path for an executable file
+func (cr *commandRunner) lookupCommand(name string) (commandType, string, bool) {
+	if _, ok := cr.aliases[name]; ok {
+		return commandTypeAlias, "", true
+	}
+	if syntax.IsReservedWord(name) {
+		return commandTypeKeyword, "", true
+	}
+	if _, ok := cr.functions[name]; ok {
+		return commandTypeFunction, "", true
+	}
+	if _, ok := builtins[name]; ok {
+		return commandTypeBuiltin, "", true
+	}
+	if path, err := cr.lookPath(name); err == nil {
+		return commandTypeFile, path, true
+	}
+	return "", "", false
+}
+
+// runType writes how each name is interpreted as a command.
+// -t writes only a type like builtin or file
+func runType(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	isTypeOnly := false
+	if len(args) > 0 && args[0] == "-t" {
+		isTypeOnly = true
+		args = args[1:]
+	}
+
+	exitCode := 0
+	for _, name := range args {
+		kind, path, ok := cr.lookupCommand(name)
+		if !ok {
+			if !isTypeOnly {
+				fmt.Fprintf(stdioFiles[2], "type: %s: not found\n", name)
+			}
+			exitCode = 1
+			continue
+		}
+		line := string(kind)
+		if !isTypeOnly {
+			switch kind {
+			case commandTypeAlias:
+				line = fmt.Sprintf("%s is aliased to `%s'", name, cr.aliases[name])
+			case commandTypeKeyword:
+				line = fmt.Sprintf("%s is a shell keyword", name)
+			case commandTypeFunction:
+				line = fmt.Sprintf("%s is a function", name)
+			case commandTypeBuiltin:
+				line = fmt.Sprintf("%s is a shell builtin", name)
+			case commandTypeFile:
+				line = fmt.Sprintf("%s is %s", name, path)
+			}
+		}
+		if _, err := fmt.Fprintln(stdioFiles[1], line); err != nil {
+			return 1, fmt.Errorf("type: %w", err)
+		}
+	}
+	return exitCode, nil
+}
+
+// runWhich writes the path of each command, or what it is if it isn't an executable file
+func runWhich(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	exitCode := 0
+	for _, name := range args {
+		kind, path, ok := cr.lookupCommand(name)
+		if !ok {
+			fmt.Fprintf(stdioFiles[2], "%s not found\n", name)
+			exitCode = 1
+			continue
+		}
+
+		var line string
+		switch kind {
+		case commandTypeAlias:
+			line = fmt.Sprintf("%s: aliased to %s", name, cr.aliases[name])
+		case commandTypeKeyword:
+			line = fmt.Sprintf("%s: shell reserved word", name)
+		case commandTypeFunction:
+			line = fmt.Sprintf("%s: shell function", name)
+		case commandTypeBuiltin:
+			line = fmt.Sprintf("%s: shell built-in command", name)
+		case commandTypeFile:
+			line = path
+		}
+		if _, err := fmt.Fprintln(stdioFiles[1], line); err != nil {
+			return 1, fmt.Errorf("which: %w", err)
+		}
+	}
+	return exitCode, nil
+}
+
+// runHistory writes commands in the history with their numbers, or only the last n commands.
+// -e writes executions instead
+func runHistory(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	if cr.history == nil {
+		// A shell without a terminal doesn't have a history
+		return 0, nil
+	}
+	if len(args) > 0 && args[0] == "-e" {
+		return runHistoryExecutions(cr, args[1:], stdioFiles)
+	}
+	items := cr.history.Get()
+	firstIndex := 0
+	if len(args) > 0 {
+		count, err := strconv.Atoi(args[0])
+		if err != nil || count < 0 {
+			return 1, fmt.Errorf("history: %s: numeric argument required", args[0])
+		}
+		if count < len(items) {
+			firstIndex = len(items) - count
+		}
+	}
+	for i := firstIndex; i < len(items); i++ {
+		if _, err := fmt.Fprintf(stdioFiles[1], "%5d  %s\n", i+1, items[i].Command); err != nil {
+			return 1, fmt.Errorf("history: %w", err)
+		}
+	}
+	return 0, nil
+}
+
+// runHistoryExecutions writes executions in a directory and its subdirectories, which is the current directory by default.
+// -s writes only executions in a duration like 7d or 2h
+func runHistoryExecutions(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	var since time.Time
+	if len(args) > 0 && args[0] == "-s" {
+		if len(args) < 2 {
+			return 2, errors.New("history: -s: option requires an argument")
+		}
+		duration, err := parseDays(args[1])
+		if err != nil {
+			return 1, fmt.Errorf("history: %s: invalid duration", args[1])
+		}
+		since = time.Now().Add(-duration)
+		args = args[2:]
+	}
+	var dir string
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	dir, err := filepath.Abs(cr.absPath(dir))
+	if err != nil {
+		return 1, fmt.Errorf("history: %w", err)
+	}
+
+	executions, err := cr.history.FindExecutions(dir, since)
+	if err != nil {
+		return 1, fmt.Errorf("history: %w", err)
+	}
+	for _, execution := range executions {
+		realTime := "-"
+		if execution.Time != nil {
+			realTime = execution.Time.Real.Round(time.Millisecond).String()
+		}
+		_, err := fmt.Fprintf(stdioFiles[1], "%s  %3d  %8s  %s  %s\n",
+			execution.StartedAt.Format("2006-01-02 15:04:05"),
+			execution.ExitStatus,
+			realTime,
+			execution.Dir,
+			execution.Command,
+		)
+		if err != nil {
+			return 1, fmt.Errorf("history: %w", err)
+		}
+	}
+	return 0, nil
+}
+
+// parseDays parses a duration which may have days like 7d
+func parseDays(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		count, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || count < 0 {
+			return 0, fmt.Errorf("invalid days: %s", value)
+		}
+		return time.Duration(count) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// runRead reads a line from the stdin and assigns fields split by IFS to variables.
+// The last variable gets the rest of the line, and REPLY gets the line without variables.
+// -r doesn't treat a backslash as an escape, and -p writes a prompt
+func runRead(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	isRaw := false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "-r":
+			isRaw = true
+		case "-p":
+			if len(args) < 2 {
+				return 2, errors.New("read: -p: option requires an argument")
+			}
+			fmt.Fprint(stdioFiles[2], args[1])
+			args = args[1:]
+		default:
+			return 2, fmt.Errorf("read: %s: invalid option", args[0])
+		}
+		args = args[1:]
+	}
+	names := args
+	if len(names) == 0 {
+		names = []string{"REPLY"}
+	}
+	for _, name := range names {
+		if !syntax.IsName(name) {
+			return 1, fmt.Errorf("read: `%s': not a valid identifier", name)
+		}
+	}
+
+	line, isEOF, err := readLine(stdioFiles[0], isRaw)
+	if err != nil {
+		return 1, fmt.Errorf("read: %w", err)
+	}
+
+	ifs, ok := cr.getVariable("IFS")
+	if !ok {
+		ifs = " \t\n"
+	}
+	isSeparator := func(r rune) bool {
+		return strings.ContainsRune(ifs, r)
+	}
+	if len(args) == 0 {
+		// REPLY keeps the line as it is
+		isSeparator = func(r rune) bool {
+			return false
+		}
+	}
+	for i, name := range names {
+		line = strings.TrimLeftFunc(line, isSeparator)
+		value := line
+		if i < len(names)-1 {
+			if end := strings.IndexFunc(line, isSeparator); end >= 0 {
+				value = line[:end]
+				line = line[end:]
+			} else {
+				line = ""
+			}
+		} else {
+			value = strings.TrimRightFunc(value, isSeparator)
+		}
+		if err := cr.setVariable(name, value); err != nil {
+			return 1, err
+		}
+	}
+	if isEOF {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// readLine reads a line byte by byte so that the rest of the input is left for following commands.
+// It returns true if it reaches EOF before a newline
+func readLine(file *os.File, isRaw bool) (string, bool, error) {
+	var line strings.Builder
+	buffer := make([]byte, 1)
+	isEscaped := false
+	for {
+		n, err := file.Read(buffer)
+		if errors.Is(err, io.EOF) || n == 0 {
+			return line.String(), true, nil
+		}
+		if err != nil {
+			return line.String(), true, err
+		}
+
+		c := buffer[0]
+		if isEscaped {
+			isEscaped = false
+			// A backslash and a newline continue a line
+			if c != '\n' {
+				line.WriteByte(c)
+			}
+			continue
+		}
+		if c == '\\' && !isRaw {
+			isEscaped = true
+			continue
+		}
+		if c == '\n' {
+			return line.String(), false, nil
+		}
+		line.WriteByte(c)
+	}
+}
+
+// runWait waits for background jobs given by job specs or process IDs, or all of them without arguments.
+// The exit status is the one of the last job
+func runWait(cr *commandRunner, args []string, stdioFiles [3]*os.File) (int, error) {
+	if len(args) == 0 {
+		for _, j := range append([]*job{}, cr.jobs...) {
+			if err := cr.waitBackgroundJob(j); err != nil {
+				return 1, err
+			}
+		}
+		return 0, nil
+	}
+
+	exitCode := 0
+	for _, arg := range args {
+		j, err := cr.findWaitedJob(arg)
+		if err != nil {
+			fmt.Fprintln(stdioFiles[2], err)
+			exitCode = 127
+			continue
+		}
+		if err := cr.waitBackgroundJob(j); err != nil {
+			return 1, err
+		}
+		exitCode = exitCodeOf(j.exitStatus(cr.isPipefail))
+	}
+	return exitCode, nil
+}
+
+func (cr *commandRunner) findWaitedJob(arg string) (*job, error) {
+	if strings.HasPrefix(arg, "%") {
+		return cr.findJob([]string{arg})
+	}
+	pid, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, fmt.Errorf("wait: `%s': not a pid or valid job spec", arg)
+	}
+	for _, j := range cr.jobs {
+		for _, p := range j.processes {
+			if p.pid == pid {
+				return j, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("wait: pid %d is not a child of this shell", pid)
+}
+
+// waitBackgroundJob waits until a job exits or stops, and removes it if it exited
+func (cr *commandRunner) waitBackgroundJob(j *job) error {
+	if err := waitJob(j, false); err != nil {
+		return err
+	}
+	cr.addCPUTime(j)
+	if j.state() == jobDone {
+		cr.removeJob(j)
+	}
+	return nil
+}
+
+// exitedStatus returns the wait status of a process which exited with an exit status,
+// which is used for a builtin or a function in a pipeline
+func exitedStatus(exitCode int) syscall.WaitStatus {
+	return syscall.WaitStatus((exitCode & 0xff) << 8)
+}
@@ -0,0 +1,390 @@
+package shell
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/at-ishikawa/go-shell/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestBuiltins(t *testing.T) {
+	testCases := []struct {
+		name         string
+		inputCommand string
+		stdin        string
+
+		wantOutput      string
+		wantErrorOutput string
+		wantExitCode    int
+		wantErr         bool
+	}{
+		{
+			name:         "echo with options",
+			inputCommand: `echo -n a b; echo -e 'c\td\c' e; echo -E '\n' -n; echo -x`,
+			wantOutput:   "a bc\td\\n -n\n-x\n",
+		},
+		{
+			name:         "pwd",
+			inputCommand: `cd /; pwd`,
+			wantOutput:   "/\n",
+		},
+		{
+			name:         "cd - changes to the previous directory",
+			inputCommand: `cd /usr; cd /; cd -; pwd; echo ~- ~+`,
+			wantOutput:   "/usr\n/usr\n/ /usr\n",
+		},
+		{
+			name:         "cd - without a previous directory",
+			inputCommand: `unset OLDPWD; cd -`,
+			wantExitCode: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "pushd, popd and dirs",
+			inputCommand: `cd /; pushd /usr; pushd /usr/bin; dirs -v; pushd; pushd +2; popd; popd +1; dirs`,
+			wantOutput:   "/usr /\n/usr/bin /usr /\n 0  /usr/bin\n 1  /usr\n 2  /\n/usr /usr/bin /\n/ /usr /usr/bin\n/usr /usr/bin\n/usr\n/usr\n",
+		},
+		{
+			name:         "directories in the stack by a tilde prefix",
+			inputCommand: `cd /usr; pushd / >/dev/null; echo ~1 ~-0 ~0; cd ~1; pwd`,
+			wantOutput:   "/usr /usr /\n/usr\n",
+		},
+		{
+			name:         "popd with an empty stack",
+			inputCommand: `dirs -c; popd`,
+			wantExitCode: 1,
+			wantErr:      true,
+		},
+		{
+			name:            "pushd with an index out of range",
+			inputCommand:    `dirs -c; pushd +1; pushd -1; echo $?`,
+			wantOutput:      "1\n",
+			wantErrorOutput: "pushd: +1: directory stack index out of range\npushd: -1: directory stack index out of range\n",
+		},
+		{
+			name:         "true and false",
+			inputCommand: `true && echo a; false || echo b; false`,
+			wantOutput:   "a\nb\n",
+			wantExitCode: 1,
+		},
+		{
+			name:            "unset variables and functions",
+			inputCommand:    `A=a; export B=b; f() { echo f; }; unset A B 1a; unset -f f; echo "[$A][$B]"; type f`,
+			wantOutput:      "[][]\n",
+			wantErrorOutput: "unset: `1a': not a valid identifier\ntype: f: not found\n",
+			wantExitCode:    1,
+		},
+		{
+			name:         "type",
+			inputCommand: `alias ll='ls -l'; f() { :; }; PATH=/bin type ll if f cd sh; type -t ll if f cd sh`,
+			wantOutput:   "ll is aliased to `ls -l'\nif is a shell keyword\nf is a function\ncd is a shell builtin\nsh is /bin/sh\nalias\nkeyword\nfunction\nbuiltin\nfile\n",
+		},
+		{
+			name:            "which",
+			inputCommand:    `alias ll='ls -l'; f() { :; }; PATH=/bin which ll f echo sh unknown-command`,
+			wantOutput:      "ll: aliased to ls -l\nf: shell function\necho: shell built-in command\n/bin/sh\n",
+			wantErrorOutput: "unknown-command not found\n",
+			wantExitCode:    1,
+		},
+		{
+			name:         "read fields into variables",
+			inputCommand: `read a b; echo "[$a][$b]"; read -r c; echo "[$c]"; read; echo "[$REPLY]"; read d; echo $? "[$d]"`,
+			stdin:        "  x  y \\\n z  \na\\b\n  reply  \n",
+			wantOutput:   "[x][y  z]\n[a\\b]\n[  reply  ]\n1 []\n",
+		},
+		{
+			name:         "read the last line without a newline",
+			inputCommand: `read a; echo $? $a`,
+			stdin:        "last",
+			wantOutput:   "1 last\n",
+		},
+		{
+			name:         "exit with a status",
+			inputCommand: `for a in 1 2; do f() { exit 3; }; f; done; echo unreachable`,
+			wantExitCode: 3,
+		},
+		{
+			name:         "exit with the last status",
+			inputCommand: `false; exit`,
+			wantExitCode: 1,
+		},
+		{
+			name:         "exit in a subshell",
+			inputCommand: `(exit 4); echo $?`,
+			wantOutput:   "4\n",
+		},
+		{
+			name:         "exit with too many arguments",
+			inputCommand: `exit 1 2; echo continued`,
+			wantOutput:   "continued\n",
+		},
+		{
+			name:         "wait for background jobs",
+			inputCommand: `sh -c 'exit 5' & wait %1; echo $?; sh -c 'sleep 0.1; echo a' & wait; echo b`,
+			wantOutput:   "5\na\nb\n",
+		},
+		{
+			name:            "wait for a process which isn't a child",
+			inputCommand:    `wait 1`,
+			wantErrorOutput: "wait: pid 1 is not a child of this shell\n",
+			wantExitCode:    127,
+		},
+		{
+			name:            "builtins with redirections",
+			inputCommand:    `echo a >&2; pwd 1>&2 >/dev/null`,
+			wantErrorOutput: "a\n",
+		},
+		{
+			name:         "builtins in a pipeline",
+			inputCommand: `echo a b | tr a-z A-Z; printf 'x\ny\n' | read a; echo "[$a]"`,
+			wantOutput:   "A B\n[]\n",
+		},
+		{
+			name:         "functions in a pipeline",
+			inputCommand: `upper() { tr a-z A-Z; }; f() { read a b; echo $b $a; }; echo a b | f | upper | cat`,
+			wantOutput:   "B A\n",
+		},
+		{
+			name:         "compound commands in a pipeline",
+			inputCommand: `printf 'a\nb\n' | while read line; do echo "<$line>"; done | { read first; echo $first; cat; } | tr a-z A-Z; echo "[$line]"`,
+			wantOutput:   "<A>\n<B>\n[]\n",
+		},
+		{
+			name:         "subshells in a pipeline",
+			inputCommand: `cd /; (echo a; echo b) | (cd /usr; read x; echo $x $(pwd)) | if true; then cat; fi; for i in 1 2; do echo $i; done | cat; pwd`,
+			wantOutput:   "a /usr\n1\n2\n/\n",
+		},
+		{
+			name:         "the exit status of a pipeline with compound commands",
+			inputCommand: `true | { false; }; echo $?; ( exit 3 ) | cat; echo $?; echo a | ( exit 4 ); echo $?`,
+			wantOutput:   "1\n0\n4\n",
+		},
+		{
+			name:         "cd in a pipeline doesn't change the directory of the shell",
+			inputCommand: `cd /; cd /usr | cat; pwd; echo $PWD`,
+			wantOutput:   "/\n/\n",
+		},
+		{
+			name:         "export in a pipeline doesn't change environment variables of the shell",
+			inputCommand: `export GO_SHELL_TEST_PIPELINE=1 | cat; echo "[$GO_SHELL_TEST_PIPELINE]"; env | grep GO_SHELL_TEST_PIPELINE || echo none`,
+			wantOutput:   "[]\nnone\n",
+		},
+		{
+			name:         "assignments in a pipeline don't change variables of the shell",
+			inputCommand: `echo a | x=2; echo "$? [$x]"; x=3 > /dev/null | cat; echo "$? [$x]"`,
+			wantOutput:   "0 []\n0 []\n",
+		},
+		{
+			name:         "commands in a pipeline use the directory and environment variables of the stage",
+			inputCommand: `cd /; f() { cd /usr; export GO_SHELL_TEST_PIPELINE=1; pwd; ls -d bin; echo loca[l]; env | grep GO_SHELL_TEST_PIPELINE; true < share && echo redirected; }; f | cat; pwd`,
+			wantOutput:   "/usr\nbin\nlocal\nGO_SHELL_TEST_PIPELINE=1\nredirected\n/\n",
+		},
+		{
+			name:         "the exit status of a pipeline with builtins",
+			inputCommand: `echo a | false; echo $?; false | echo b; echo $?`,
+			wantOutput:   "1\nb\n0\n",
+		},
+		{
+			name:            "a command which isn't found",
+			inputCommand:    `unknown-command-xyz a; echo $?`,
+			wantOutput:      "127\n",
+			wantErrorOutput: "unknown-command-xyz: command not found\n",
+		},
+		{
+			name:            "a path which doesn't exist",
+			inputCommand:    `./unknown-command-xyz; echo $?`,
+			wantOutput:      "127\n",
+			wantErrorOutput: "fork/exec ./unknown-command-xyz: no such file or directory\n",
+		},
+		{
+			name:            "a file which isn't executable",
+			inputCommand:    `/etc/passwd; echo $?`,
+			wantOutput:      "126\n",
+			wantErrorOutput: "fork/exec /etc/passwd: permission denied\n",
+		},
+		{
+			name:         "builtins in the background",
+			inputCommand: `echo a &`,
+			wantExitCode: 1,
+			wantErr:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			in, err := os.CreateTemp("", "input")
+			require.NoError(t, err)
+			defer os.Remove(in.Name())
+			defer in.Close()
+			_, err = in.WriteString(tc.stdin)
+			require.NoError(t, err)
+			_, err = in.Seek(0, 0)
+			require.NoError(t, err)
+
+			out, err := os.CreateTemp("", "output")
+			require.NoError(t, err)
+			defer os.Remove(out.Name())
+			defer out.Close()
+			errorOut, err := os.CreateTemp("", "error")
+			require.NoError(t, err)
+			defer os.Remove(errorOut.Name())
+			defer errorOut.Close()
+
+			currentDir, err := os.Getwd()
+			require.NoError(t, err)
+			defer os.Chdir(currentDir)
+
+			cr := newCommandRunner("/home/user", false)
+			gotExitCode, gotErr := cr.runInput(tc.inputCommand, [3]*os.File{in, out, errorOut})
+			assert.Equal(t, tc.wantExitCode, gotExitCode)
+			assert.Equal(t, tc.wantErr, gotErr != nil)
+
+			gotOutput, err := os.ReadFile(out.Name())
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantOutput, string(gotOutput))
+			if tc.wantErrorOutput != "" {
+				gotErrorOutput, err := os.ReadFile(errorOut.Name())
+				require.NoError(t, err)
+				assert.Equal(t, tc.wantErrorOutput, string(gotErrorOutput))
+			}
+		})
+	}
+}
+
+func TestRunHistory(t *testing.T) {
+	history := &config.History{}
+	for _, command := range []string{"echo a", "ls", "pwd"} {
+		history.Add(command, 0, nil, time.Time{})
+	}
+
+	testCases := []struct {
+		name    string
+		history *config.History
+		args    []string
+
+		wantOutput   string
+		wantExitCode int
+		wantErr      bool
+	}{
+		{
+			name:       "all commands",
+			history:    history,
+			wantOutput: "    1  echo a\n    2  ls\n    3  pwd\n",
+		},
+		{
+			name:       "the last commands",
+			history:    history,
+			args:       []string{"2"},
+			wantOutput: "    2  ls\n    3  pwd\n",
+		},
+		{
+			name:         "an invalid number",
+			history:      history,
+			args:         []string{"a"},
+			wantExitCode: 1,
+			wantErr:      true,
+		},
+		{
+			name: "no history without a terminal",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := os.CreateTemp("", "output")
+			require.NoError(t, err)
+			defer os.Remove(out.Name())
+			defer out.Close()
+
+			cr := newCommandRunner("/home/user", false)
+			cr.history = tc.history
+			gotExitCode, gotErr := runHistory(cr, tc.args, [3]*os.File{os.Stdin, out, os.Stderr})
+			assert.Equal(t, tc.wantExitCode, gotExitCode)
+			assert.Equal(t, tc.wantErr, gotErr != nil)
+
+			gotOutput, err := os.ReadFile(out.Name())
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantOutput, string(gotOutput))
+		})
+	}
+}
+
+func TestRunHistory_Executions(t *testing.T) {
+	c, err := config.NewConfig(t.TempDir())
+	require.NoError(t, err)
+	history := config.NewHistory(c)
+	require.NoError(t, history.LoadFile())
+	now := time.Now()
+	executions := []config.Execution{
+		{Command: "make", Dir: "/home/user/repo", StartedAt: now.Add(-10 * 24 * time.Hour)},
+		{Command: "go test ./...", Dir: "/home/user/repo/internal", StartedAt: now.Add(-time.Hour), Time: &config.ExecutionTime{Real: 1500 * time.Millisecond}, ExitStatus: 1},
+		{Command: "ls", Dir: "/home/user", StartedAt: now},
+	}
+	for _, execution := range executions {
+		<-history.Sync(execution, zap.NewNop())
+	}
+	formatTime := func(t time.Time) string {
+		return t.Format("2006-01-02 15:04:05")
+	}
+
+	testCases := []struct {
+		name string
+		args []string
+
+		wantOutput   string
+		wantExitCode int
+		wantErr      bool
+	}{
+		{
+			name: "executions in a directory",
+			args: []string{"-e", "/home/user/repo"},
+			wantOutput: formatTime(executions[0].StartedAt) + "    0         -  /home/user/repo  make\n" +
+				formatTime(executions[1].StartedAt) + "    1      1.5s  /home/user/repo/internal  go test ./...\n",
+		},
+		{
+			name:       "executions in days",
+			args:       []string{"-e", "-s", "7d", "/home/user/repo"},
+			wantOutput: formatTime(executions[1].StartedAt) + "    1      1.5s  /home/user/repo/internal  go test ./...\n",
+		},
+		{
+			name:       "executions in a duration",
+			args:       []string{"-e", "-s", "30m", "/"},
+			wantOutput: formatTime(executions[2].StartedAt) + "    0         -  /home/user  ls\n",
+		},
+		{
+			name:         "an invalid duration",
+			args:         []string{"-e", "-s", "a"},
+			wantExitCode: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "no duration",
+			args:         []string{"-e", "-s"},
+			wantExitCode: 2,
+			wantErr:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := os.CreateTemp("", "output")
+			require.NoError(t, err)
+			defer os.Remove(out.Name())
+			defer out.Close()
+
+			cr := newCommandRunner("/home/user", false)
+			cr.history = &history
+			gotExitCode, gotErr := runHistory(cr, tc.args, [3]*os.File{os.Stdin, out, os.Stderr})
+			assert.Equal(t, tc.wantExitCode, gotExitCode)
+			assert.Equal(t, tc.wantErr, gotErr != nil)
+
+			gotOutput, err := os.ReadFile(out.Name())
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantOutput, string(gotOutput))
+		})
+	}
+}
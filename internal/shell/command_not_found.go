@@ -0,0 +1,167 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/at-ishikawa/go-shell/internal/plugin"
+)
+
+// maxSuggestedCommands is the number of similar commands shown for a command which isn't found
+const maxSuggestedCommands = 3
+
+// commandNotFoundError is returned when a command isn't found, with similar command names
+type commandNotFoundError struct {
+	name        string
+	suggestions []string
+}
+
+func (e *commandNotFoundError) Error() string {
+	message := fmt.Sprintf("%s: command not found", e.name)
+	if len(e.suggestions) > 0 {
+		// A single line because an error is written while the terminal is in raw mode
+		message += fmt.Sprintf(". Did you mean: %s?", strings.Join(e.suggestions, ", "))
+	}
+	return message
+}
+
+// handleCommandNotFound returns a command which the shell should run instead of a command which isn't found.
+// With the correct option in a terminal, it asks whether the most similar command runs instead.
+// Otherwise, or if a user declines it, commandNotFoundError is returned
+func (cr *commandRunner) handleCommandNotFound(command pipelineCommand, stdioFiles [3]*os.File) (pipelineCommand, error) {
+	suggestions := cr.suggestCommands(command.command)
+	notFoundErr := &commandNotFoundError{name: command.command, suggestions: suggestions}
+	if !cr.options.isCorrect || cr.ttyFd < 0 || len(suggestions) == 0 {
+		return command, notFoundErr
+	}
+
+	fmt.Fprintf(stdioFiles[2], "correct '%s' to '%s' [y/N]? ", command.command, suggestions[0])
+	answer, _, err := readLine(stdioFiles[0], true)
+	if err != nil {
+		return command, err
+	}
+	if answer != "y" && answer != "Y" {
+		return command, &commandNotFoundError{name: command.command}
+	}
+
+	args := expandAlias(cr.aliases, append([]string{suggestions[0]}, command.args...))
+	command.command = args[0]
+	command.args = args[1:]
+	return command, nil
+}
+
+// suggestCommands returns commands similar to a name by an edit distance, from the most similar one.
+// Commands are the ones in a history, builtins, aliases and executable files in $PATH
+func (cr *commandRunner) suggestCommands(name string) []string {
+	var candidates []string
+	if cr.history != nil {
+		// Frequently used commands are prior to others with the same distance
+		candidates = append(candidates, plugin.NewHistoryCommandStats(cr.history.Get()).Commands()...)
+	}
+	var names []string
+	for builtinName := range builtins {
+		names = append(names, builtinName)
+	}
+	for aliasName := range cr.aliases {
+		names = append(names, aliasName)
+	}
+	for functionName := range cr.functions {
+		names = append(names, functionName)
+	}
+	sort.Strings(names)
+	candidates = append(candidates, names...)
+	pathEnv, _ := cr.lookupEnv("PATH")
+	candidates = append(candidates, executablesInPath(pathEnv)...)
+
+	// A name which differs in all letters isn't similar, like any single letter for another one
+	maxDistance := minInt(len(name)/4+1, len(name)-1)
+	type suggestion struct {
+		name     string
+		distance int
+		order    int
+	}
+	var suggestions []suggestion
+	seen := make(map[string]bool, len(candidates))
+	for i, candidate := range candidates {
+		if seen[candidate] || candidate == name {
+			continue
+		}
+		seen[candidate] = true
+		if distance := editDistance(name, candidate); distance <= maxDistance {
+			suggestions = append(suggestions, suggestion{name: candidate, distance: distance, order: i})
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].distance != suggestions[j].distance {
+			return suggestions[i].distance < suggestions[j].distance
+		}
+		return suggestions[i].order < suggestions[j].order
+	})
+
+	var result []string
+	for i := 0; i < len(suggestions) && i < maxSuggestedCommands; i++ {
+		result = append(result, suggestions[i].name)
+	}
+	return result
+}
+
+// executablesInPath returns names of executable files in directories of $PATH
+func executablesInPath(pathEnv string) []string {
+	var names []string
+	for _, dir := range filepath.SplitList(pathEnv) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil || info.IsDir() || info.Mode().Perm()&0111 == 0 {
+				continue
+			}
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// editDistance returns the number of insertions, deletions, substitutions
+// and transpositions of adjacent characters to change a string to another
+func editDistance(a, b string) int {
+	distances := make([][]int, len(a)+1)
+	for i := range distances {
+		distances[i] = make([]int, len(b)+1)
+		distances[i][0] = i
+	}
+	for j := range distances[0] {
+		distances[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			distance := minInt(distances[i-1][j]+1, distances[i][j-1]+1, distances[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				distance = minInt(distance, distances[i-2][j-2]+1)
+			}
+			distances[i][j] = distance
+		}
+	}
+	return distances[len(a)][len(b)]
+}
+
+func minInt(values ...int) int {
+	result := values[0]
+	for _, value := range values[1:] {
+		if value < result {
+			result = value
+		}
+	}
+	return result
+}
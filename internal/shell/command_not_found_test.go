@@ -0,0 +1,155 @@
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/at-ishikawa/go-shell/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditDistance(t *testing.T) {
+	testCases := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{a: "git", b: "git", want: 0},
+		{a: "gti", b: "git", want: 1},
+		{a: "gt", b: "git", want: 1},
+		{a: "gitt", b: "git", want: 1},
+		{a: "kubectl", b: "kubcetl", want: 1},
+		{a: "ls", b: "cat", want: 3},
+		{a: "", b: "ls", want: 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			assert.Equal(t, tc.want, editDistance(tc.a, tc.b))
+		})
+	}
+}
+
+func TestCommandRunner_handleCommandNotFound(t *testing.T) {
+	pathDir := t.TempDir()
+	for _, name := range []string{"gist", "git", "gi.txt"} {
+		perm := os.FileMode(0755)
+		if name == "gi.txt" {
+			perm = 0644
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(pathDir, name), nil, perm))
+	}
+	t.Setenv("PATH", pathDir)
+
+	history := &config.History{}
+	for _, command := range []string{"gh pr list", "gh pr view", "gt status"} {
+		history.Add(command, 0, nil, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	}
+
+	testCases := []struct {
+		name      string
+		command   pipelineCommand
+		isCorrect bool
+		isTty     bool
+		stdin     string
+
+		want       pipelineCommand
+		wantErr    string
+		wantPrompt string
+	}{
+		{
+			name:    "suggest similar commands",
+			command: pipelineCommand{command: "gti"},
+			want:    pipelineCommand{command: "gti"},
+			wantErr: "gti: command not found. Did you mean: gt, git?",
+		},
+		{
+			name:    "no similar command",
+			command: pipelineCommand{command: "kubectl"},
+			want:    pipelineCommand{command: "kubectl"},
+			wantErr: "kubectl: command not found",
+		},
+		{
+			name:    "no similar command for a single letter",
+			command: pipelineCommand{command: "k"},
+			want:    pipelineCommand{command: "k"},
+			wantErr: "k: command not found",
+		},
+		{
+			name:      "run the corrected command",
+			command:   pipelineCommand{command: "ehco", args: []string{"a"}},
+			isCorrect: true,
+			isTty:     true,
+			stdin:     "y\n",
+
+			want:       pipelineCommand{command: "echo", args: []string{"a"}},
+			wantPrompt: "correct 'ehco' to 'echo' [y/N]? ",
+		},
+		{
+			name:      "run the corrected alias",
+			command:   pipelineCommand{command: "gcoo", args: []string{"main"}},
+			isCorrect: true,
+			isTty:     true,
+			stdin:     "Y\n",
+
+			want:       pipelineCommand{command: "git", args: []string{"checkout", "main"}},
+			wantPrompt: "correct 'gcoo' to 'gco' [y/N]? ",
+		},
+		{
+			name:      "decline the corrected command",
+			command:   pipelineCommand{command: "ehco"},
+			isCorrect: true,
+			isTty:     true,
+			stdin:     "\n",
+
+			want:       pipelineCommand{command: "ehco"},
+			wantErr:    "ehco: command not found",
+			wantPrompt: "correct 'ehco' to 'echo' [y/N]? ",
+		},
+		{
+			name:      "no prompt without a terminal",
+			command:   pipelineCommand{command: "ehco"},
+			isCorrect: true,
+
+			want:    pipelineCommand{command: "ehco"},
+			wantErr: "ehco: command not found. Did you mean: echo, gco?",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			in, err := os.CreateTemp("", "input")
+			require.NoError(t, err)
+			defer os.Remove(in.Name())
+			defer in.Close()
+			_, err = in.WriteString(tc.stdin)
+			require.NoError(t, err)
+			_, err = in.Seek(0, 0)
+			require.NoError(t, err)
+			errorOut, err := os.CreateTemp("", "error")
+			require.NoError(t, err)
+			defer os.Remove(errorOut.Name())
+			defer errorOut.Close()
+
+			cr := newCommandRunner("/home/user", false)
+			cr.history = history
+			cr.aliases["gco"] = "git checkout"
+			cr.options.isCorrect = tc.isCorrect
+			if tc.isTty {
+				cr.ttyFd = int(in.Fd())
+			}
+			got, gotErr := cr.handleCommandNotFound(tc.command, [3]*os.File{in, os.Stdout, errorOut})
+			assert.Equal(t, tc.want, got)
+			if tc.wantErr != "" {
+				assert.EqualError(t, gotErr, tc.wantErr)
+			} else {
+				assert.NoError(t, gotErr)
+			}
+			gotPrompt, err := os.ReadFile(errorOut.Name())
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantPrompt, string(gotPrompt))
+		})
+	}
+}
@@ -2,178 +2,688 @@ package shell
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"os/exec"
-	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
+
+	"github.com/at-ishikawa/go-shell/internal/completion"
+	"github.com/at-ishikawa/go-shell/internal/config"
+	"github.com/at-ishikawa/go-shell/internal/syntax"
+	xterm "golang.org/x/term"
+)
+
+const (
+	// exitCodeSignalBase + a signal number is the exit code of a command terminated by the signal
+	exitCodeSignalBase  = 128
+	exitCodeInterrupted = exitCodeSignalBase + int(syscall.SIGINT)
+	// exitCodeBrokenPipe is the exit code of a subshell in a pipeline which writes after the next command exits
+	exitCodeBrokenPipe = exitCodeSignalBase + int(syscall.SIGPIPE)
+	// exitCodeNotExecutable is the exit code of a command which is found but can't be executed
+	exitCodeNotExecutable = 126
+	exitCodeNotFound      = 127
 )
 
 type commandRunner struct {
 	homeDir            string
+	isPipefail         bool
 	execCommandContext func(context.Context, string, ...string) *exec.Cmd
+
+	// variables are shell variables which are not exported
+	variables    map[string]string
+	lastExitCode int
+	// substitutionExitCode is the exit status of the last command substitution
+	substitutionExitCode int
+	options              shellOptions
+	// stdioFiles are the current stdin, stdout and stderr of the shell
+	stdioFiles [3]*os.File
+
+	// cpuUsage is the CPU time of processes waited for in the foreground, which time reports
+	cpuUsage *cpuUsage
+	// interrupt is closed when Ctrl-C is passed to a subshell running concurrently with the shell,
+	// which doesn't receive SIGINT from the terminal. It's nil in the shell
+	interrupt <-chan struct{}
+	// isolation is nil unless the runner is a subshell running concurrently with the shell,
+	// which must not change the current directory or environment variables of the process
+	isolation *isolation
+	// isNonInteractive is true without a terminal like a script, where jobs don't run in their own process groups
+	isNonInteractive bool
+	// ttyFd is the file descriptor of the terminal for job control, or -1 without a terminal
+	ttyFd             int
+	jobs              []*job
+	lastBackgroundPid int
+	// directoryStack is the stack of pushd and popd except the current directory
+	directoryStack []string
+	// directoryHistory records visited directories for z, and it's nil without a terminal
+	directoryHistory *config.DirectoryHistory
+	// completionUi chooses a value interactively, and it's nil without a terminal
+	completionUi completion.Completion
+	// autoCdDir is the directory which the last input changed to because it isn't a command
+	autoCdDir string
+	// lastExecutionTime is how long the last input took in an interactive shell
+	lastExecutionTime *config.ExecutionTime
+
+	// history is nil without a terminal
+	history *config.History
+	aliases map[string]string
+	// functions are defined by name() compound-command
+	functions map[string]*syntax.FunctionDefinition
+	// name is $0 like the name of a script, or os.Args[0] if it's empty
+	name string
+	// positionalParameters are $1, $2, ... of the shell or the current function
+	positionalParameters []string
+	flow                 flowControl
+	loopDepth            int
+	functionDepth        int
+	sourceDepth          int
+}
+
+type pipelineCommand struct {
+	command string
+	args    []string
+	// env is NAME=value for the command in addition to the environment variables of the shell
+	env          []string
+	redirections []redirection
+	// compound is a compound command or a subshell in a pipeline, which runs in the shell process like a function
+	compound syntax.Command
 }
 
-func newCommandRunner(homeDir string) commandRunner {
-	return commandRunner{
+func newCommandRunner(homeDir string, isPipefail bool) *commandRunner {
+	return &commandRunner{
 		homeDir:            homeDir,
+		isPipefail:         isPipefail,
 		execCommandContext: exec.CommandContext,
+		cpuUsage:           &cpuUsage{},
+		variables:          make(map[string]string),
+		ttyFd:              -1,
+		aliases:            make(map[string]string),
+		functions:          make(map[string]*syntax.FunctionDefinition),
 	}
 }
 
-// todo: may replace with a oss tokenizer and parser like goyacc
-func (cr commandRunner) parseInput(inputCommand string) []string {
-	// inputFields := strings.Fields(inputCommand)
+func (cr *commandRunner) compilePipeline(pipeline *syntax.Pipeline) ([]pipelineCommand, error) {
+	commands := make([]pipelineCommand, 0, len(pipeline.Commands))
+	for _, command := range pipeline.Commands {
+		simpleCommand, ok := command.(*syntax.SimpleCommand)
+		if !ok {
+			commands = append(commands, pipelineCommand{
+				command:  compoundCommandName(command),
+				compound: command,
+			})
+			continue
+		}
+		command, err := cr.compileSimpleCommand(simpleCommand)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, command)
+	}
+	return commands, nil
+}
+
+func (cr *commandRunner) compileSimpleCommand(simpleCommand *syntax.SimpleCommand) (pipelineCommand, error) {
+	var command pipelineCommand
 	var inputFields []string
-	var isInStr bool
-	lastIndex := 0
-	lastQuoteIndex := 0
-	for i, char := range inputCommand {
-		if char == ' ' && !isInStr {
-			if i > lastIndex+1 {
-				inputFields = append(inputFields, inputCommand[lastIndex:i])
-			}
-			lastIndex = i + 1
-		} else if char == '"' {
-			if i > 0 {
-				lastChar := inputCommand[i-1]
-				if lastChar == '\\' {
-					continue
+	for i, word := range simpleCommand.Words {
+		// Arguments of export like NAME=$VALUE are not split like assignments
+		if i > 0 && len(inputFields) > 0 && inputFields[0] == "export" {
+			if assignment, ok := syntax.ParseAssignment(word); ok {
+				value, err := cr.expandAssignmentValue(assignment.Value)
+				if err != nil {
+					return command, err
 				}
+				inputFields = append(inputFields, assignment.Name+"="+value)
+				continue
 			}
-			if isInStr {
-				if lastQuoteIndex == 0 || inputCommand[lastQuoteIndex-1] == ' ' {
-					inputFields = append(inputFields, inputCommand[lastIndex+1:i])
-				} else {
-					inputFields = append(inputFields, inputCommand[lastIndex:i])
-				}
-				lastIndex = i + 1
-				isInStr = false
-			} else {
-				lastQuoteIndex = i
-				isInStr = true
-			}
 		}
+
+		fields, err := cr.expandWord(word)
+		if err != nil {
+			return command, err
+		}
+		inputFields = append(inputFields, fields...)
+	}
+	if len(inputFields) > 0 {
+		command.command = inputFields[0]
 	}
-	if lastIndex < len(inputCommand) {
-		inputFields = append(inputFields, inputCommand[lastIndex:])
+	if len(inputFields) > 1 {
+		command.args = inputFields[1:]
+	}
+
+	var err error
+	command.env, err = cr.expandAssignments(simpleCommand.Assignments)
+	if err != nil {
+		return command, err
 	}
-	return inputFields
+	command.redirections, err = cr.expandRedirections(simpleCommand.Redirections)
+	if err != nil {
+		return command, err
+	}
+	return command, nil
 }
 
-func (cr commandRunner) compileInput(inputCommand string) (string, []string) {
-	inputFields := cr.parseInput(inputCommand)
-	command := inputFields[0]
-	var args []string
-	if len(inputFields) > 1 {
-		args = inputFields[1:]
-		for i := 0; i < len(args); i++ {
-			arg := args[i]
-			// todo: file path only
-			args[i] = strings.ReplaceAll(arg, "~", cr.homeDir)
+func (cr *commandRunner) run(inputCommand string, term *terminal) (int, error) {
+	cr.autoCdDir = ""
+	var exitCode int
+	var err error
+	cr.lastExecutionTime = cr.measureExecutionTime(func() {
+		exitCode, err = cr.runInput(inputCommand, [3]*os.File{term.in.file, term.out.file, term.stdErr.file})
+	})
+	return exitCode, err
+}
+
+// runInput parses and runs an input with stdin, stdout and stderr
+func (cr *commandRunner) runInput(inputCommand string, stdioFiles [3]*os.File) (int, error) {
+	list, err := syntax.ParseWithAliases(inputCommand, cr.aliases)
+	if err != nil {
+		cr.lastExitCode = 2
+		return cr.lastExitCode, err
+	}
+	cr.stdioFiles = stdioFiles
+	cr.ttyFd = -1
+	if !cr.isNonInteractive && stdioFiles[0] != nil && xterm.IsTerminal(int(stdioFiles[0].Fd())) {
+		cr.ttyFd = int(stdioFiles[0].Fd())
+	}
+	return cr.runList(list, cr.stdioFiles)
+}
+
+// runList runs and-or lists in order and returns the status of the last one.
+// Errors except the last one are written into the stderr because subsequent commands still run
+func (cr *commandRunner) runList(list *syntax.List, stdioFiles [3]*os.File) (int, error) {
+	var exitCode int
+	var err error
+	for i, andOr := range list.Items {
+		if i > 0 {
+			cr.writeError(stdioFiles[2], err)
+		}
+
+		if andOr.IsBackground {
+			exitCode, err = cr.runBackground(andOr, stdioFiles)
+			continue
+		}
+		exitCode, err = cr.runAndOr(andOr, stdioFiles)
+		if exitCode == exitCodeInterrupted {
+			// Ctrl-C cancels the remaining commands as well
+			break
+		}
+		if cr.flow.kind != flowNone {
+			// break, continue, return or exit skips the remaining commands
+			break
 		}
 	}
-	return command, args
+	return exitCode, err
 }
 
-func (cr commandRunner) run(inputCommand string, term *terminal) (int, error) {
-	command, args := cr.compileInput(inputCommand)
-	if command == "" {
-		return 0, nil
+// writeError writes an error of a command into a stderr if it exists.
+// Without a terminal, a non-zero exit status isn't written like other shells
+func (cr *commandRunner) writeError(w io.Writer, err error) {
+	if err == nil {
+		return
+	}
+	var exitErr *exitError
+	if cr.isNonInteractive && errors.As(err, &exitErr) {
+		return
 	}
+	fmt.Fprintln(w, err)
+}
 
-	switch command {
-	case "cd":
-		if err := cr.changeDir(args); err != nil {
-			return 1, err
+// runBackground starts a pipeline as a background job
+func (cr *commandRunner) runBackground(andOr *syntax.AndOr, stdioFiles [3]*os.File) (int, error) {
+	if len(andOr.Pipelines) > 1 || andOr.Pipelines[0].IsNegated {
+		return 1, errors.New("only a pipeline can run in the background")
+	}
+	commands, err := cr.compilePipeline(andOr.Pipelines[0])
+	if err != nil {
+		return 1, err
+	}
+	exitCode, err := cr.runCommands(commands, stdioFiles, true)
+	cr.lastExitCode = exitCode
+	return exitCode, err
+}
+
+func (cr *commandRunner) runAndOr(andOr *syntax.AndOr, stdioFiles [3]*os.File) (int, error) {
+	exitCode, err := cr.runPipeline(andOr.Pipelines[0], stdioFiles)
+	for i, operator := range andOr.Operators {
+		if exitCode == exitCodeInterrupted || cr.flow.kind != flowNone {
+			break
 		}
-		return 0, nil
+		// && runs the next pipeline only if the previous one succeeded, and || does only if it failed
+		if (operator == syntax.AndOperator) != (exitCode == 0) {
+			continue
+		}
+		cr.writeError(stdioFiles[2], err)
+		exitCode, err = cr.runPipeline(andOr.Pipelines[i+1], stdioFiles)
 	}
+	return exitCode, err
+}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+func (cr *commandRunner) runPipeline(pipeline *syntax.Pipeline, stdioFiles [3]*os.File) (int, error) {
+	var exitCode int
+	var err error
+	if pipeline.IsTimed {
+		executionTime := cr.measureExecutionTime(func() {
+			exitCode, err = cr.runPipelineCommands(pipeline, stdioFiles)
+		})
+		writeExecutionTime(stdioFiles[2], executionTime, pipeline.IsPortableTime)
+	} else {
+		exitCode, err = cr.runPipelineCommands(pipeline, stdioFiles)
+	}
+	if pipeline.IsNegated {
+		if exitCode == 0 {
+			exitCode = 1
+		} else {
+			exitCode = 0
+		}
+		err = nil
+	}
+	cr.lastExitCode = exitCode
+	return exitCode, err
+}
 
-	cmd := cr.execCommandContext(ctx, command, args...)
-	cmd.Stdin = term.in.file
-	cmd.Stdout = term.out.file
-	cmd.Stderr = term.stdErr.file
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Setpgid: true,
+func (cr *commandRunner) runPipelineCommands(pipeline *syntax.Pipeline, stdioFiles [3]*os.File) (int, error) {
+	if len(pipeline.Commands) == 1 {
+		switch command := pipeline.Commands[0].(type) {
+		case *syntax.SimpleCommand:
+			if len(command.Words) == 0 {
+				return cr.runAssignments(command)
+			}
+		default:
+			return cr.runCompoundCommand(command, stdioFiles)
+		}
 	}
 
-	errCh := make(chan error)
-	defer close(errCh)
-	if err := cmd.Start(); err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			exitCode := exitError.ExitCode()
-			return exitCode, err
+	commands, err := cr.compilePipeline(pipeline)
+	if err != nil {
+		if errors.Is(err, errInterrupted) {
+			return exitCodeInterrupted, nil
 		}
 		return 1, err
 	}
+	return cr.runCommands(commands, stdioFiles, false)
+}
 
-	stopSignals := make(chan os.Signal, 1)
-	defer signal.Stop(stopSignals)
-	// SIGINT: Control-C
-	signal.Notify(stopSignals, syscall.SIGINT)
-	go func() {
-		select {
-		case <-ctx.Done():
-		case sig := <-stopSignals:
-			if err := cmd.Process.Signal(sig); err != nil {
-				// todo: replace os.Stderr with tty
-				fmt.Fprintf(term.stdErr.file, "failed cmd.Process.Signal: %v\n", err)
+// runAssignments sets shell variables of a command without a command name like NAME=value.
+// The exit status is the one of the last command substitution if it exists
+func (cr *commandRunner) runAssignments(simpleCommand *syntax.SimpleCommand) (int, error) {
+	cr.substitutionExitCode = 0
+	for _, assignment := range simpleCommand.Assignments {
+		value, err := cr.expandAssignmentValue(assignment.Value)
+		if err != nil {
+			if errors.Is(err, errInterrupted) {
+				return exitCodeInterrupted, nil
 			}
+			return 1, err
+		}
+		if err := cr.setVariable(assignment.Name, value); err != nil {
+			return 1, err
+		}
+	}
+
+	redirections, err := cr.expandRedirections(simpleCommand.Redirections)
+	if err != nil {
+		return 1, err
+	}
+	_, openedFiles, err := applyRedirections([3]*os.File{}, redirections)
+	if err != nil {
+		return 1, err
+	}
+	for _, f := range openedFiles {
+		f.Close()
+	}
+	return cr.substitutionExitCode, nil
+}
+
+// runSubshell runs a list with redirections in a subshell
+func (cr *commandRunner) runSubshell(subshell *syntax.Subshell, stdioFiles [3]*os.File) (int, error) {
+	redirections, err := cr.expandRedirections(subshell.Redirections)
+	if err != nil {
+		return 1, err
+	}
+	files, openedFiles, err := applyRedirections(stdioFiles, redirections)
+	if err != nil {
+		return 1, err
+	}
+	defer func() {
+		for _, f := range openedFiles {
+			f.Close()
 		}
 	}()
+	return cr.runInSubshell(subshell.List, files)
+}
 
-	var paused bool
-	pauseSignals := make(chan os.Signal, 1)
-	defer signal.Stop(pauseSignals)
-	// SIGTSTP: Control-Z
-	signal.Notify(pauseSignals, syscall.SIGTSTP)
-	go func() {
-		select {
-		case <-ctx.Done():
-		case <-pauseSignals:
-			// don't make a panic in a goroutine. It's harder to check a result on a unit test
-			paused = true
-			if err := cmd.Process.Kill(); err != nil {
-				fmt.Fprintf(term.stdErr.file, "failed cmd.Process.Kill: %v\n", err)
-			} else {
-				fmt.Fprintf(term.out.file, "killed process: %s\n", command)
+// runInSubshell runs a list in the shell process, and restores the current directory,
+// variables and options of the shell after that
+func (cr *commandRunner) runInSubshell(list *syntax.List, stdioFiles [3]*os.File) (int, error) {
+	currentDir, err := cr.currentDir()
+	if err != nil {
+		return 1, err
+	}
+	environ := cr.environ()
+	variables := make(map[string]string, len(cr.variables))
+	for name, value := range cr.variables {
+		variables[name] = value
+	}
+	functions := make(map[string]*syntax.FunctionDefinition, len(cr.functions))
+	for name, function := range cr.functions {
+		functions[name] = function
+	}
+	options := cr.options
+	directoryStack := cr.getDirectoryStack()
+	parentStdioFiles := cr.stdioFiles
+	defer func() {
+		if err := cr.chdir(currentDir); err != nil {
+			fmt.Fprintf(stdioFiles[2], "failed to restore the current directory: %v\n", err)
+		}
+		cr.replaceEnviron(environ)
+		cr.variables = variables
+		cr.functions = functions
+		cr.options = options
+		cr.directoryStack = directoryStack
+		cr.stdioFiles = parentStdioFiles
+		// break, continue and return in a subshell don't affect the parent shell
+		cr.flow = flowControl{}
+	}()
+
+	cr.stdioFiles = stdioFiles
+	return cr.runList(list, stdioFiles)
+}
+
+func (cr *commandRunner) runCommands(commands []pipelineCommand, stdioFiles [3]*os.File, isBackground bool) (int, error) {
+	if len(commands) == 1 && !isBackground {
+		if commands[0].command == "" {
+			_, openedFiles, err := applyRedirections([3]*os.File{}, commands[0].redirections)
+			if err != nil {
+				return 1, err
+			}
+			for _, f := range openedFiles {
+				f.Close()
+			}
+			return 0, nil
+		}
+		if dir, ok := cr.findAutoCdDir(commands[0]); ok {
+			cr.autoCdDir = dir
+			commands[0].command = "cd"
+			commands[0].args = []string{dir}
+		}
+		if cr.isInShellCommand(commands[0]) {
+			return cr.runInShell(commands[0], stdioFiles)
+		}
+	}
+	isInShell := make([]bool, len(commands))
+	for i, c := range commands {
+		isInShell[i] = cr.isInShellCommand(c)
+		if isInShell[i] && isBackground {
+			return 1, fmt.Errorf("%s: builtins, functions and compound commands in the background are not supported yet", c.command)
+		}
+	}
+
+	// Each pipe and file is closed on the shell side once all commands start,
+	// except the ones of builtins and functions, which are closed when they finish
+	var parentFiles []*os.File
+	inShellFiles := make([][]*os.File, len(commands))
+	defer func() {
+		for _, f := range parentFiles {
+			f.Close()
+		}
+		for _, files := range inShellFiles {
+			for _, f := range files {
+				f.Close()
 			}
 		}
 	}()
+	addFile := func(i int, f *os.File) {
+		if isInShell[i] {
+			inShellFiles[i] = append(inShellFiles[i], f)
+		} else {
+			parentFiles = append(parentFiles, f)
+		}
+	}
+	commandStdioFiles := make([][3]*os.File, len(commands))
+	for i := range commands {
+		commandStdioFiles[i] = stdioFiles
+	}
+	for i := 0; i < len(commands)-1; i++ {
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			return 1, err
+		}
+		addFile(i, writer)
+		addFile(i+1, reader)
+		commandStdioFiles[i][1] = writer
+		commandStdioFiles[i+1][0] = reader
+	}
 
-	if err := cmd.Wait(); err != nil {
-		if paused {
-			panic("Pausing a process has not been implemented yet")
+	// cmds has nil for builtins and functions
+	cmds := make([]*exec.Cmd, 0, len(commands))
+	commandLines := make([]string, 0, len(commands))
+	for i, c := range commands {
+		commandLines = append(commandLines, strings.Join(append([]string{c.command}, c.args...), " "))
+		if isInShell[i] {
+			cmds = append(cmds, nil)
+			continue
 		}
+		files, openedFiles, err := applyRedirections(commandStdioFiles[i], c.redirections)
+		if err != nil {
+			return 1, err
+		}
+		parentFiles = append(parentFiles, openedFiles...)
 
-		// var exitError *exec.ExitError
-		// if errors.As(err, &exitError) {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			exitCode := exitError.ExitCode()
-			// Don't show a message when a command was canceled by an interruption
-			if strings.HasPrefix(exitError.String(), "signal:") {
-				return exitCode, nil
+		cmd := cr.newCommand(c.command, c.args, c.env)
+		if errors.Is(cmd.Err, exec.ErrNotFound) {
+			corrected, err := cr.handleCommandNotFound(c, stdioFiles)
+			if err != nil {
+				return exitCodeNotFound, err
 			}
-			return exitCode, err
+			commands[i] = corrected
+			return cr.runCommands(commands, stdioFiles, isBackground)
 		}
-		return 1, err
+		cmd.Stdin = files[0]
+		cmd.Stdout = files[1]
+		cmd.Stderr = files[2]
+		cmds = append(cmds, cmd)
+	}
+
+	// All commands in a pipeline belong to the process group of the first command with job control
+	j := &job{
+		command: strings.Join(commandLines, " | "),
+	}
+	for _, cmd := range cmds {
+		if cmd == nil {
+			// A builtin or a function doesn't have a process, and its status is set when it finishes
+			j.processes = append(j.processes, &jobProcess{isDone: true})
+			continue
+		}
+		if !cr.isNonInteractive {
+			cmd.SysProcAttr = &syscall.SysProcAttr{
+				Setpgid: true,
+				Pgid:    j.pgid,
+			}
+			if !isBackground && cr.ttyFd >= 0 {
+				// The terminal is handed to the process group so that Ctrl-C and Ctrl-Z are sent to it
+				cmd.SysProcAttr.Foreground = true
+				cmd.SysProcAttr.Ctty = cr.ttyFd
+			}
+		}
+		if err := cmd.Start(); err != nil {
+			if len(j.processes) > 0 {
+				j.signal(syscall.SIGKILL)
+				waitJob(j, false)
+				cr.setForeground(syscall.Getpgrp())
+			}
+			return exitCodeOfStartError(err), err
+		}
+		if !cr.isNonInteractive && j.pgid == 0 {
+			j.pgid = cmd.Process.Pid
+		}
+		j.processes = append(j.processes, &jobProcess{pid: cmd.Process.Pid})
+		cmd.Process.Release()
+	}
+	for _, f := range parentFiles {
+		f.Close()
+	}
+	parentFiles = nil
+
+	if isBackground {
+		cr.addJob(j)
+		cr.lastBackgroundPid = j.processes[len(j.processes)-1].pid
+		if !cr.isNonInteractive {
+			// Like other shells, a script doesn't write a job started in the background
+			fmt.Fprintf(stdioFiles[2], "[%d] %d\n", j.id, cr.lastBackgroundPid)
+		}
+		return 0, nil
 	}
 
-	return 0, nil
+	// Builtins, functions and compound commands run while processes are waited for, to pass Ctrl-C to them
+	cr.startInShellPipeline(commands, commandStdioFiles, inShellFiles, j)
+	inShellFiles = nil
+	return cr.waitForeground(j, stdioFiles)
+}
+
+// exitCodeOfStartError returns the exit code of a command which failed to start like other shells
+func exitCodeOfStartError(err error) int {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return exitCodeNotFound
+	case errors.Is(err, fs.ErrPermission), errors.Is(err, syscall.ENOEXEC):
+		return exitCodeNotExecutable
+	}
+	return 1
 }
 
-func (cr commandRunner) changeDir(args []string) error {
-	dir := cr.homeDir
-	if len(args) >= 1 {
-		dir = args[0]
+// startInShellPipeline runs builtins, functions and compound commands in a pipeline concurrently in subshells.
+// The job waits until all of them finish
+func (cr *commandRunner) startInShellPipeline(commands []pipelineCommand, commandStdioFiles [][3]*os.File, inShellFiles [][]*os.File, j *job) {
+	interrupt := make(chan struct{})
+	var interruptOnce sync.Once
+	j.interruptInShell = func() {
+		interruptOnce.Do(func() {
+			close(interrupt)
+		})
+	}
+	for i, c := range commands {
+		if !cr.isInShellCommand(c) {
+			continue
+		}
+		subshell, err := cr.newSubshell()
+		if err != nil {
+			fmt.Fprintln(commandStdioFiles[i][2], err)
+			j.processes[i].status = exitedStatus(1)
+			for _, f := range inShellFiles[i] {
+				f.Close()
+			}
+			continue
+		}
+		subshell.stdioFiles = commandStdioFiles[i]
+		subshell.interrupt = interrupt
+		j.inShell.Add(1)
+		go func(i int, c pipelineCommand) {
+			defer j.inShell.Done()
+			defer func() {
+				for _, f := range inShellFiles[i] {
+					f.Close()
+				}
+			}()
+
+			exitCode, err := subshell.runInShell(c, commandStdioFiles[i])
+			var exitErr *exitError
+			if err != nil && !errors.As(err, &exitErr) {
+				fmt.Fprintln(commandStdioFiles[i][2], err)
+			}
+			if subshell.flow.kind == flowExit {
+				exitCode = subshell.flow.exitCode
+			}
+			j.processes[i].status = exitedStatus(exitCode)
+		}(i, c)
+	}
+}
+
+// newSubshell returns a copy of the shell for a command running concurrently with the shell.
+// Changes of the current directory, variables, functions, aliases and options don't affect the shell,
+// and commands in it don't use job control
+func (cr *commandRunner) newSubshell() (*commandRunner, error) {
+	isolation, err := cr.newIsolation()
+	if err != nil {
+		return nil, err
+	}
+	subshell := *cr
+	subshell.isolation = isolation
+	subshell.variables = make(map[string]string, len(cr.variables))
+	for name, value := range cr.variables {
+		subshell.variables[name] = value
+	}
+	subshell.functions = make(map[string]*syntax.FunctionDefinition, len(cr.functions))
+	for name, function := range cr.functions {
+		subshell.functions[name] = function
+	}
+	subshell.aliases = make(map[string]string, len(cr.aliases))
+	for name, value := range cr.aliases {
+		subshell.aliases[name] = value
+	}
+	subshell.directoryStack = cr.getDirectoryStack()
+	// Only the shell records directories and uses the terminal
+	subshell.directoryHistory = nil
+	subshell.completionUi = nil
+	subshell.isNonInteractive = true
+	subshell.ttyFd = -1
+	subshell.jobs = nil
+	subshell.flow = flowControl{}
+	return &subshell, nil
+}
+
+// isInShell returns true if a command runs in the shell process like a builtin or a function
+func (cr *commandRunner) isInShell(name string) bool {
+	if _, ok := cr.functions[name]; ok {
+		return true
+	}
+	_, ok := builtins[name]
+	return ok
+}
+
+// isInShellCommand returns true if a command in a pipeline runs in the shell process.
+// A command with only assignments like NAME=value also runs in it without any effect
+func (cr *commandRunner) isInShellCommand(command pipelineCommand) bool {
+	return command.compound != nil || command.command == "" || cr.isInShell(command.command)
+}
+
+// runInShell runs a function, a builtin or a compound command in the shell process with redirections.
+// A function is prior to a builtin with the same name
+func (cr *commandRunner) runInShell(command pipelineCommand, stdioFiles [3]*os.File) (int, error) {
+	if command.compound != nil {
+		return cr.runCompoundCommand(command.compound, stdioFiles)
+	}
+	if function, ok := cr.functions[command.command]; ok {
+		return cr.callFunction(function, command, stdioFiles)
+	}
+
+	files, openedFiles, err := applyRedirections(stdioFiles, command.redirections)
+	if err != nil {
+		return 1, err
+	}
+	defer func() {
+		for _, f := range openedFiles {
+			f.Close()
+		}
+	}()
+	if command.command == "" {
+		// Assignments in a pipeline like NAME=value | command are lost with the subshell
+		return 0, nil
+	}
+	// Assignments before a builtin name are exported only while the builtin runs
+	restoreEnv, err := cr.setTemporaryEnv(command.env)
+	if err != nil {
+		return 1, err
 	}
-	if err := os.Chdir(dir); err != nil {
-		return err
+	defer restoreEnv()
+	exitCode, err := builtins[command.command].run(cr, command.args, files)
+	if cr.isolation != nil && errors.Is(err, syscall.EPIPE) {
+		// A subshell in a pipeline exits without an error when the next command stops reading, like SIGPIPE
+		cr.flow = flowControl{kind: flowExit, exitCode: exitCodeBrokenPipe}
+		return exitCodeBrokenPipe, nil
 	}
-	return nil
+	return exitCode, err
 }
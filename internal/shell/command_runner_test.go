@@ -8,14 +8,24 @@ import (
 	"os/exec"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/at-ishikawa/go-shell/internal/syntax"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+func compileInput(cr *commandRunner, inputCommand string) ([]pipelineCommand, error) {
+	list, err := syntax.Parse(inputCommand)
+	if err != nil {
+		return nil, err
+	}
+	return cr.compilePipeline(list.Items[0].Pipelines[0])
+}
+
 func TestCommandRunner_CompileInput(t *testing.T) {
 	homeDir := "/home/user"
 	testCases := []struct {
@@ -23,6 +33,7 @@ func TestCommandRunner_CompileInput(t *testing.T) {
 		inputCommand string
 		wantCommand  string
 		wantArgs     []string
+		wantEnv      []string
 	}{
 		{
 			name:         "no argument",
@@ -41,7 +52,18 @@ func TestCommandRunner_CompileInput(t *testing.T) {
 			wantCommand:  "cd",
 			wantArgs:     []string{homeDir},
 		},
-
+		{
+			name:         "replace tildes only at the beginning of unquoted words",
+			inputCommand: `ls ~/src "~/src" \~ ~"/src" git~ HEAD~3 --selector=a~b`,
+			wantCommand:  "ls",
+			wantArgs:     []string{homeDir + "/src", "~/src", "~", "~/src", "git~", "HEAD~3", "--selector=a~b"},
+		},
+		{
+			name:         "replace tildes after = and : in an assignment",
+			inputCommand: `PATH=~/bin:~/go/bin:/usr/bin~ env`,
+			wantCommand:  "env",
+			wantEnv:      []string{"PATH=" + homeDir + "/bin:" + homeDir + "/go/bin:/usr/bin~"},
+		},
 		{
 			name:         "an argument with double quotes ",
 			inputCommand: `git commit -m "commit message \"test\" 1" -s`,
@@ -49,7 +71,7 @@ func TestCommandRunner_CompileInput(t *testing.T) {
 			wantArgs: []string{
 				"commit",
 				"-m",
-				`commit message \"test\" 1`,
+				`commit message "test" 1`,
 				"-s",
 			},
 		},
@@ -59,7 +81,7 @@ func TestCommandRunner_CompileInput(t *testing.T) {
 			wantCommand:  "git",
 			wantArgs: []string{
 				"commit",
-				"-m\"commit message \\\"test\\\" 1",
+				`-mcommit message "test" 1`,
 				"-s",
 			},
 		},
@@ -70,17 +92,156 @@ func TestCommandRunner_CompileInput(t *testing.T) {
 			wantArgs: []string{
 				"commit",
 				"-m",
-				"commit message \\\"test\\\"",
+				`commit message "test"`,
+			},
+		},
+		{
+			name:         "an argument with single quotes",
+			inputCommand: `echo 'a "b" \c' 'it'\''s'`,
+			wantCommand:  "echo",
+			wantArgs: []string{
+				`a "b" \c`,
+				"it's",
+			},
+		},
+		{
+			name:         "an argument with backslash escapes",
+			inputCommand: `ls my\ file \"a\"`,
+			wantCommand:  "ls",
+			wantArgs: []string{
+				"my file",
+				`"a"`,
+			},
+		},
+		{
+			name:         "an argument with ANSI-C quotes",
+			inputCommand: `printf $'a\tb\n'`,
+			wantCommand:  "printf",
+			wantArgs: []string{
+				"a\tb\n",
+			},
+		},
+		{
+			name:         "an empty argument",
+			inputCommand: `echo "" ''`,
+			wantCommand:  "echo",
+			wantArgs: []string{
+				"",
+				"",
 			},
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			cr := commandRunner{homeDir: homeDir}
-			gotCommand, gotArgs := cr.compileInput(tc.inputCommand)
-			assert.Equal(t, tc.wantCommand, gotCommand)
-			assert.Equal(t, tc.wantArgs, gotArgs)
+			cr := &commandRunner{homeDir: homeDir}
+			got, gotErr := compileInput(cr, tc.inputCommand)
+			require.NoError(t, gotErr)
+			require.Len(t, got, 1)
+			assert.Equal(t, tc.wantCommand, got[0].command)
+			assert.Equal(t, tc.wantArgs, got[0].args)
+			assert.Equal(t, tc.wantEnv, got[0].env)
+		})
+	}
+}
+
+func TestCommandRunner_CompilePipeline(t *testing.T) {
+	testCases := []struct {
+		name         string
+		inputCommand string
+		want         []pipelineCommand
+		wantErr      error
+	}{
+		{
+			name:         "single command",
+			inputCommand: "ls /home",
+			want: []pipelineCommand{
+				{command: "ls", args: []string{"/home"}},
+			},
+		},
+		{
+			name:         "multiple commands",
+			inputCommand: "ls /home | grep user | wc -l",
+			want: []pipelineCommand{
+				{command: "ls", args: []string{"/home"}},
+				{command: "grep", args: []string{"user"}},
+				{command: "wc", args: []string{"-l"}},
+			},
+		},
+		{
+			name:         "no spaces around a pipe",
+			inputCommand: "ls|grep user",
+			want: []pipelineCommand{
+				{command: "ls"},
+				{command: "grep", args: []string{"user"}},
+			},
+		},
+		{
+			name:         "a pipe in double quotes",
+			inputCommand: `grep "a|b" | wc`,
+			want: []pipelineCommand{
+				{command: "grep", args: []string{"a|b"}},
+				{command: "wc"},
+			},
+		},
+		{
+			name:         "redirections",
+			inputCommand: "cat < in.txt 2>&1 | sort >> out.txt",
+			want: []pipelineCommand{
+				{command: "cat", redirections: []redirection{
+					{fd: 0, operator: syntax.RedirectInput, target: "in.txt"},
+					{fd: 2, operator: syntax.DuplicateOutput, target: "1"},
+				}},
+				{command: "sort", redirections: []redirection{
+					{fd: 1, operator: syntax.RedirectAppend, target: "out.txt"},
+				}},
+			},
+		},
+		{
+			name:         "redirections without spaces",
+			inputCommand: "make build&>build.log",
+			want: []pipelineCommand{
+				{command: "make", args: []string{"build"}, redirections: []redirection{
+					{fd: 1, operator: syntax.RedirectOutput, target: "build.log"},
+					{fd: 2, operator: syntax.DuplicateOutput, target: "1"},
+				}},
+			},
+		},
+		{
+			name:         "a redirection in double quotes",
+			inputCommand: `echo ">" "2>&1"`,
+			want: []pipelineCommand{
+				{command: "echo", args: []string{">", "2>&1"}},
+			},
+		},
+		{
+			name:         "no file after a redirection",
+			inputCommand: "ls >",
+			wantErr:      &syntax.SyntaxError{Message: "syntax error near unexpected token `newline'"},
+		},
+		{
+			name:         "no file before a pipe",
+			inputCommand: "ls > | cat",
+			wantErr:      &syntax.SyntaxError{Message: "syntax error near unexpected token `|'"},
+		},
+		{
+			name:         "no command after a pipe",
+			inputCommand: "ls |",
+			wantErr:      &syntax.SyntaxError{Message: "syntax error: unexpected end of file", IsIncomplete: true},
+		},
+		{
+			name:         "no command before a pipe",
+			inputCommand: "| ls",
+			wantErr:      &syntax.SyntaxError{Message: "syntax error near unexpected token `|'"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := &commandRunner{}
+			got, gotErr := compileInput(cr, tc.inputCommand)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, tc.wantErr, gotErr)
 		})
 	}
 }
@@ -122,8 +283,8 @@ func TestCommandRunner_Run(t *testing.T) {
 					require.NoError(t, err)
 				}()
 
-				cr := commandRunner{}
-				gotExitCode, gotError := cr.run(tc.inputCommand, nil)
+				cr := &commandRunner{}
+				gotExitCode, gotError := cr.run(tc.inputCommand, &terminal{})
 				assert.Equal(t, tc.wantExitCode, gotExitCode)
 				assert.Equal(t, tc.wantError, gotError)
 
@@ -134,6 +295,685 @@ func TestCommandRunner_Run(t *testing.T) {
 		}
 	})
 
+	t.Run("run a pipeline", func(t *testing.T) {
+		testCases := []struct {
+			name         string
+			inputCommand string
+			isPipefail   bool
+
+			wantOutput   string
+			wantExitCode int
+		}{
+			{
+				name:         "connect an output to an input",
+				inputCommand: "echo hello | tr a-z A-Z | tr H J",
+				wantOutput:   "JELLO\n",
+			},
+			{
+				name:         "the status of the last command",
+				inputCommand: "true | false",
+				wantExitCode: 1,
+			},
+			{
+				name:         "ignore the status except the last command",
+				inputCommand: "false | true",
+			},
+			{
+				name:         "the status of the failed command with pipefail",
+				inputCommand: "false | true",
+				isPipefail:   true,
+				wantExitCode: 1,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				out, err := os.CreateTemp("", "output")
+				require.NoError(t, err)
+				defer os.Remove(out.Name())
+				defer out.Close()
+
+				cr := newCommandRunner("/home/user", tc.isPipefail)
+				term := terminal{
+					in: input{
+						file: os.Stdin,
+					},
+					out: output{
+						file: out,
+					},
+					stdErr: output{
+						file: os.Stderr,
+					},
+				}
+				gotExitCode, _ := cr.run(tc.inputCommand, &term)
+				assert.Equal(t, tc.wantExitCode, gotExitCode)
+
+				gotOutput, err := os.ReadFile(out.Name())
+				require.NoError(t, err)
+				assert.Equal(t, tc.wantOutput, string(gotOutput))
+			})
+		}
+	})
+
+	t.Run("run a list", func(t *testing.T) {
+		currentDirectory, err := os.Getwd()
+		require.NoError(t, err)
+
+		testCases := []struct {
+			name         string
+			inputCommand string
+
+			wantOutput   string
+			wantExitCode int
+		}{
+			{
+				name:         "run commands sequentially",
+				inputCommand: "echo a; false; echo b",
+				wantOutput:   "a\nb\n",
+			},
+			{
+				name:         "the status of the last command",
+				inputCommand: "echo a; false",
+				wantOutput:   "a\n",
+				wantExitCode: 1,
+			},
+			{
+				name:         "run a command after a succeeded command with &&",
+				inputCommand: "true && echo a",
+				wantOutput:   "a\n",
+			},
+			{
+				name:         "skip a command after a failed command with &&",
+				inputCommand: "false && echo a",
+				wantExitCode: 1,
+			},
+			{
+				name:         "run a command after a failed command with ||",
+				inputCommand: "false || echo a",
+				wantOutput:   "a\n",
+			},
+			{
+				name:         "skip a command after a succeeded command with ||",
+				inputCommand: "true || echo a",
+			},
+			{
+				name:         "skip commands until the next ||",
+				inputCommand: "false && echo a && echo b || echo c",
+				wantOutput:   "c\n",
+			},
+			{
+				name:         "negate a status",
+				inputCommand: "! false && echo a",
+				wantOutput:   "a\n",
+			},
+			{
+				name:         "a subshell doesn't change the current directory",
+				inputCommand: "(cd / && pwd) && pwd",
+				wantOutput:   "/\n" + currentDirectory + "\n",
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				out, err := os.CreateTemp("", "output")
+				require.NoError(t, err)
+				defer os.Remove(out.Name())
+				defer out.Close()
+
+				cr := newCommandRunner("/home/user", false)
+				term := terminal{
+					in: input{
+						file: os.Stdin,
+					},
+					out: output{
+						file: out,
+					},
+					stdErr: output{
+						file: os.Stderr,
+					},
+				}
+				gotExitCode, _ := cr.run(tc.inputCommand, &term)
+				assert.Equal(t, tc.wantExitCode, gotExitCode)
+
+				gotOutput, err := os.ReadFile(out.Name())
+				require.NoError(t, err)
+				assert.Equal(t, tc.wantOutput, string(gotOutput))
+			})
+		}
+	})
+
+	t.Run("run commands with variables", func(t *testing.T) {
+		t.Cleanup(func() {
+			os.Unsetenv("GO_SHELL_TEST_EXPORTED")
+		})
+		currentDirectory, err := os.Getwd()
+		require.NoError(t, err)
+
+		testCases := []struct {
+			name         string
+			inputCommand string
+
+			wantOutput   string
+			wantExitCode int
+			wantErr      bool
+		}{
+			{
+				name:         "expand a shell variable",
+				inputCommand: `A=1 B="$A 2"; echo $B "${B}" '$B' \$B`,
+				wantOutput:   "1 2 1 2 $B $B\n",
+			},
+			{
+				name:         "split an unquoted variable into fields",
+				inputCommand: `A="a  b"; printf '[%s]' $A "$A" $UNKNOWN "$UNKNOWN"`,
+				wantOutput:   "[a][b][a  b][]",
+			},
+			{
+				name:         "a shell variable isn't passed to a command",
+				inputCommand: `GO_SHELL_TEST_LOCAL=1; sh -c 'echo "[$GO_SHELL_TEST_LOCAL]"'`,
+				wantOutput:   "[]\n",
+			},
+			{
+				name:         "pass an exported variable to a command",
+				inputCommand: `GO_SHELL_TEST_EXPORTED="a b"; export GO_SHELL_TEST_EXPORTED; sh -c 'echo "$GO_SHELL_TEST_EXPORTED"'`,
+				wantOutput:   "a b\n",
+			},
+			{
+				name:         "export with a value",
+				inputCommand: `A="a b"; export GO_SHELL_TEST_EXPORTED=$A; sh -c 'echo "$GO_SHELL_TEST_EXPORTED"'`,
+				wantOutput:   "a b\n",
+			},
+			{
+				name:         "an assignment only for a command",
+				inputCommand: `GO_SHELL_TEST_TEMP=1 sh -c 'echo "$GO_SHELL_TEST_TEMP"'; echo "[$GO_SHELL_TEST_TEMP]"`,
+				wantOutput:   "1\n[]\n",
+			},
+			{
+				name:         "default values",
+				inputCommand: `A=; echo ${A:-a} ${A-b} ${UNKNOWN-c} ${A:+d} ${#UNKNOWN}; echo ${B:=e} $B`,
+				wantOutput:   "a c 0\ne e\n",
+			},
+			{
+				name:         "an error for an unset variable",
+				inputCommand: `echo ${UNKNOWN:?not set}`,
+				wantExitCode: 1,
+				wantErr:      true,
+			},
+			{
+				name:         "the exit status of the last pipeline",
+				inputCommand: `false; echo $?; echo $?`,
+				wantOutput:   "1\n0\n",
+			},
+			{
+				name:         "the process id of the shell",
+				inputCommand: `echo $$`,
+				wantOutput:   strconv.Itoa(os.Getpid()) + "\n",
+			},
+			{
+				name:         "the current directory",
+				inputCommand: `echo $PWD; cd /; echo $PWD; cd ` + currentDirectory,
+				wantOutput:   currentDirectory + "\n/\n",
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				out, err := os.CreateTemp("", "output")
+				require.NoError(t, err)
+				defer os.Remove(out.Name())
+				defer out.Close()
+
+				cr := newCommandRunner("/home/user", false)
+				term := terminal{
+					in: input{
+						file: os.Stdin,
+					},
+					out: output{
+						file: out,
+					},
+					stdErr: output{
+						file: os.Stderr,
+					},
+				}
+				gotExitCode, gotErr := cr.run(tc.inputCommand, &term)
+				assert.Equal(t, tc.wantExitCode, gotExitCode)
+				assert.Equal(t, tc.wantErr, gotErr != nil)
+
+				gotOutput, err := os.ReadFile(out.Name())
+				require.NoError(t, err)
+				assert.Equal(t, tc.wantOutput, string(gotOutput))
+			})
+		}
+	})
+
+	t.Run("run compound commands and functions", func(t *testing.T) {
+		testCases := []struct {
+			name         string
+			inputCommand string
+
+			wantOutput   string
+			wantExitCode int
+			wantErr      bool
+		}{
+			{
+				name:         "if clause",
+				inputCommand: "for a in 1 2 3; do if [ $a = 1 ]; then echo one; elif [ $a = 2 ]; then echo two; else echo other; fi; done",
+				wantOutput:   "one\ntwo\nother\n",
+			},
+			{
+				name:         "the exit status of if without a matched branch",
+				inputCommand: "false; if false; then echo a; fi",
+			},
+			{
+				name:         "for clause with fields",
+				inputCommand: `A="a b"; for v in $A "$A" *.unknown; do printf '[%s]' "$v"; done`,
+				wantOutput:   "[a][b][a b][*.unknown]",
+			},
+			{
+				name:         "while and until clauses",
+				inputCommand: `A=; while [ "$A" != xxx ]; do A=x$A; done; echo $A; until [ -n "$B" ]; do echo until; B=b; done`,
+				wantOutput:   "xxx\nuntil\n",
+			},
+			{
+				name:         "break and continue",
+				inputCommand: `for a in 1 2 3 4; do if [ $a = 2 ]; then continue; fi; if [ $a = 4 ]; then break; fi; echo $a; done`,
+				wantOutput:   "1\n3\n",
+			},
+			{
+				name:         "break nested loops",
+				inputCommand: `for a in 1 2; do for b in 1 2; do echo $a$b; break 2; done; done; echo done`,
+				wantOutput:   "11\ndone\n",
+			},
+			{
+				name:         "break outside a loop",
+				inputCommand: `break`,
+				wantExitCode: 1,
+				wantErr:      true,
+			},
+			{
+				name:         "case clause",
+				inputCommand: `for a in main.go README.md '*' x; do case $a in *.go|*.mod) echo go;; '*') echo star;; [A-Z]*) echo upper;; *) ;; esac; done`,
+				wantOutput:   "go\nupper\nstar\n",
+			},
+			{
+				name:         "brace group with a redirection",
+				inputCommand: `{ echo a; echo b >&2; } 2>&1`,
+				wantOutput:   "a\nb\n",
+			},
+			{
+				name:         "function with positional parameters",
+				inputCommand: `f() { echo $# "$1"; for arg; do printf '[%s]' "$arg"; done; printf '[%s]' "$@"; echo; }; f "a b" c; echo $#`,
+				wantOutput:   "2 a b\n[a b][c][a b][c]\n0\n",
+			},
+			{
+				name:         "return from a function",
+				inputCommand: `f() { for a in 1 2; do if [ $a = 2 ]; then return 3; fi; echo $a; done; echo unreachable; }; f; echo $?`,
+				wantOutput:   "1\n3\n",
+			},
+			{
+				name:         "recursive function",
+				inputCommand: `f() { if [ $1 -gt 0 ]; then echo $1; f $(expr $1 - 1); fi; }; f 3`,
+				wantOutput:   "3\n2\n1\n",
+			},
+			{
+				name:         "infinite recursion",
+				inputCommand: `f() { f; }; f`,
+				wantExitCode: 1,
+				wantErr:      true,
+			},
+			{
+				name:         "return outside a function",
+				inputCommand: `return`,
+				wantExitCode: 1,
+				wantErr:      true,
+			},
+			{
+				name:         "a function defined in a subshell",
+				inputCommand: `(f() { echo f; }; f); f`,
+				wantOutput:   "f\n",
+				wantExitCode: 127,
+				wantErr:      true,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				out, err := os.CreateTemp("", "output")
+				require.NoError(t, err)
+				defer os.Remove(out.Name())
+				defer out.Close()
+
+				cr := newCommandRunner("/home/user", false)
+				term := terminal{
+					in: input{
+						file: os.Stdin,
+					},
+					out: output{
+						file: out,
+					},
+					stdErr: output{
+						file: os.Stderr,
+					},
+				}
+				gotExitCode, gotErr := cr.run(tc.inputCommand, &term)
+				assert.Equal(t, tc.wantExitCode, gotExitCode)
+				assert.Equal(t, tc.wantErr, gotErr != nil)
+
+				gotOutput, err := os.ReadFile(out.Name())
+				require.NoError(t, err)
+				assert.Equal(t, tc.wantOutput, string(gotOutput))
+			})
+		}
+	})
+
+	t.Run("run commands with aliases", func(t *testing.T) {
+		testCases := []struct {
+			name         string
+			inputCommand string
+
+			wantOutput   string
+			wantExitCode int
+			wantErr      bool
+		}{
+			{
+				name:         "define and use an alias",
+				inputCommand: "alias e='echo a' p=printf\ne b; p c",
+				wantOutput:   "a b\nc",
+			},
+			{
+				name:         "show aliases",
+				inputCommand: `alias e='echo it'\''s' p=printf; alias; alias e`,
+				wantOutput:   "alias e='echo it'\\''s'\nalias p='printf'\nalias e='echo it'\\''s'\n",
+			},
+			{
+				name:         "an alias isn't expanded in the same line",
+				inputCommand: "alias e=echo; e a",
+				wantExitCode: 127,
+				wantErr:      true,
+			},
+			{
+				name:         "remove an alias",
+				inputCommand: "alias e=echo p=printf\nunalias e; alias",
+				wantOutput:   "alias p='printf'\n",
+			},
+			{
+				name:         "remove all aliases",
+				inputCommand: "alias e=echo p=printf\nunalias -a; alias",
+			},
+			{
+				name:         "an unknown alias",
+				inputCommand: "alias unknown",
+				wantExitCode: 1,
+				wantErr:      true,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				out, err := os.CreateTemp("", "output")
+				require.NoError(t, err)
+				defer os.Remove(out.Name())
+				defer out.Close()
+
+				cr := newCommandRunner("/home/user", false)
+				term := terminal{
+					in: input{
+						file: os.Stdin,
+					},
+					out: output{
+						file: out,
+					},
+					stdErr: output{
+						file: os.Stderr,
+					},
+				}
+				var gotExitCode int
+				var gotErr error
+				for _, line := range strings.Split(tc.inputCommand, "\n") {
+					gotExitCode, gotErr = cr.run(line, &term)
+				}
+				assert.Equal(t, tc.wantExitCode, gotExitCode)
+				assert.Equal(t, tc.wantErr, gotErr != nil)
+
+				gotOutput, err := os.ReadFile(out.Name())
+				require.NoError(t, err)
+				assert.Equal(t, tc.wantOutput, string(gotOutput))
+			})
+		}
+	})
+
+	t.Run("run commands with command substitutions", func(t *testing.T) {
+		testCases := []struct {
+			name         string
+			inputCommand string
+
+			wantOutput   string
+			wantExitCode int
+		}{
+			{
+				name:         "split an unquoted output into fields",
+				inputCommand: `printf '[%s]' $(printf 'a  b\n\n') "$(printf 'a  b\n\n')"`,
+				wantOutput:   "[a][b][a  b]",
+			},
+			{
+				name:         "backquotes",
+				inputCommand: "echo `echo a`b",
+				wantOutput:   "ab\n",
+			},
+			{
+				name:         "nested command substitutions",
+				inputCommand: `echo "$(echo "$(echo a) b")" $( (echo c) )`,
+				wantOutput:   "a b c\n",
+			},
+			{
+				name:         "a pipeline in a command substitution",
+				inputCommand: "echo $(echo a b | tr a-z A-Z)",
+				wantOutput:   "A B\n",
+			},
+			{
+				name:         "variables in a command substitution aren't changed",
+				inputCommand: "A=1; echo $(A=2; echo $A) $A",
+				wantOutput:   "2 1\n",
+			},
+			{
+				name:         "the exit status of an assignment",
+				inputCommand: "A=$(false)",
+				wantExitCode: 1,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				out, err := os.CreateTemp("", "output")
+				require.NoError(t, err)
+				defer os.Remove(out.Name())
+				defer out.Close()
+
+				cr := newCommandRunner("/home/user", false)
+				term := terminal{
+					in: input{
+						file: os.Stdin,
+					},
+					out: output{
+						file: out,
+					},
+					stdErr: output{
+						file: os.Stderr,
+					},
+				}
+				gotExitCode, gotErr := cr.run(tc.inputCommand, &term)
+				assert.Equal(t, tc.wantExitCode, gotExitCode)
+				assert.NoError(t, gotErr)
+
+				gotOutput, err := os.ReadFile(out.Name())
+				require.NoError(t, err)
+				assert.Equal(t, tc.wantOutput, string(gotOutput))
+			})
+		}
+	})
+
+	t.Run("run commands with glob patterns", func(t *testing.T) {
+		currentDirectory, err := os.Getwd()
+		require.NoError(t, err)
+		tempDir := t.TempDir()
+		for _, file := range []string{"a.log", "b.log", ".c.log", "d.txt"} {
+			require.NoError(t, os.WriteFile(tempDir+"/"+file, []byte{}, 0644))
+		}
+
+		testCases := []struct {
+			name         string
+			inputCommand string
+
+			wantOutput   string
+			wantExitCode int
+			wantErr      bool
+		}{
+			{
+				name:         "expand a pattern",
+				inputCommand: "echo *.log [d]*",
+				wantOutput:   "a.log b.log d.txt\n",
+			},
+			{
+				name:         "quoted patterns are literal",
+				inputCommand: `echo "*.log" '*'.log \*.log`,
+				wantOutput:   "*.log *.log *.log\n",
+			},
+			{
+				name:         "an unquoted variable is expanded",
+				inputCommand: `A='*.log'; echo $A "$A"`,
+				wantOutput:   "a.log b.log *.log\n",
+			},
+			{
+				name:         "a pattern without any match",
+				inputCommand: "echo *.md",
+				wantOutput:   "*.md\n",
+			},
+			{
+				name:         "nullglob",
+				inputCommand: "shopt -s nullglob; echo *.md",
+				wantOutput:   "\n",
+			},
+			{
+				name:         "failglob",
+				inputCommand: "shopt -s failglob; echo *.md",
+				wantExitCode: 1,
+				wantErr:      true,
+			},
+			{
+				name:         "dotglob",
+				inputCommand: "shopt -s dotglob; echo *.log",
+				wantOutput:   ".c.log a.log b.log\n",
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				out, err := os.CreateTemp("", "output")
+				require.NoError(t, err)
+				defer os.Remove(out.Name())
+				defer out.Close()
+
+				require.NoError(t, os.Chdir(tempDir))
+				defer os.Chdir(currentDirectory)
+
+				cr := newCommandRunner("/home/user", false)
+				term := terminal{
+					in: input{
+						file: os.Stdin,
+					},
+					out: output{
+						file: out,
+					},
+					stdErr: output{
+						file: os.Stderr,
+					},
+				}
+				gotExitCode, gotErr := cr.run(tc.inputCommand, &term)
+				assert.Equal(t, tc.wantExitCode, gotExitCode)
+				assert.Equal(t, tc.wantErr, gotErr != nil)
+
+				gotOutput, err := os.ReadFile(out.Name())
+				require.NoError(t, err)
+				assert.Equal(t, tc.wantOutput, string(gotOutput))
+			})
+		}
+	})
+
+	t.Run("run a command with redirections", func(t *testing.T) {
+		tempDir := t.TempDir()
+		testCases := []struct {
+			name         string
+			inputCommand string
+
+			wantFile     string
+			wantOutput   string
+			wantExitCode int
+			wantErr      bool
+		}{
+			{
+				name:         "write a stdout into a file",
+				inputCommand: "echo hello > " + tempDir + "/out.txt",
+				wantFile:     "hello\n",
+			},
+			{
+				name:         "append a stdout into a file",
+				inputCommand: "echo world >> " + tempDir + "/out.txt",
+				wantFile:     "hello\nworld\n",
+			},
+			{
+				name:         "read a stdin from a file",
+				inputCommand: "tr a-z A-Z < " + tempDir + "/out.txt",
+				wantFile:     "hello\nworld\n",
+				wantOutput:   "HELLO\nWORLD\n",
+			},
+			{
+				name:         "write a stderr into a file",
+				inputCommand: "ls " + tempDir + "/unknown 2>" + tempDir + "/out.txt",
+				wantExitCode: 2,
+				wantErr:      true,
+			},
+			{
+				name:         "no file for a stdin",
+				inputCommand: "cat < " + tempDir + "/unknown",
+				wantExitCode: 1,
+				wantErr:      true,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				out, err := os.CreateTemp("", "output")
+				require.NoError(t, err)
+				defer os.Remove(out.Name())
+				defer out.Close()
+
+				cr := newCommandRunner("/home/user", false)
+				term := terminal{
+					in: input{
+						file: os.Stdin,
+					},
+					out: output{
+						file: out,
+					},
+					stdErr: output{
+						file: os.Stderr,
+					},
+				}
+				gotExitCode, gotErr := cr.run(tc.inputCommand, &term)
+				assert.Equal(t, tc.wantExitCode, gotExitCode)
+				assert.Equal(t, tc.wantErr, gotErr != nil)
+
+				gotOutput, err := os.ReadFile(out.Name())
+				require.NoError(t, err)
+				assert.Equal(t, tc.wantOutput, string(gotOutput))
+				if tc.wantFile != "" {
+					gotFile, err := os.ReadFile(tempDir + "/out.txt")
+					require.NoError(t, err)
+					assert.Equal(t, tc.wantFile, string(gotFile))
+				}
+			})
+		}
+	})
+
 	t.Run("run a command", func(t *testing.T) {
 		testCases := []struct {
 			name string
@@ -143,8 +983,8 @@ func TestCommandRunner_Run(t *testing.T) {
 			mockOutput   string
 			signal       syscall.Signal
 
-			wantPanic       string
 			wantExitCode    int
+			wantJobs        int
 			wantError       error
 			wantErrorString string
 		}{
@@ -159,7 +999,7 @@ func TestCommandRunner_Run(t *testing.T) {
 				mockOutput:   "PermissionDenied",
 
 				wantExitCode:    1,
-				wantError:       &exec.ExitError{},
+				wantError:       &exitError{},
 				wantErrorString: "exit status 1",
 			},
 			{
@@ -169,7 +1009,16 @@ func TestCommandRunner_Run(t *testing.T) {
 				mockOutput:   "signal is supposed to be sent",
 				signal:       syscall.SIGINT,
 
-				wantExitCode: -1,
+				wantExitCode: 130,
+			},
+			{
+				name:         "Cancel a command substitution",
+				inputCommand: "echo $(unknown)",
+				sleepSecond:  "2",
+				mockOutput:   "signal is supposed to be sent",
+				signal:       syscall.SIGINT,
+
+				wantExitCode: 130,
 			},
 			{
 				name:         "Pause a command",
@@ -178,13 +1027,14 @@ func TestCommandRunner_Run(t *testing.T) {
 				mockOutput:   "signal is supposed to be sent",
 				signal:       syscall.SIGTSTP,
 
-				wantPanic: "Pausing a process has not been implemented yet",
+				wantExitCode: 148,
+				wantJobs:     1,
 			},
 		}
 
 		for _, tc := range testCases {
 			t.Run(tc.name, func(t *testing.T) {
-				cr := commandRunner{
+				cr := &commandRunner{
 					homeDir: "/home/user",
 					execCommandContext: func(ctx context.Context, command string, args ...string) *exec.Cmd {
 						// https://npf.io/2015/06/testing-exec-command/
@@ -221,13 +1071,6 @@ func TestCommandRunner_Run(t *testing.T) {
 						syscall.Kill(syscall.Getpid(), tc.signal)
 					}()
 				}
-				if tc.wantPanic != "" {
-					assert.PanicsWithValue(t, tc.wantPanic, func() {
-						cr.run(tc.inputCommand, &term)
-					})
-					return
-				}
-
 				got, gotErr := cr.run(tc.inputCommand, &term)
 				assert.Equal(t, tc.wantExitCode, got)
 				if tc.wantError != nil {
@@ -236,9 +1079,171 @@ func TestCommandRunner_Run(t *testing.T) {
 				} else {
 					assert.NoError(t, gotErr)
 				}
+				assert.Len(t, cr.jobs, tc.wantJobs)
+				for _, j := range cr.jobs {
+					syscall.Kill(-j.pgid, syscall.SIGKILL)
+				}
 			})
 		}
 	})
+
+	t.Run("run jobs", func(t *testing.T) {
+		out, err := os.CreateTemp("", "output")
+		require.NoError(t, err)
+		defer os.Remove(out.Name())
+		defer out.Close()
+
+		cr := newCommandRunner("/home/user", false)
+		term := terminal{
+			in: input{
+				file: os.Stdin,
+			},
+			out: output{
+				file: out,
+			},
+			stdErr: output{
+				file: out,
+			},
+		}
+		readOutput := func() string {
+			t.Helper()
+			got, err := os.ReadFile(out.Name())
+			require.NoError(t, err)
+			require.NoError(t, out.Truncate(0))
+			_, err = out.Seek(0, 0)
+			require.NoError(t, err)
+			return string(got)
+		}
+
+		gotExitCode, gotErr := cr.run("sleep 10 & sleep 0.1 | cat &", &term)
+		require.NoError(t, gotErr)
+		assert.Equal(t, 0, gotExitCode)
+		require.Len(t, cr.jobs, 2)
+		assert.Equal(t, fmt.Sprintf("[1] %d\n[2] %d\n", cr.jobs[0].pgid, cr.jobs[1].processes[1].pid), readOutput())
+
+		require.NoError(t, syscall.Kill(-cr.jobs[0].pgid, syscall.SIGSTOP))
+		time.Sleep(200 * time.Millisecond)
+		gotExitCode, gotErr = cr.run("jobs", &term)
+		require.NoError(t, gotErr)
+		assert.Equal(t, 0, gotExitCode)
+		assert.Equal(t, "[1]-  Stopped                 sleep 10\n[2]+  Done                    sleep 0.1 | cat\n", readOutput())
+		require.Len(t, cr.jobs, 1)
+
+		_, gotErr = cr.run("bg %1", &term)
+		require.NoError(t, gotErr)
+		assert.Equal(t, "[1] sleep 10 &\n", readOutput())
+
+		require.NoError(t, syscall.Kill(-cr.jobs[0].pgid, syscall.SIGTERM))
+		time.Sleep(200 * time.Millisecond)
+		cr.reportJobs(out)
+		assert.Equal(t, "[1]+  Terminated              sleep 10\n", readOutput())
+		assert.Empty(t, cr.jobs)
+
+		_, gotErr = cr.run("fg", &term)
+		assert.EqualError(t, gotErr, "%+: no such job")
+	})
+
+	t.Run("run a job in the background without a terminal", func(t *testing.T) {
+		out, err := os.CreateTemp("", "output")
+		require.NoError(t, err)
+		defer os.Remove(out.Name())
+		defer out.Close()
+
+		cr := newCommandRunner("/home/user", false)
+		cr.isNonInteractive = true
+		gotExitCode, gotErr := cr.runInput("sleep 0.1 & wait", [3]*os.File{os.Stdin, out, out})
+		require.NoError(t, gotErr)
+		assert.Equal(t, 0, gotExitCode)
+
+		got, err := os.ReadFile(out.Name())
+		require.NoError(t, err)
+		assert.Empty(t, string(got))
+	})
+}
+
+func TestCommandRunner_InShellPipelineStops(t *testing.T) {
+	testCases := []struct {
+		name         string
+		inputCommand string
+
+		wantOutput   string
+		wantExitCode int
+	}{
+		{
+			name:         "while stops when the next command exits",
+			inputCommand: `while true; do echo y; done | head -1`,
+			wantOutput:   "y\n",
+			wantExitCode: exitCodeBrokenPipe,
+		},
+		{
+			name:         "for stops when the next command exits",
+			inputCommand: `for i in 1 2 3; do while :; do echo $i; done; done | head -1`,
+			wantOutput:   "1\n",
+			wantExitCode: exitCodeBrokenPipe,
+		},
+		{
+			name:         "a function stops when the next command exits",
+			inputCommand: `f() { while :; do echo $1; done; echo unreachable >&2; }; f a | head -1`,
+			wantOutput:   "a\n",
+			wantExitCode: exitCodeBrokenPipe,
+		},
+		{
+			name:         "pwd stops a loop when the next command exits",
+			inputCommand: `cd /; while :; do pwd; done | head -1`,
+			wantOutput:   "/\n",
+			wantExitCode: exitCodeBrokenPipe,
+		},
+		{
+			name:         "type stops a loop when the next command exits",
+			inputCommand: `while :; do type -t cd; done | head -1`,
+			wantOutput:   "builtin\n",
+			wantExitCode: exitCodeBrokenPipe,
+		},
+		{
+			name:         "alias stops a loop when the next command exits",
+			inputCommand: `alias ll='ls -l'; while :; do alias; done | head -1`,
+			wantOutput:   "alias ll='ls -l'\n",
+			wantExitCode: exitCodeBrokenPipe,
+		},
+		{
+			name:         "a loop stops when Ctrl-C terminates the next command",
+			inputCommand: `while :; do :; done | sh -c 'kill -INT $$'`,
+			wantExitCode: exitCodeInterrupted,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := os.CreateTemp("", "output")
+			require.NoError(t, err)
+			defer os.Remove(out.Name())
+			defer out.Close()
+			errorOut, err := os.CreateTemp("", "error")
+			require.NoError(t, err)
+			defer os.Remove(errorOut.Name())
+			defer errorOut.Close()
+
+			cr := newCommandRunner("/home/user", true)
+			done := make(chan int, 1)
+			go func() {
+				exitCode, _ := cr.runInput(tc.inputCommand, [3]*os.File{os.Stdin, out, errorOut})
+				done <- exitCode
+			}()
+			select {
+			case gotExitCode := <-done:
+				assert.Equal(t, tc.wantExitCode, gotExitCode)
+			case <-time.After(5 * time.Second):
+				require.FailNow(t, "the pipeline didn't stop")
+			}
+
+			gotOutput, err := os.ReadFile(out.Name())
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantOutput, string(gotOutput))
+			// A broken pipe isn't written as an error
+			gotErrorOutput, err := os.ReadFile(errorOut.Name())
+			require.NoError(t, err)
+			assert.Empty(t, string(gotErrorOutput))
+		})
+	}
 }
 
 func TestCommandRunner_RunHelperProcess(t *testing.T) {
@@ -17,9 +17,10 @@ type commandSuggester struct {
 	plugins       map[string]plugin.Plugin
 	defaultPlugin plugin.Plugin
 	historyPlugin plugin.Plugin
+	aliases       map[string]string
 }
 
-func newCommandSuggester(history *config.History, homeDir string, logger *zap.Logger) (commandSuggester, error) {
+func newCommandSuggester(history *config.History, homeDir string, aliases map[string]string, getDirectoryStack func() []string, logger *zap.Logger) (commandSuggester, error) {
 	tcellCompletionUi, err := completion.NewTcellCompletion()
 	if err != nil {
 		return commandSuggester{}, err
@@ -36,8 +37,9 @@ func newCommandSuggester(history *config.History, homeDir string, logger *zap.Lo
 	return commandSuggester{
 		history:       history,
 		plugins:       plugins,
-		defaultPlugin: plugin.NewDefaultPlugin(tcellCompletionUi, homeDir),
+		defaultPlugin: plugin.NewDefaultPlugin(tcellCompletionUi, homeDir, getDirectoryStack),
 		historyPlugin: plugin.NewHistoryPlugin(plugins, tcellCompletionUi, logger),
+		aliases:       aliases,
 	}, nil
 }
 
@@ -45,11 +47,16 @@ func (s commandSuggester) suggestHistory(args plugin.SuggestArg) ([]string, erro
 	return s.historyPlugin.Suggest(args)
 }
 
-func (s commandSuggester) suggestCommand(inputCommand string, pluginArgs plugin.SuggestArg) ([]string, error) {
-	args := strings.Fields(inputCommand)
+func (s commandSuggester) suggestCommand(pluginArgs plugin.SuggestArg) ([]string, error) {
+	args := pluginArgs.Args
 	if len(args) == 0 {
 		return s.defaultPlugin.Suggest(pluginArgs)
 	}
+	// Expand an alias only after its name is typed completely
+	if len(args) > 1 || pluginArgs.CurrentArgToken == "" {
+		args = expandAlias(s.aliases, args)
+		pluginArgs.Args = args
+	}
 
 	suggestPlugin, ok := s.plugins[args[0]]
 	if !ok {
@@ -64,6 +71,10 @@ func (s commandSuggester) getContext(command string) (map[string]string, error)
 	if len(args) == 0 {
 		return nil, nil
 	}
+	if expanded := expandAlias(s.aliases, args); len(expanded) > 0 && expanded[0] != args[0] {
+		args = expanded
+		command = strings.Join(args, " ")
+	}
 
 	suggestPlugin, ok := s.plugins[args[0]]
 	if !ok {
@@ -0,0 +1,397 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/at-ishikawa/go-shell/internal/expansion"
+	"github.com/at-ishikawa/go-shell/internal/syntax"
+)
+
+// maxFunctionDepth is the limit of nested function calls to avoid a stack overflow by an infinite recursion
+const maxFunctionDepth = 1000
+
+type flowKind int
+
+const (
+	flowNone flowKind = iota
+	flowBreak
+	flowContinue
+	flowReturn
+	flowExit
+)
+
+// flowControl is break, continue, return or exit in progress, which skips the remaining commands
+type flowControl struct {
+	kind flowKind
+	// count is the number of loops which break or continue exits
+	count int
+	// exitCode is the exit status of a function for return, or the one of the shell for exit
+	exitCode int
+}
+
+// runCompoundCommand runs a compound command or defines a function in the shell process
+func (cr *commandRunner) runCompoundCommand(command syntax.Command, stdioFiles [3]*os.File) (int, error) {
+	switch c := command.(type) {
+	case *syntax.Subshell:
+		return cr.runSubshell(c, stdioFiles)
+	case *syntax.BraceGroup:
+		return cr.runWithRedirections(c.Redirections, stdioFiles, func(files [3]*os.File) (int, error) {
+			return cr.runList(c.List, files)
+		})
+	case *syntax.IfClause:
+		return cr.runWithRedirections(c.Redirections, stdioFiles, func(files [3]*os.File) (int, error) {
+			return cr.runIfClause(c, files)
+		})
+	case *syntax.ForClause:
+		return cr.runWithRedirections(c.Redirections, stdioFiles, func(files [3]*os.File) (int, error) {
+			return cr.runForClause(c, files)
+		})
+	case *syntax.WhileClause:
+		return cr.runWithRedirections(c.Redirections, stdioFiles, func(files [3]*os.File) (int, error) {
+			return cr.runWhileClause(c, files)
+		})
+	case *syntax.CaseClause:
+		return cr.runWithRedirections(c.Redirections, stdioFiles, func(files [3]*os.File) (int, error) {
+			return cr.runCaseClause(c, files)
+		})
+	case *syntax.FunctionDefinition:
+		cr.functions[c.Name] = c
+		return 0, nil
+	}
+	return 1, fmt.Errorf("unsupported command: %T", command)
+}
+
+// compoundCommandName returns a short name of a compound command shown in jobs and errors
+func compoundCommandName(command syntax.Command) string {
+	switch c := command.(type) {
+	case *syntax.Subshell:
+		return "( ... )"
+	case *syntax.BraceGroup:
+		return "{ ... }"
+	case *syntax.IfClause:
+		return "if ..."
+	case *syntax.ForClause:
+		return "for " + c.Name + " ..."
+	case *syntax.WhileClause:
+		if c.IsUntil {
+			return "until ..."
+		}
+		return "while ..."
+	case *syntax.CaseClause:
+		return "case ..."
+	case *syntax.FunctionDefinition:
+		return c.Name + "() ..."
+	}
+	return fmt.Sprintf("%T", command)
+}
+
+// runWithRedirections runs a command in the shell process with redirections
+func (cr *commandRunner) runWithRedirections(redirections []*syntax.Redirection, stdioFiles [3]*os.File, run func(files [3]*os.File) (int, error)) (int, error) {
+	expanded, err := cr.expandRedirections(redirections)
+	if err != nil {
+		return 1, err
+	}
+	files, openedFiles, err := applyRedirections(stdioFiles, expanded)
+	if err != nil {
+		return 1, err
+	}
+	parentStdioFiles := cr.stdioFiles
+	defer func() {
+		cr.stdioFiles = parentStdioFiles
+		for _, f := range openedFiles {
+			f.Close()
+		}
+	}()
+	cr.stdioFiles = files
+	return run(files)
+}
+
+// runCondition runs a condition of if, while or until.
+// A failure of a condition isn't an error, so it's not returned
+func (cr *commandRunner) runCondition(condition *syntax.List, stdioFiles [3]*os.File) int {
+	exitCode, err := cr.runList(condition, stdioFiles)
+	var exitErr *exitError
+	if err != nil && !errors.As(err, &exitErr) {
+		fmt.Fprintln(stdioFiles[2], err)
+	}
+	return exitCode
+}
+
+func (cr *commandRunner) runIfClause(clause *syntax.IfClause, stdioFiles [3]*os.File) (int, error) {
+	for i, condition := range clause.Conditions {
+		exitCode := cr.runCondition(condition, stdioFiles)
+		if cr.flow.kind != flowNone || exitCode == exitCodeInterrupted {
+			return exitCode, nil
+		}
+		if exitCode == 0 {
+			return cr.runList(clause.Bodies[i], stdioFiles)
+		}
+	}
+	if clause.Else != nil {
+		return cr.runList(clause.Else, stdioFiles)
+	}
+	return 0, nil
+}
+
+func (cr *commandRunner) runForClause(clause *syntax.ForClause, stdioFiles [3]*os.File) (int, error) {
+	values := cr.positionalParameters
+	if clause.HasIn {
+		values = nil
+		for _, word := range clause.Words {
+			fields, err := cr.expandWord(word)
+			if err != nil {
+				if errors.Is(err, errInterrupted) {
+					return exitCodeInterrupted, nil
+				}
+				return 1, err
+			}
+			values = append(values, fields...)
+		}
+	}
+
+	isInterrupted, stop := cr.watchInterrupt()
+	defer stop()
+	cr.loopDepth++
+	defer func() {
+		cr.loopDepth--
+	}()
+
+	var exitCode int
+	var err error
+	for _, value := range values {
+		if err != nil {
+			fmt.Fprintln(stdioFiles[2], err)
+		}
+		if err := cr.setVariable(clause.Name, value); err != nil {
+			return 1, err
+		}
+		exitCode, err = cr.runList(clause.Body, stdioFiles)
+		if exitCode == exitCodeInterrupted || isInterrupted() {
+			return exitCodeInterrupted, err
+		}
+		if cr.isLoopExited() {
+			break
+		}
+	}
+	return exitCode, err
+}
+
+func (cr *commandRunner) runWhileClause(clause *syntax.WhileClause, stdioFiles [3]*os.File) (int, error) {
+	isInterrupted, stop := cr.watchInterrupt()
+	defer stop()
+	cr.loopDepth++
+	defer func() {
+		cr.loopDepth--
+	}()
+
+	var exitCode int
+	var err error
+	for {
+		conditionExitCode := cr.runCondition(clause.Condition, stdioFiles)
+		if conditionExitCode == exitCodeInterrupted || isInterrupted() {
+			return exitCodeInterrupted, err
+		}
+		if cr.flow.kind != flowNone {
+			if cr.isLoopExited() {
+				break
+			}
+			continue
+		}
+		// while runs the body if the condition succeeded, and until does if it failed
+		if (conditionExitCode == 0) == clause.IsUntil {
+			break
+		}
+
+		if err != nil {
+			fmt.Fprintln(stdioFiles[2], err)
+		}
+		exitCode, err = cr.runList(clause.Body, stdioFiles)
+		if exitCode == exitCodeInterrupted || isInterrupted() {
+			return exitCodeInterrupted, err
+		}
+		if cr.isLoopExited() {
+			break
+		}
+	}
+	return exitCode, err
+}
+
+// isLoopExited consumes break or continue for the current loop, and returns true if the loop should exit
+func (cr *commandRunner) isLoopExited() bool {
+	switch cr.flow.kind {
+	case flowBreak:
+		cr.flow.count--
+		if cr.flow.count <= 0 {
+			cr.flow = flowControl{}
+		}
+		return true
+	case flowContinue:
+		cr.flow.count--
+		if cr.flow.count <= 0 {
+			cr.flow = flowControl{}
+			return false
+		}
+		return true
+	case flowReturn, flowExit:
+		return true
+	}
+	return false
+}
+
+// watchInterrupt watches Ctrl-C while the shell is in the foreground, like a loop only with builtins.
+// A subshell in a pipeline is interrupted by the shell as well
+func (cr *commandRunner) watchInterrupt() (func() bool, func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT)
+	isInterrupted := func() bool {
+		select {
+		case <-signals:
+			return true
+		case <-cr.interrupt:
+			return true
+		default:
+			return false
+		}
+	}
+	return isInterrupted, func() {
+		signal.Stop(signals)
+	}
+}
+
+func (cr *commandRunner) runCaseClause(clause *syntax.CaseClause, stdioFiles [3]*os.File) (int, error) {
+	value, err := cr.expandString(cr.expandTilde(clause.Word, false))
+	if err != nil {
+		if errors.Is(err, errInterrupted) {
+			return exitCodeInterrupted, nil
+		}
+		return 1, err
+	}
+	for _, item := range clause.Items {
+		for _, pattern := range item.Patterns {
+			expanded, err := cr.expandPattern(pattern)
+			if err != nil {
+				return 1, err
+			}
+			if expansion.MatchPattern(expanded, value) {
+				return cr.runList(item.Body, stdioFiles)
+			}
+		}
+	}
+	return 0, nil
+}
+
+// callFunction runs a function with arguments as positional parameters
+func (cr *commandRunner) callFunction(function *syntax.FunctionDefinition, command pipelineCommand, stdioFiles [3]*os.File) (int, error) {
+	if cr.functionDepth >= maxFunctionDepth {
+		return 1, fmt.Errorf("%s: maximum function nesting level exceeded (%d)", function.Name, maxFunctionDepth)
+	}
+	files, openedFiles, err := applyRedirections(stdioFiles, command.redirections)
+	if err != nil {
+		return 1, err
+	}
+	defer func() {
+		for _, f := range openedFiles {
+			f.Close()
+		}
+	}()
+
+	// Assignments before a function name are exported only while the function runs
+	restoreEnv, err := cr.setTemporaryEnv(command.env)
+	if err != nil {
+		return 1, err
+	}
+	defer restoreEnv()
+
+	positionalParameters := cr.positionalParameters
+	cr.positionalParameters = command.args
+	cr.functionDepth++
+	defer func() {
+		cr.positionalParameters = positionalParameters
+		cr.functionDepth--
+	}()
+
+	exitCode, err := cr.runCompoundCommand(function.Body, files)
+	if cr.flow.kind == flowReturn {
+		exitCode = cr.flow.exitCode
+		cr.flow = flowControl{}
+	}
+	return exitCode, err
+}
+
+func (cr *commandRunner) setTemporaryEnv(env []string) (func(), error) {
+	type savedEnv struct {
+		value string
+		isSet bool
+	}
+	saved := make(map[string]savedEnv, len(env))
+	restore := func() {
+		for name, s := range saved {
+			if s.isSet {
+				cr.setEnv(name, s.value)
+			} else {
+				cr.unsetEnv(name)
+			}
+		}
+	}
+	for _, e := range env {
+		name, value, _ := strings.Cut(e, "=")
+		if _, ok := saved[name]; !ok {
+			previous, isSet := cr.lookupEnv(name)
+			saved[name] = savedEnv{value: previous, isSet: isSet}
+		}
+		if err := cr.setEnv(name, value); err != nil {
+			restore()
+			return nil, err
+		}
+	}
+	return restore, nil
+}
+
+// loopControl runs break or continue
+func (cr *commandRunner) loopControl(name string, args []string) error {
+	if cr.loopDepth == 0 {
+		return fmt.Errorf("%s: only meaningful in a `for', `while', or `until' loop", name)
+	}
+	count := 1
+	if len(args) > 0 {
+		var err error
+		count, err = strconv.Atoi(args[0])
+		if err != nil || count < 1 {
+			return fmt.Errorf("%s: %s: loop count out of range", name, args[0])
+		}
+	}
+	if count > cr.loopDepth {
+		count = cr.loopDepth
+	}
+
+	kind := flowBreak
+	if name == "continue" {
+		kind = flowContinue
+	}
+	cr.flow = flowControl{kind: kind, count: count}
+	return nil
+}
+
+// returnFunction runs return, which exits a function or a sourced file with an exit status, or $? by default
+func (cr *commandRunner) returnFunction(args []string) (int, error) {
+	if cr.functionDepth == 0 && cr.sourceDepth == 0 {
+		return 1, errors.New("return: can only `return' from a function or sourced script")
+	}
+	exitCode := cr.lastExitCode
+	if len(args) > 0 {
+		var err error
+		exitCode, err = strconv.Atoi(args[0])
+		if err != nil {
+			return 2, fmt.Errorf("return: %s: numeric argument required", args[0])
+		}
+		exitCode &= 0xff
+	}
+	cr.flow = flowControl{kind: flowReturn, exitCode: exitCode}
+	return exitCode, nil
+}
@@ -0,0 +1,391 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/at-ishikawa/go-shell/internal/completion"
+	"github.com/at-ishikawa/go-shell/internal/config"
+	"github.com/at-ishikawa/go-shell/internal/expansion"
+	"github.com/at-ishikawa/go-shell/internal/syntax"
+	"go.uber.org/zap"
+)
+
+// changeDir runs the cd command.
+// cd - changes to $OLDPWD and writes the new directory
+func (cr *commandRunner) changeDir(args []string, stdout *os.File) error {
+	dir := cr.homeDir
+	if len(args) >= 1 {
+		dir = args[0]
+	}
+	if dir != "-" {
+		return cr.setCurrentDir(dir)
+	}
+
+	oldDir, ok := cr.getVariable("OLDPWD")
+	if !ok || oldDir == "" {
+		return errors.New("cd: OLDPWD not set")
+	}
+	if err := cr.setCurrentDir(oldDir); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(stdout, oldDir); err != nil {
+		return fmt.Errorf("cd: %w", err)
+	}
+	return nil
+}
+
+// setCurrentDir changes the current directory and updates PWD and OLDPWD.
+// The directory is recorded into the directory history for z
+func (cr *commandRunner) setCurrentDir(dir string) error {
+	previousDir, previousErr := cr.currentDir()
+	if err := cr.chdir(dir); err != nil {
+		return err
+	}
+	if previousErr == nil {
+		if err := cr.setEnv("OLDPWD", previousDir); err != nil {
+			return err
+		}
+	}
+	currentDir, err := cr.currentDir()
+	if err != nil {
+		return nil
+	}
+	if cr.directoryHistory != nil {
+		if err := cr.directoryHistory.Visit(currentDir, time.Now()); err != nil {
+			zap.L().Error("Failed to record a directory", zap.Error(err))
+		}
+	}
+	return cr.setEnv("PWD", currentDir)
+}
+
+// findAutoCdDir returns a directory if a command is only the path of a directory, which isn't a command.
+// In an interactive shell, the shell changes to it like cd
+func (cr *commandRunner) findAutoCdDir(command pipelineCommand) (string, bool) {
+	if cr.isNonInteractive || len(command.args) > 0 || len(command.env) > 0 || cr.isInShellCommand(command) {
+		return "", false
+	}
+	if _, err := exec.LookPath(command.command); err == nil {
+		return "", false
+	}
+	if info, err := os.Stat(command.command); err != nil || !info.IsDir() {
+		return "", false
+	}
+	return command.command, true
+}
+
+// historyCommand returns a command stored into a history for an input.
+// An input changing the directory by auto-cd is stored as cd dir
+func (cr *commandRunner) historyCommand(inputCommand string) string {
+	if cr.autoCdDir == "" {
+		return inputCommand
+	}
+	list, err := syntax.Parse(inputCommand)
+	if err != nil || len(list.Items) != 1 || len(list.Items[0].Pipelines) != 1 {
+		return inputCommand
+	}
+	commands := list.Items[0].Pipelines[0].Commands
+	if len(commands) != 1 {
+		return inputCommand
+	}
+	simpleCommand, ok := commands[0].(*syntax.SimpleCommand)
+	if !ok || len(simpleCommand.Words) != 1 || len(simpleCommand.Assignments) > 0 {
+		return inputCommand
+	}
+	return "cd " + inputCommand
+}
+
+// directories returns the directory stack, where the first one is the current directory
+func (cr *commandRunner) directories() []string {
+	currentDir, err := cr.currentDir()
+	if err != nil {
+		currentDir, _ = cr.lookupEnv("PWD")
+	}
+	return append([]string{currentDir}, cr.directoryStack...)
+}
+
+// historyLocation returns the current directory and the root of its git repository to rank commands in a history
+func (cr *commandRunner) historyLocation() config.HistoryLocation {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return config.HistoryLocation{}
+	}
+	return config.HistoryLocation{
+		Dir:           currentDir,
+		RepositoryDir: findRepositoryDir(currentDir),
+	}
+}
+
+// findRepositoryDir returns the nearest directory with .git from dir to the root, or an empty string
+func findRepositoryDir(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// parseStackIndex parses +N, which is the Nth directory from the top of a stack, or -N from the bottom.
+// A number without a sign is the same as +N
+func parseStackIndex(arg string, size int) (int, bool) {
+	isFromBottom := strings.HasPrefix(arg, "-")
+	number := strings.TrimLeft(arg, "+-")
+	if len(arg)-len(number) > 1 || number == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 0 || n >= size {
+		return 0, false
+	}
+	if isFromBottom {
+		return size - 1 - n, true
+	}
+	return n, true
+}
+
+// isStackIndex returns true if an argument looks like +N or -N instead of a directory
+func isStackIndex(arg string) bool {
+	if len(arg) < 2 || (arg[0] != '+' && arg[0] != '-') {
+		return false
+	}
+	_, err := strconv.Atoi(arg[1:])
+	return err == nil
+}
+
+// tildeDir returns a directory for a tilde prefix.
+// In addition to ~ and ~user, ~+ is $PWD, ~- is $OLDPWD, and ~N, ~+N and ~-N are entries of the directory stack
+func (cr *commandRunner) tildeDir(tildePrefix string) (string, bool) {
+	switch tildePrefix {
+	case "~+":
+		return cr.getVariable("PWD")
+	case "~-":
+		return cr.getVariable("OLDPWD")
+	}
+	if len(tildePrefix) > 1 {
+		directories := cr.directories()
+		if index, ok := parseStackIndex(tildePrefix[1:], len(directories)); ok {
+			return directories[index], true
+		}
+	}
+	return expansion.HomeDir(tildePrefix, cr.homeDir)
+}
+
+// pushDir runs the pushd command, which adds a directory to the top of the stack and changes to it.
+// Without arguments, it exchanges the top two directories, and +N or -N rotates the stack
+func (cr *commandRunner) pushDir(args []string, stdout *os.File) error {
+	directories := cr.directories()
+	switch {
+	case len(args) == 0:
+		if len(directories) < 2 {
+			return errors.New("pushd: no other directory")
+		}
+		if err := cr.setCurrentDir(directories[1]); err != nil {
+			return fmt.Errorf("pushd: %w", err)
+		}
+		cr.directoryStack[0] = directories[0]
+	case isStackIndex(args[0]):
+		index, ok := parseStackIndex(args[0], len(directories))
+		if !ok {
+			return fmt.Errorf("pushd: %s: directory stack index out of range", args[0])
+		}
+		rotated := append(append([]string{}, directories[index:]...), directories[:index]...)
+		if err := cr.setCurrentDir(rotated[0]); err != nil {
+			return fmt.Errorf("pushd: %w", err)
+		}
+		cr.directoryStack = rotated[1:]
+	default:
+		if err := cr.setCurrentDir(args[0]); err != nil {
+			return fmt.Errorf("pushd: %w", err)
+		}
+		cr.directoryStack = directories
+	}
+	if err := cr.writeDirectories(stdout, false, false); err != nil {
+		return fmt.Errorf("pushd: %w", err)
+	}
+	return nil
+}
+
+// popDir runs the popd command, which removes the top directory from the stack and changes to the next one.
+// +N or -N removes the Nth directory instead
+func (cr *commandRunner) popDir(args []string, stdout *os.File) error {
+	if len(cr.directoryStack) == 0 {
+		return errors.New("popd: directory stack empty")
+	}
+	index := 0
+	if len(args) > 0 {
+		if !isStackIndex(args[0]) {
+			return fmt.Errorf("popd: %s: invalid argument", args[0])
+		}
+		var ok bool
+		index, ok = parseStackIndex(args[0], len(cr.directoryStack)+1)
+		if !ok {
+			return fmt.Errorf("popd: %s: directory stack index out of range", args[0])
+		}
+	}
+
+	if index == 0 {
+		if err := cr.setCurrentDir(cr.directoryStack[0]); err != nil {
+			return fmt.Errorf("popd: %w", err)
+		}
+		cr.directoryStack = cr.directoryStack[1:]
+	} else {
+		cr.directoryStack = append(cr.directoryStack[:index-1:index-1], cr.directoryStack[index:]...)
+	}
+	if err := cr.writeDirectories(stdout, false, false); err != nil {
+		return fmt.Errorf("popd: %w", err)
+	}
+	return nil
+}
+
+// listDirs runs the dirs command.
+// -c clears the stack, -l doesn't abbreviate the home directory, -p writes a directory per line,
+// and -v writes it with its index
+func (cr *commandRunner) listDirs(args []string, stdout *os.File) error {
+	isLong := false
+	isVerbose := false
+	isPerLine := false
+	for _, arg := range args {
+		switch arg {
+		case "-c":
+			cr.directoryStack = nil
+			return nil
+		case "-l":
+			isLong = true
+		case "-v":
+			isVerbose = true
+		case "-p":
+			isPerLine = true
+		default:
+			return fmt.Errorf("dirs: %s: invalid option", arg)
+		}
+	}
+	if isVerbose {
+		for i, dir := range cr.directories() {
+			if _, err := fmt.Fprintf(stdout, "%2d  %s\n", i, cr.displayDir(dir, isLong)); err != nil {
+				return fmt.Errorf("dirs: %w", err)
+			}
+		}
+		return nil
+	}
+	if err := cr.writeDirectories(stdout, isLong, isPerLine); err != nil {
+		return fmt.Errorf("dirs: %w", err)
+	}
+	return nil
+}
+
+func (cr *commandRunner) writeDirectories(stdout *os.File, isLong bool, isPerLine bool) error {
+	directories := cr.directories()
+	for i, dir := range directories {
+		directories[i] = cr.displayDir(dir, isLong)
+	}
+	separator := " "
+	if isPerLine {
+		separator = "\n"
+	}
+	_, err := fmt.Fprintln(stdout, strings.Join(directories, separator))
+	return err
+}
+
+// displayDir abbreviates the home directory to ~ unless isLong is true
+func (cr *commandRunner) displayDir(dir string, isLong bool) string {
+	if isLong || cr.homeDir == "" {
+		return dir
+	}
+	if dir == cr.homeDir {
+		return "~"
+	}
+	if strings.HasPrefix(dir, cr.homeDir+"/") {
+		return "~" + dir[len(cr.homeDir):]
+	}
+	return dir
+}
+
+// getDirectoryStack returns a copy of the directory stack except the current directory
+func (cr *commandRunner) getDirectoryStack() []string {
+	return append([]string{}, cr.directoryStack...)
+}
+
+// jumpDir runs the z command, which changes to the directory with the highest frecency
+// among visited directories matching fragments.
+// With -i or without fragments, directories are chosen interactively
+func (cr *commandRunner) jumpDir(args []string, stdout *os.File) error {
+	if cr.directoryHistory == nil {
+		return errors.New("z: no directory history")
+	}
+	isInteractive := len(args) == 0
+	if len(args) > 0 && args[0] == "-i" {
+		isInteractive = true
+		args = args[1:]
+	}
+	if err := cr.directoryHistory.LoadFile(); err != nil {
+		return fmt.Errorf("z: %w", err)
+	}
+
+	currentDir, _ := cr.currentDir()
+	var directories []string
+	for _, dir := range cr.directoryHistory.Rank(args, time.Now()) {
+		if dir == currentDir {
+			continue
+		}
+		if info, err := os.Stat(cr.absPath(dir)); err != nil || !info.IsDir() {
+			continue
+		}
+		directories = append(directories, dir)
+	}
+	if len(directories) == 0 {
+		return fmt.Errorf("z: %s: no matching directory", strings.Join(args, " "))
+	}
+	if !isInteractive {
+		return cr.setCurrentDir(directories[0])
+	}
+
+	if cr.completionUi == nil {
+		return errors.New("z: -i: no terminal")
+	}
+	dir, err := cr.completionUi.Complete(directories, completion.CompleteOptions{
+		PreviewCommand: func(row int) (string, error) {
+			return previewDir(directories[row])
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("z: %w", err)
+	}
+	if dir == "" {
+		return nil
+	}
+	if err := cr.setCurrentDir(dir); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(stdout, dir); err != nil {
+		return fmt.Errorf("z: %w", err)
+	}
+	return nil
+}
+
+// previewDir returns entries in a directory, where directories end with a slash
+func previewDir(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, "\n"), nil
+}
@@ -0,0 +1,239 @@
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/at-ishikawa/go-shell/internal/completion"
+	"github.com/at-ishikawa/go-shell/internal/config"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandRunner_JumpDir(t *testing.T) {
+	// Temporary directories can be symbolic links like /tmp on macOS
+	tempDir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	srcDir := filepath.Join(tempDir, "src")
+	shellDir := filepath.Join(srcDir, "go-shell")
+	docsDir := filepath.Join(tempDir, "docs")
+	for _, dir := range []string{shellDir, docsDir} {
+		require.NoError(t, os.MkdirAll(dir, 0755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(shellDir, "main.go"), nil, 0644))
+
+	testCases := []struct {
+		name             string
+		args             []string
+		mockCompletionUi func(mockController *gomock.Controller) completion.Completion
+
+		wantDir    string
+		wantOutput string
+		wantErr    bool
+	}{
+		{
+			name:    "the best match",
+			args:    []string{"src"},
+			wantDir: shellDir,
+		},
+		{
+			name:    "fragments",
+			args:    []string{"d", "cs"},
+			wantDir: docsDir,
+		},
+		{
+			name:    "no match",
+			args:    []string{"unknown"},
+			wantDir: tempDir,
+			wantErr: true,
+		},
+		{
+			name: "choose a directory interactively",
+			args: []string{"-i", "src"},
+			mockCompletionUi: func(mockController *gomock.Controller) completion.Completion {
+				mockCompletionUi := completion.NewMockCompletion(mockController)
+				mockCompletionUi.EXPECT().
+					Complete([]string{shellDir, srcDir}, gomock.Any()).
+					DoAndReturn(func(rows []string, options completion.CompleteOptions) (string, error) {
+						preview, err := options.PreviewCommand(0)
+						assert.NoError(t, err)
+						assert.Equal(t, "main.go", preview)
+						return rows[1], nil
+					})
+				return mockCompletionUi
+			},
+			wantDir:    srcDir,
+			wantOutput: srcDir + "\n",
+		},
+		{
+			name: "cancel choosing a directory",
+			mockCompletionUi: func(mockController *gomock.Controller) completion.Completion {
+				mockCompletionUi := completion.NewMockCompletion(mockController)
+				mockCompletionUi.EXPECT().Complete(gomock.Any(), gomock.Any()).Return("", nil)
+				return mockCompletionUi
+			},
+			wantDir: tempDir,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			currentDir, err := os.Getwd()
+			require.NoError(t, err)
+			defer os.Chdir(currentDir)
+			require.NoError(t, os.Chdir(tempDir))
+
+			conf, err := config.NewConfig(t.TempDir())
+			require.NoError(t, err)
+			directoryHistory := config.NewDirectoryHistory(conf)
+			now := time.Now()
+			require.NoError(t, directoryHistory.Visit(srcDir, now.Add(-time.Minute)))
+			require.NoError(t, directoryHistory.Visit(shellDir, now.Add(-time.Minute)))
+			require.NoError(t, directoryHistory.Visit(shellDir, now))
+			require.NoError(t, directoryHistory.Visit(docsDir, now))
+
+			out, err := os.CreateTemp("", "output")
+			require.NoError(t, err)
+			defer os.Remove(out.Name())
+			defer out.Close()
+
+			mockController := gomock.NewController(t)
+			defer mockController.Finish()
+			cr := newCommandRunner("/home/user", false)
+			cr.directoryHistory = &directoryHistory
+			if tc.mockCompletionUi != nil {
+				cr.completionUi = tc.mockCompletionUi(mockController)
+			}
+			gotErr := cr.jumpDir(tc.args, out)
+			assert.Equal(t, tc.wantErr, gotErr != nil)
+
+			gotDir, err := os.Getwd()
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantDir, gotDir)
+			gotOutput, err := os.ReadFile(out.Name())
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantOutput, string(gotOutput))
+		})
+	}
+}
+
+func TestCommandRunner_AutoCd(t *testing.T) {
+	// Temporary directories can be symbolic links like /tmp on macOS
+	tempDir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(srcDir, 0755))
+
+	testCases := []struct {
+		name             string
+		inputCommand     string
+		isNonInteractive bool
+
+		wantDir            string
+		wantHistoryCommand string
+		wantErr            bool
+	}{
+		{
+			name:               "a directory",
+			inputCommand:       "src",
+			wantDir:            srcDir,
+			wantHistoryCommand: "cd src",
+		},
+		{
+			name:               "a directory in a list",
+			inputCommand:       "./src && pwd",
+			wantDir:            srcDir,
+			wantHistoryCommand: "./src && pwd",
+		},
+		{
+			name:               "a directory with an argument",
+			inputCommand:       "src a",
+			wantDir:            tempDir,
+			wantHistoryCommand: "src a",
+			wantErr:            true,
+		},
+		{
+			name:               "a builtin instead of a directory",
+			inputCommand:       "mkdir true && true",
+			wantDir:            tempDir,
+			wantHistoryCommand: "mkdir true && true",
+		},
+		{
+			name:               "a non-interactive shell",
+			inputCommand:       "src",
+			isNonInteractive:   true,
+			wantDir:            tempDir,
+			wantHistoryCommand: "src",
+			wantErr:            true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			currentDir, err := os.Getwd()
+			require.NoError(t, err)
+			defer os.Chdir(currentDir)
+			require.NoError(t, os.Chdir(tempDir))
+
+			out, err := os.CreateTemp("", "output")
+			require.NoError(t, err)
+			defer os.Remove(out.Name())
+			defer out.Close()
+
+			cr := newCommandRunner("/home/user", false)
+			cr.isNonInteractive = tc.isNonInteractive
+			_, gotErr := cr.runInput(tc.inputCommand, [3]*os.File{os.Stdin, out, out})
+			assert.Equal(t, tc.wantErr, gotErr != nil)
+			assert.Equal(t, tc.wantHistoryCommand, cr.historyCommand(tc.inputCommand))
+
+			gotDir, err := os.Getwd()
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantDir, gotDir)
+		})
+	}
+}
+
+func TestCommandRunner_HistoryLocation(t *testing.T) {
+	// Temporary directories can be symbolic links like /tmp on macOS
+	tempDir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	repoDir := filepath.Join(tempDir, "repo")
+	require.NoError(t, os.MkdirAll(filepath.Join(repoDir, ".git"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(repoDir, "internal", "shell"), 0755))
+
+	testCases := []struct {
+		name string
+		dir  string
+		want config.HistoryLocation
+	}{
+		{
+			name: "the root of a repository",
+			dir:  repoDir,
+			want: config.HistoryLocation{Dir: repoDir, RepositoryDir: repoDir},
+		},
+		{
+			name: "a subdirectory of a repository",
+			dir:  filepath.Join(repoDir, "internal", "shell"),
+			want: config.HistoryLocation{Dir: filepath.Join(repoDir, "internal", "shell"), RepositoryDir: repoDir},
+		},
+		{
+			name: "outside of a repository",
+			dir:  tempDir,
+			want: config.HistoryLocation{Dir: tempDir},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			currentDir, err := os.Getwd()
+			require.NoError(t, err)
+			defer os.Chdir(currentDir)
+			require.NoError(t, os.Chdir(tc.dir))
+
+			cr := newCommandRunner("/home/user", false)
+			assert.Equal(t, tc.want, cr.historyLocation())
+		})
+	}
+}
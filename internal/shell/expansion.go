@@ -0,0 +1,395 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/at-ishikawa/go-shell/internal/expansion"
+	"github.com/at-ishikawa/go-shell/internal/syntax"
+)
+
+const defaultIFS = " \t\n"
+
+// errInterrupted is returned when a command substitution is interrupted by Ctrl-C
+var errInterrupted = errors.New("interrupted")
+
+// fieldsBuilder builds fields from expanded word parts.
+// Only unquoted results of expansions are split by IFS
+type fieldsBuilder struct {
+	ifs    string
+	fields []string
+	// patterns are glob patterns of fields, where quoted characters are escaped
+	patterns []string
+	current  strings.Builder
+	pattern  strings.Builder
+	// hasCurrent is true when the current field exists even if it's empty like ""
+	hasCurrent bool
+	// isSingleField is true when a word is expanded into one field, like a value of an assignment
+	isSingleField bool
+}
+
+func (b *fieldsBuilder) write(value string, isQuoted bool) {
+	b.current.WriteString(value)
+	if isQuoted {
+		b.pattern.WriteString(expansion.EscapeGlobPattern(value))
+	} else {
+		b.pattern.WriteString(value)
+	}
+	b.hasCurrent = true
+}
+
+func (b *fieldsBuilder) writeSplit(value string) {
+	for _, c := range value {
+		if strings.ContainsRune(b.ifs, c) {
+			b.endField()
+			continue
+		}
+		b.current.WriteRune(c)
+		b.pattern.WriteRune(c)
+		b.hasCurrent = true
+	}
+}
+
+func (b *fieldsBuilder) endField() {
+	if !b.hasCurrent {
+		return
+	}
+	b.fields = append(b.fields, b.current.String())
+	b.patterns = append(b.patterns, b.pattern.String())
+	b.current.Reset()
+	b.pattern.Reset()
+	b.hasCurrent = false
+}
+
+// expandWord expands a word into fields
+func (cr *commandRunner) expandWord(word *syntax.Word) ([]string, error) {
+	ifs, ok := cr.getVariable("IFS")
+	if !ok {
+		ifs = defaultIFS
+	}
+	builder := &fieldsBuilder{ifs: ifs}
+	word = cr.expandTilde(word, false)
+	if err := cr.expandWordParts(builder, word.Parts, false); err != nil {
+		return nil, err
+	}
+	builder.endField()
+	return cr.expandPathnames(builder.fields, builder.patterns)
+}
+
+// expandPathnames replaces fields having glob patterns with matched file paths
+func (cr *commandRunner) expandPathnames(fields []string, patterns []string) ([]string, error) {
+	var result []string
+	for i, field := range fields {
+		if !expansion.HasGlobPattern(patterns[i]) {
+			result = append(result, field)
+			continue
+		}
+
+		globOptions := cr.options.globOptions
+		if cr.isolation != nil {
+			globOptions.Dir = cr.isolation.dir
+		}
+		matches, err := expansion.Glob(patterns[i], globOptions)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			if cr.options.isFailGlob {
+				return nil, fmt.Errorf("no match: %s", field)
+			}
+			if cr.options.isNullGlob {
+				continue
+			}
+			result = append(result, field)
+			continue
+		}
+		result = append(result, matches...)
+	}
+	return result, nil
+}
+
+// expandString expands a word without field splitting, like a value of an assignment
+func (cr *commandRunner) expandString(word *syntax.Word) (string, error) {
+	if word == nil {
+		return "", nil
+	}
+	builder := &fieldsBuilder{isSingleField: true}
+	if err := cr.expandWordParts(builder, word.Parts, true); err != nil {
+		return "", err
+	}
+	return builder.current.String(), nil
+}
+
+// expandPattern expands a word into a pattern like one of case, where quoted characters are escaped
+func (cr *commandRunner) expandPattern(word *syntax.Word) (string, error) {
+	builder := &fieldsBuilder{isSingleField: true}
+	if err := cr.expandWordParts(builder, cr.expandTilde(word, false).Parts, false); err != nil {
+		return "", err
+	}
+	return builder.pattern.String(), nil
+}
+
+// expandAssignmentValue expands a value of NAME=value
+func (cr *commandRunner) expandAssignmentValue(word *syntax.Word) (string, error) {
+	return cr.expandString(cr.expandTilde(word, true))
+}
+
+// expandTilde replaces tilde prefixes in unquoted literals with home directories.
+// A tilde prefix is only at the beginning of a word, or after : in an assignment.
+// Home directories are quoted so that they aren't split
+func (cr *commandRunner) expandTilde(word *syntax.Word, isAssignment bool) *syntax.Word {
+	if word == nil || len(word.Parts) == 0 {
+		return word
+	}
+	separators := "/"
+	if isAssignment {
+		separators = "/:"
+	}
+
+	result := &syntax.Word{}
+	for i, part := range word.Parts {
+		literal, ok := part.(*syntax.Literal)
+		if !ok {
+			result.Parts = append(result.Parts, part)
+			continue
+		}
+
+		value := literal.Value
+		// The position where a tilde prefix can start
+		start := -1
+		if i == 0 {
+			start = 0
+		}
+		var literalStart int
+		for pos := 0; pos <= len(value); pos++ {
+			if pos == start && strings.HasPrefix(value[pos:], "~") {
+				end := strings.IndexAny(value[pos:], separators)
+				// A tilde prefix followed by quoted characters isn't expanded
+				if end >= 0 || i == len(word.Parts)-1 {
+					if end < 0 {
+						end = len(value) - pos
+					}
+					if dir, ok := cr.tildeDir(value[pos : pos+end]); ok {
+						if literalStart < pos {
+							result.Parts = append(result.Parts, &syntax.Literal{Value: value[literalStart:pos]})
+						}
+						result.Parts = append(result.Parts, &syntax.SingleQuoted{Value: dir})
+						pos += end
+						literalStart = pos
+					}
+				}
+			}
+			if isAssignment && pos < len(value) && value[pos] == ':' {
+				start = pos + 1
+			}
+		}
+		if literalStart < len(value) {
+			result.Parts = append(result.Parts, &syntax.Literal{Value: value[literalStart:]})
+		}
+	}
+	return result
+}
+
+func (cr *commandRunner) expandWordParts(builder *fieldsBuilder, parts []syntax.WordPart, isQuoted bool) error {
+	for _, part := range parts {
+		switch p := part.(type) {
+		case *syntax.Literal:
+			builder.write(p.Value, isQuoted)
+		case *syntax.SingleQuoted:
+			builder.write(p.Value, true)
+		case *syntax.DoubleQuoted:
+			// "$@" is removed when there is no positional parameter
+			if !(len(p.Parts) == 1 && isAllPositionalParameters(p.Parts[0])) {
+				builder.hasCurrent = true
+			}
+			if err := cr.expandWordParts(builder, p.Parts, true); err != nil {
+				return err
+			}
+		case *syntax.ParameterExpansion:
+			if isAllPositionalParameters(p) {
+				cr.expandPositionalParameters(builder, isQuoted)
+				continue
+			}
+			value, err := cr.expandParameter(p)
+			if err != nil {
+				return err
+			}
+			if isQuoted {
+				if value != "" {
+					builder.write(value, true)
+				}
+				continue
+			}
+			builder.writeSplit(value)
+		case *syntax.CommandSubstitution:
+			value, err := cr.runCommandSubstitution(p.List)
+			if err != nil {
+				return err
+			}
+			if isQuoted {
+				builder.write(value, true)
+				continue
+			}
+			builder.writeSplit(value)
+		}
+	}
+	return nil
+}
+
+// runCommandSubstitution runs a list in a subshell and returns its stdout without trailing newlines
+func (cr *commandRunner) runCommandSubstitution(list *syntax.List) (string, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	type readResult struct {
+		output []byte
+		err    error
+	}
+	result := make(chan readResult, 1)
+	go func() {
+		defer reader.Close()
+		output, err := io.ReadAll(reader)
+		result <- readResult{output: output, err: err}
+	}()
+
+	stdioFiles := cr.stdioFiles
+	stdioFiles[1] = writer
+	exitCode, err := cr.runInSubshell(list, stdioFiles)
+	writer.Close()
+	if stdioFiles[2] != nil {
+		cr.writeError(stdioFiles[2], err)
+	}
+	read := <-result
+	if read.err != nil {
+		return "", read.err
+	}
+
+	cr.lastExitCode = exitCode
+	cr.substitutionExitCode = exitCode
+	if exitCode == exitCodeInterrupted {
+		return "", errInterrupted
+	}
+	return strings.TrimRight(string(read.output), "\n"), nil
+}
+
+// expandPositionalParameters expands $@ into a field for each positional parameter
+func (cr *commandRunner) expandPositionalParameters(builder *fieldsBuilder, isQuoted bool) {
+	for i, parameter := range cr.positionalParameters {
+		if i > 0 {
+			if builder.isSingleField {
+				builder.write(" ", isQuoted)
+			} else {
+				builder.endField()
+			}
+		}
+		if isQuoted || builder.isSingleField {
+			builder.write(parameter, isQuoted)
+		} else {
+			builder.writeSplit(parameter)
+		}
+	}
+}
+
+func isAllPositionalParameters(part syntax.WordPart) bool {
+	p, ok := part.(*syntax.ParameterExpansion)
+	return ok && p.Name == "@" && p.Operator == ""
+}
+
+func (cr *commandRunner) expandParameter(p *syntax.ParameterExpansion) (string, error) {
+	value, isSet := cr.getVariable(p.Name)
+
+	var useWord bool
+	switch p.Operator {
+	case syntax.DefaultValueOperator,
+		syntax.AssignDefaultOperator,
+		syntax.ErrorOperator:
+		useWord = !isSet || value == ""
+	case syntax.UnsetDefaultValueOperator,
+		syntax.UnsetAssignDefaultOperator,
+		syntax.UnsetErrorOperator:
+		useWord = !isSet
+	case syntax.AlternativeValueOperator:
+		useWord = isSet && value != ""
+	case syntax.UnsetAlternativeValueOperator:
+		useWord = isSet
+	}
+
+	switch p.Operator {
+	case syntax.LengthOperator:
+		return fmt.Sprint(utf8.RuneCountInString(value)), nil
+	case syntax.DefaultValueOperator, syntax.UnsetDefaultValueOperator:
+		if useWord {
+			return cr.expandString(cr.expandTilde(p.Word, false))
+		}
+	case syntax.AssignDefaultOperator, syntax.UnsetAssignDefaultOperator:
+		if useWord {
+			word, err := cr.expandString(cr.expandTilde(p.Word, false))
+			if err != nil {
+				return "", err
+			}
+			if !syntax.IsName(p.Name) {
+				return "", fmt.Errorf("$%s: cannot assign in this way", p.Name)
+			}
+			if err := cr.setVariable(p.Name, word); err != nil {
+				return "", err
+			}
+			return word, nil
+		}
+	case syntax.ErrorOperator, syntax.UnsetErrorOperator:
+		if useWord {
+			message, err := cr.expandString(p.Word)
+			if err != nil {
+				return "", err
+			}
+			if message == "" {
+				message = "parameter null or not set"
+			}
+			return "", fmt.Errorf("%s: %s", p.Name, message)
+		}
+	case syntax.AlternativeValueOperator, syntax.UnsetAlternativeValueOperator:
+		if useWord {
+			return cr.expandString(cr.expandTilde(p.Word, false))
+		}
+		return "", nil
+	}
+	return value, nil
+}
+
+// expandRedirections expands targets of redirections
+func (cr *commandRunner) expandRedirections(redirections []*syntax.Redirection) ([]redirection, error) {
+	var result []redirection
+	for _, r := range redirections {
+		fields, err := cr.expandWord(r.Target)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("%s: ambiguous redirect", r.Target.Unquoted())
+		}
+		for _, expanded := range newRedirections(r.Fd, r.Operator, fields[0]) {
+			if expanded.operator != syntax.DuplicateInput && expanded.operator != syntax.DuplicateOutput {
+				expanded.target = cr.absPath(expanded.target)
+			}
+			result = append(result, expanded)
+		}
+	}
+	return result, nil
+}
+
+// expandAssignments returns NAME=value pairs for environment variables
+func (cr *commandRunner) expandAssignments(assignments []*syntax.Assignment) ([]string, error) {
+	var env []string
+	for _, a := range assignments {
+		value, err := cr.expandAssignmentValue(a.Value)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, a.Name+"="+value)
+	}
+	return env, nil
+}
@@ -0,0 +1,185 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// isolation is the current directory and environment variables of a subshell which runs concurrently with the shell.
+// They're kept in the subshell instead of the process, so that changes don't affect the shell or other subshells
+type isolation struct {
+	dir string
+	env map[string]string
+}
+
+// newIsolation copies the current directory and environment variables of a shell
+func (cr *commandRunner) newIsolation() (*isolation, error) {
+	dir, err := cr.currentDir()
+	if err != nil {
+		return nil, err
+	}
+	env := make(map[string]string)
+	for _, e := range cr.environ() {
+		name, value, _ := strings.Cut(e, "=")
+		env[name] = value
+	}
+	return &isolation{dir: dir, env: env}, nil
+}
+
+// currentDir returns the current directory of the shell
+func (cr *commandRunner) currentDir() (string, error) {
+	if cr.isolation != nil {
+		return cr.isolation.dir, nil
+	}
+	return os.Getwd()
+}
+
+// chdir changes the current directory of the shell
+func (cr *commandRunner) chdir(dir string) error {
+	if cr.isolation == nil {
+		return os.Chdir(dir)
+	}
+	path := cr.absPath(dir)
+	info, err := os.Stat(path)
+	if err != nil {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: errors.Unwrap(err)}
+	}
+	if !info.IsDir() {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: unix.ENOTDIR}
+	}
+	if err := unix.Access(path, unix.X_OK); err != nil {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: err}
+	}
+	cr.isolation.dir = path
+	return nil
+}
+
+// absPath returns a path relative to the current directory of an isolated subshell as an absolute one.
+// Paths are used as they are in the shell because they're relative to the current directory of the process
+func (cr *commandRunner) absPath(path string) string {
+	if cr.isolation == nil || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(cr.isolation.dir, path)
+}
+
+func (cr *commandRunner) lookupEnv(name string) (string, bool) {
+	if cr.isolation == nil {
+		return os.LookupEnv(name)
+	}
+	value, ok := cr.isolation.env[name]
+	return value, ok
+}
+
+func (cr *commandRunner) setEnv(name string, value string) error {
+	if cr.isolation == nil {
+		return os.Setenv(name, value)
+	}
+	if name == "" || strings.ContainsAny(name, "=\x00") {
+		return fmt.Errorf("setenv: invalid argument: %s", name)
+	}
+	cr.isolation.env[name] = value
+	return nil
+}
+
+func (cr *commandRunner) unsetEnv(name string) error {
+	if cr.isolation == nil {
+		return os.Unsetenv(name)
+	}
+	delete(cr.isolation.env, name)
+	return nil
+}
+
+// environ returns environment variables as NAME=value sorted by names
+func (cr *commandRunner) environ() []string {
+	if cr.isolation == nil {
+		environ := os.Environ()
+		sort.Strings(environ)
+		return environ
+	}
+	environ := make([]string, 0, len(cr.isolation.env))
+	for name, value := range cr.isolation.env {
+		environ = append(environ, name+"="+value)
+	}
+	sort.Strings(environ)
+	return environ
+}
+
+// replaceEnviron replaces all environment variables with NAME=value
+func (cr *commandRunner) replaceEnviron(environ []string) {
+	if cr.isolation != nil {
+		cr.isolation.env = make(map[string]string, len(environ))
+	} else {
+		os.Clearenv()
+	}
+	for _, e := range environ {
+		name, value, _ := strings.Cut(e, "=")
+		cr.setEnv(name, value)
+	}
+}
+
+// lookPath searches a command in $PATH of the shell like exec.LookPath
+func (cr *commandRunner) lookPath(name string) (string, error) {
+	if cr.isolation == nil {
+		return exec.LookPath(name)
+	}
+	if strings.Contains(name, "/") {
+		path := cr.absPath(name)
+		if isExecutableFile(path) {
+			return path, nil
+		}
+		return "", &exec.Error{Name: name, Err: fs.ErrNotExist}
+	}
+	pathEnv, _ := cr.lookupEnv("PATH")
+	for _, dir := range filepath.SplitList(pathEnv) {
+		if dir == "" {
+			dir = "."
+		}
+		path := filepath.Join(cr.absPath(dir), name)
+		if isExecutableFile(path) {
+			return path, nil
+		}
+	}
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+func isExecutableFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode()&0111 != 0
+}
+
+// newCommand returns a command of a process which runs in the current directory
+// with environment variables of the shell and env
+func (cr *commandRunner) newCommand(name string, args []string, env []string) *exec.Cmd {
+	// Processes are waited for by the shell instead of exec.Cmd.Wait to know when they stop,
+	// so a context which is never canceled is used
+	if cr.isolation == nil {
+		cmd := cr.execCommandContext(context.Background(), name, args...)
+		if len(env) > 0 {
+			cmd.Env = append(cmd.Environ(), env...)
+		}
+		return cmd
+	}
+
+	path, lookPathErr := cr.lookPath(name)
+	if lookPathErr != nil {
+		path = cr.absPath(name)
+	}
+	cmd := cr.execCommandContext(context.Background(), path, args...)
+	cmd.Args[0] = name
+	cmd.Dir = cr.isolation.dir
+	cmd.Env = append(cr.environ(), env...)
+	if errors.Is(lookPathErr, exec.ErrNotFound) {
+		cmd.Err = lookPathErr
+	}
+	return cmd
+}
@@ -0,0 +1,480 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+type jobState int
+
+const (
+	jobRunning jobState = iota
+	jobStopped
+	jobDone
+)
+
+func (s jobState) String() string {
+	switch s {
+	case jobRunning:
+		return "Running"
+	case jobStopped:
+		return "Stopped"
+	}
+	return "Done"
+}
+
+type jobProcess struct {
+	pid       int
+	status    syscall.WaitStatus
+	isDone    bool
+	isStopped bool
+	// rusage is the resource usage of an exited process reported by wait4
+	rusage syscall.Rusage
+}
+
+// job is a pipeline running in its own process group
+type job struct {
+	id int
+	// pgid is 0 without job control, where processes belong to the process group of the shell
+	pgid      int
+	command   string
+	processes []*jobProcess
+	// reportedState is the state shown to a user last time
+	reportedState jobState
+	// inShell is builtins, functions and compound commands of the pipeline running in subshells
+	inShell sync.WaitGroup
+	// interruptInShell passes Ctrl-C to subshells, which is nil without them
+	interruptInShell func()
+}
+
+func (j *job) state() jobState {
+	isStopped := false
+	for _, p := range j.processes {
+		if p.isDone {
+			continue
+		}
+		if !p.isStopped {
+			return jobRunning
+		}
+		isStopped = true
+	}
+	if isStopped {
+		return jobStopped
+	}
+	return jobDone
+}
+
+func (j *job) updateStatus(pid int, status syscall.WaitStatus, rusage syscall.Rusage) {
+	for _, p := range j.processes {
+		if p.pid != pid {
+			continue
+		}
+		switch {
+		case status.Stopped():
+			p.isStopped = true
+		case status.Continued():
+			p.isStopped = false
+		default:
+			p.isDone = true
+			p.rusage = rusage
+		}
+		p.status = status
+		return
+	}
+}
+
+// exitStatus returns the status of the last process,
+// or the one of the last failed process with pipefail
+func (j *job) exitStatus(isPipefail bool) syscall.WaitStatus {
+	status := j.processes[len(j.processes)-1].status
+	if isPipefail {
+		for i := len(j.processes) - 1; i >= 0; i-- {
+			if exitCodeOf(j.processes[i].status) != 0 {
+				return j.processes[i].status
+			}
+		}
+	}
+	return status
+}
+
+// continueJob sends SIGCONT to a stopped job
+func (j *job) continueJob() error {
+	for _, p := range j.processes {
+		p.isStopped = false
+	}
+	if err := j.signal(syscall.SIGCONT); err != nil {
+		return fmt.Errorf("failed to continue a job: %w", err)
+	}
+	return nil
+}
+
+// signal sends a signal to the process group of a job, or each process without job control
+func (j *job) signal(sig syscall.Signal) error {
+	if j.pgid != 0 {
+		return syscall.Kill(-j.pgid, sig)
+	}
+	for _, p := range j.processes {
+		if p.isDone {
+			continue
+		}
+		if err := syscall.Kill(p.pid, sig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isInterrupted returns true if a process of a job was terminated by Ctrl-C
+func (j *job) isInterrupted() bool {
+	for _, p := range j.processes {
+		// Builtins and functions without a process may still be running
+		if p.pid == 0 {
+			continue
+		}
+		if p.isDone && p.status.Signaled() && p.status.Signal() == syscall.SIGINT {
+			return true
+		}
+	}
+	return false
+}
+
+// interrupt sends SIGINT to processes of a job which haven't been waited for,
+// and passes it to builtins and functions in subshells.
+// Processes are read without waiting for them because the job is waited for concurrently
+func (j *job) interrupt() {
+	if j.interruptInShell != nil {
+		j.interruptInShell()
+	}
+	if j.pgid != 0 {
+		syscall.Kill(-j.pgid, syscall.SIGINT)
+		return
+	}
+	for _, p := range j.processes {
+		if p.pid != 0 {
+			syscall.Kill(p.pid, syscall.SIGINT)
+		}
+	}
+}
+
+func exitCodeOf(status syscall.WaitStatus) int {
+	switch {
+	case status.Signaled():
+		return exitCodeSignalBase + int(status.Signal())
+	case status.Stopped():
+		return exitCodeSignalBase + int(status.StopSignal())
+	}
+	return status.ExitStatus()
+}
+
+// exitError is returned when a command exits with a non-zero status
+type exitError struct {
+	exitCode int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.exitCode)
+}
+
+// waitJob waits until all processes in a job exit, or the job is stopped.
+// With isNoHang, it only collects status changes which already happened
+func waitJob(j *job, isNoHang bool) error {
+	if j.pgid == 0 {
+		return waitProcesses(j, isNoHang)
+	}
+	options := syscall.WUNTRACED
+	if isNoHang {
+		options |= syscall.WNOHANG | syscall.WCONTINUED
+	}
+	for j.state() == jobRunning || (isNoHang && j.state() != jobDone) {
+		var status syscall.WaitStatus
+		var rusage syscall.Rusage
+		pid, err := syscall.Wait4(-j.pgid, &status, options, &rusage)
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if errors.Is(err, syscall.ECHILD) {
+			// All processes were already collected
+			for _, p := range j.processes {
+				p.isDone = true
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to wait for a job: %w", err)
+		}
+		if pid == 0 {
+			return nil
+		}
+		j.updateStatus(pid, status, rusage)
+	}
+	return nil
+}
+
+// waitProcesses waits for each process of a job without job control
+func waitProcesses(j *job, isNoHang bool) error {
+	var options int
+	if isNoHang {
+		options = syscall.WNOHANG
+	}
+	for _, p := range j.processes {
+		for !p.isDone {
+			var status syscall.WaitStatus
+			var rusage syscall.Rusage
+			pid, err := syscall.Wait4(p.pid, &status, options, &rusage)
+			if errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			if errors.Is(err, syscall.ECHILD) {
+				p.isDone = true
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to wait for a job: %w", err)
+			}
+			if pid == 0 {
+				break
+			}
+			j.updateStatus(pid, status, rusage)
+		}
+	}
+	return nil
+}
+
+// waitForeground waits for a job in the foreground.
+// Ctrl-C and Ctrl-Z are forwarded to the job if the shell receives them
+func (cr *commandRunner) waitForeground(j *job, stdioFiles [3]*os.File) (int, error) {
+	done := make(chan struct{})
+	defer close(done)
+	signals := make(chan os.Signal, 1)
+	defer signal.Stop(signals)
+	// SIGINT: Control-C, SIGTSTP: Control-Z
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTSTP)
+	go func() {
+		interrupt := cr.interrupt
+		for {
+			select {
+			case <-done:
+				return
+			case <-interrupt:
+				// A subshell in a pipeline doesn't receive signals from the terminal
+				j.interrupt()
+				interrupt = nil
+			case sig := <-signals:
+				if sig == syscall.SIGINT && j.interruptInShell != nil {
+					j.interruptInShell()
+				}
+				// Without job control, processes receive signals from the terminal directly
+				if j.pgid == 0 {
+					continue
+				}
+				if err := syscall.Kill(-j.pgid, sig.(syscall.Signal)); err != nil {
+					fmt.Fprintf(stdioFiles[2], "failed to send a signal to a process group: %v\n", err)
+				}
+			}
+		}
+	}()
+
+	err := waitJob(j, false)
+	if j.interruptInShell != nil {
+		// Processes in the foreground receive Ctrl-C from the terminal instead of the shell
+		if j.isInterrupted() {
+			j.interruptInShell()
+		}
+		j.inShell.Wait()
+	}
+	cr.addCPUTime(j)
+	if fgErr := cr.setForeground(syscall.Getpgrp()); fgErr != nil {
+		fmt.Fprintln(stdioFiles[2], fgErr)
+	}
+	if err != nil {
+		return 1, err
+	}
+
+	status := j.exitStatus(cr.isPipefail)
+	if j.state() == jobStopped {
+		if j.id == 0 {
+			cr.addJob(j)
+		}
+		j.reportedState = jobStopped
+		fmt.Fprintln(stdioFiles[2])
+		cr.writeJob(stdioFiles[2], j)
+		return exitCodeOf(status), nil
+	}
+	cr.removeJob(j)
+
+	exitCode := exitCodeOf(status)
+	// Don't show a message when a command was canceled by an interruption
+	if exitCode == 0 || status.Signaled() {
+		return exitCode, nil
+	}
+	return exitCode, &exitError{exitCode: exitCode}
+}
+
+// setForeground makes a process group the foreground one of the terminal
+func (cr *commandRunner) setForeground(pgid int) error {
+	if cr.ttyFd < 0 {
+		return nil
+	}
+	// A background process can't change the foreground process group without ignoring SIGTTOU
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+	if err := unix.IoctlSetPointerInt(cr.ttyFd, unix.TIOCSPGRP, pgid); err != nil {
+		return fmt.Errorf("failed to set the foreground process group: %w", err)
+	}
+	return nil
+}
+
+func (cr *commandRunner) addJob(j *job) {
+	j.id = 1
+	if len(cr.jobs) > 0 {
+		j.id = cr.jobs[len(cr.jobs)-1].id + 1
+	}
+	cr.jobs = append(cr.jobs, j)
+}
+
+func (cr *commandRunner) removeJob(j *job) {
+	for i, existing := range cr.jobs {
+		if existing == j {
+			cr.jobs = append(cr.jobs[:i], cr.jobs[i+1:]...)
+			return
+		}
+	}
+}
+
+// writeJob writes a job like "[1]+  Stopped                 sleep 10"
+func (cr *commandRunner) writeJob(w io.Writer, j *job) {
+	marker := " "
+	if len(cr.jobs) > 0 && cr.jobs[len(cr.jobs)-1] == j {
+		marker = "+"
+	} else if len(cr.jobs) > 1 && cr.jobs[len(cr.jobs)-2] == j {
+		marker = "-"
+	}
+
+	state := j.state().String()
+	if status := j.exitStatus(cr.isPipefail); j.state() == jobDone {
+		if status.Signaled() {
+			// e.g. "terminated" to "Terminated"
+			description := status.Signal().String()
+			state = strings.ToUpper(description[:1]) + description[1:]
+		} else if status.ExitStatus() != 0 {
+			state = fmt.Sprintf("Exit %d", status.ExitStatus())
+		}
+	}
+	command := j.command
+	if j.state() == jobRunning {
+		command += " &"
+	}
+	fmt.Fprintf(w, "[%d]%s  %-24s%s\n", j.id, marker, state, command)
+}
+
+// reportJobs writes background jobs which finished or stopped since the last report
+func (cr *commandRunner) reportJobs(w io.Writer) {
+	for _, j := range append([]*job{}, cr.jobs...) {
+		if err := waitJob(j, true); err != nil {
+			fmt.Fprintln(w, err)
+			continue
+		}
+		state := j.state()
+		if state == j.reportedState {
+			continue
+		}
+		cr.writeJob(w, j)
+		j.reportedState = state
+		if state == jobDone {
+			cr.removeJob(j)
+		}
+	}
+}
+
+// findJob returns a job for a job spec like %1, %+ or %-.
+// The current job is returned without a job spec
+func (cr *commandRunner) findJob(args []string) (*job, error) {
+	spec := "%+"
+	if len(args) > 0 {
+		spec = args[0]
+	}
+	if len(cr.jobs) == 0 {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+
+	switch spec {
+	case "%+", "%%", "%":
+		return cr.jobs[len(cr.jobs)-1], nil
+	case "%-":
+		if len(cr.jobs) < 2 {
+			return nil, fmt.Errorf("%s: no such job", spec)
+		}
+		return cr.jobs[len(cr.jobs)-2], nil
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(spec, "%"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	for _, j := range cr.jobs {
+		if j.id == id {
+			return j, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: no such job", spec)
+}
+
+// listJobs runs the jobs command
+func (cr *commandRunner) listJobs(stdout *os.File) error {
+	for _, j := range append([]*job{}, cr.jobs...) {
+		if err := waitJob(j, true); err != nil {
+			return err
+		}
+		cr.writeJob(stdout, j)
+		j.reportedState = j.state()
+		if j.state() == jobDone {
+			cr.removeJob(j)
+		}
+	}
+	return nil
+}
+
+// foreground runs the fg command, which continues a job in the foreground
+func (cr *commandRunner) foreground(args []string, stdioFiles [3]*os.File) (int, error) {
+	if cr.isNonInteractive {
+		return 1, errors.New("fg: no job control")
+	}
+	j, err := cr.findJob(args)
+	if err != nil {
+		return 1, err
+	}
+	fmt.Fprintln(stdioFiles[1], j.command)
+
+	if err := cr.setForeground(j.pgid); err != nil {
+		return 1, err
+	}
+	if err := j.continueJob(); err != nil {
+		return 1, err
+	}
+	return cr.waitForeground(j, stdioFiles)
+}
+
+// background runs the bg command, which continues a stopped job in the background
+func (cr *commandRunner) background(args []string, stdout *os.File) error {
+	if cr.isNonInteractive {
+		return errors.New("bg: no job control")
+	}
+	j, err := cr.findJob(args)
+	if err != nil {
+		return err
+	}
+	if err := j.continueJob(); err != nil {
+		return err
+	}
+	j.reportedState = jobRunning
+	fmt.Fprintf(stdout, "[%d] %s &\n", j.id, j.command)
+	return nil
+}
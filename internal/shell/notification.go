@@ -0,0 +1,95 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// notificationMethod is an escape sequence to notify that a command finished
+type notificationMethod string
+
+const (
+	// notificationOsc9 is supported by iTerm2, Windows Terminal, kitty, WezTerm and others
+	notificationOsc9 notificationMethod = "osc9"
+	// notificationOsc777 is supported by VTE based terminals, urxvt, WezTerm and others
+	notificationOsc777 notificationMethod = "osc777"
+	notificationBell   notificationMethod = "bell"
+	notificationNone   notificationMethod = "none"
+)
+
+// notificationOptions are configured by $NOTIFY_THRESHOLD in seconds and $NOTIFY_METHOD.
+// Notifications are disabled until $NOTIFY_THRESHOLD is set
+type notificationOptions struct {
+	// threshold is 0 if notifications are disabled
+	threshold time.Duration
+	method    notificationMethod
+}
+
+func (cr *commandRunner) notificationOptions() notificationOptions {
+	options := notificationOptions{
+		method: detectNotificationMethod(),
+	}
+	if value, ok := cr.getVariable("NOTIFY_THRESHOLD"); ok {
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+			options.threshold = time.Duration(seconds * float64(time.Second))
+		}
+	}
+	if value, ok := cr.getVariable("NOTIFY_METHOD"); ok {
+		switch method := notificationMethod(value); method {
+		case notificationOsc9, notificationOsc777, notificationBell, notificationNone:
+			options.method = method
+		}
+	}
+	if options.method == notificationNone || options.threshold < 0 {
+		options.threshold = 0
+	}
+	return options
+}
+
+// detectNotificationMethod returns a method which the current terminal supports,
+// or the bell if it's unknown
+func detectNotificationMethod() notificationMethod {
+	switch os.Getenv("TERM_PROGRAM") {
+	case "iTerm.app", "WezTerm", "ghostty":
+		return notificationOsc9
+	}
+	switch {
+	case os.Getenv("WT_SESSION") != "", os.Getenv("KITTY_WINDOW_ID") != "":
+		return notificationOsc9
+	case os.Getenv("VTE_VERSION") != "", strings.HasPrefix(os.Getenv("TERM"), "rxvt"):
+		return notificationOsc777
+	}
+	return notificationBell
+}
+
+// shouldNotify returns true if a command took longer than the threshold.
+// A command interrupted by Ctrl-C isn't notified because a user is in front of the terminal
+func (o notificationOptions) shouldNotify(realTime time.Duration, exitCode int) bool {
+	return o.threshold > 0 && realTime >= o.threshold && exitCode != exitCodeInterrupted
+}
+
+// writeNotification writes an escape sequence to notify that a command finished with an exit status
+func writeNotification(w io.Writer, method notificationMethod, command string, exitCode int, realTime time.Duration) {
+	// Control characters like BEL would end an escape sequence
+	command = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, command)
+	body := fmt.Sprintf("%s finished with exit status %d in %s", command, exitCode, realTime.Round(time.Second))
+
+	switch method {
+	case notificationOsc9:
+		fmt.Fprintf(w, "\x1b]9;%s\x07", body)
+	case notificationOsc777:
+		fmt.Fprintf(w, "\x1b]777;notify;go-shell;%s\x07", body)
+	case notificationBell:
+		fmt.Fprint(w, "\a")
+	}
+}
@@ -0,0 +1,157 @@
+package shell
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteNotification(t *testing.T) {
+	testCases := []struct {
+		name    string
+		method  notificationMethod
+		command string
+		want    string
+	}{
+		{
+			name:    "OSC 9",
+			method:  notificationOsc9,
+			command: "make test",
+			want:    "\x1b]9;make test finished with exit status 2 in 1m5s\x07",
+		},
+		{
+			name:    "OSC 777",
+			method:  notificationOsc777,
+			command: "make test",
+			want:    "\x1b]777;notify;go-shell;make test finished with exit status 2 in 1m5s\x07",
+		},
+		{
+			name:    "control characters in a command",
+			method:  notificationOsc9,
+			command: "echo 'a\nb\x07'",
+			want:    "\x1b]9;echo 'a b ' finished with exit status 2 in 1m5s\x07",
+		},
+		{
+			name:    "bell",
+			method:  notificationBell,
+			command: "make test",
+			want:    "\a",
+		},
+		{
+			name:    "none",
+			method:  notificationNone,
+			command: "make test",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got bytes.Buffer
+			writeNotification(&got, tc.method, tc.command, 2, 65*time.Second+200*time.Millisecond)
+			assert.Equal(t, tc.want, got.String())
+		})
+	}
+}
+
+func TestCommandRunner_NotificationOptions(t *testing.T) {
+	testCases := []struct {
+		name      string
+		env       map[string]string
+		variables map[string]string
+		want      notificationOptions
+	}{
+		{
+			name: "disabled by default on an unknown terminal",
+			want: notificationOptions{method: notificationBell},
+		},
+		{
+			name: "iTerm2",
+			env:  map[string]string{"TERM_PROGRAM": "iTerm.app"},
+			want: notificationOptions{method: notificationOsc9},
+		},
+		{
+			name: "a VTE based terminal",
+			env:  map[string]string{"VTE_VERSION": "7200"},
+			want: notificationOptions{method: notificationOsc777},
+		},
+		{
+			name:      "configured by variables",
+			env:       map[string]string{"TERM_PROGRAM": "iTerm.app"},
+			variables: map[string]string{"NOTIFY_THRESHOLD": "1.5", "NOTIFY_METHOD": "osc777"},
+			want:      notificationOptions{threshold: 1500 * time.Millisecond, method: notificationOsc777},
+		},
+		{
+			name:      "invalid variables are ignored",
+			variables: map[string]string{"NOTIFY_THRESHOLD": "a", "NOTIFY_METHOD": "unknown"},
+			want:      notificationOptions{method: notificationBell},
+		},
+		{
+			name:      "enabled by the threshold",
+			variables: map[string]string{"NOTIFY_THRESHOLD": "10"},
+			want:      notificationOptions{threshold: 10 * time.Second, method: notificationBell},
+		},
+		{
+			name:      "disabled by the method",
+			variables: map[string]string{"NOTIFY_THRESHOLD": "10", "NOTIFY_METHOD": "none"},
+			want:      notificationOptions{method: notificationNone},
+		},
+		{
+			name:      "disabled by the threshold",
+			variables: map[string]string{"NOTIFY_THRESHOLD": "0"},
+			want:      notificationOptions{method: notificationBell},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, name := range []string{"TERM_PROGRAM", "WT_SESSION", "KITTY_WINDOW_ID", "VTE_VERSION", "TERM"} {
+				t.Setenv(name, tc.env[name])
+			}
+			cr := newCommandRunner("/home/user", false)
+			for name, value := range tc.variables {
+				require.NoError(t, cr.setVariable(name, value))
+			}
+			assert.Equal(t, tc.want, cr.notificationOptions())
+		})
+	}
+}
+
+func TestNotificationOptions_ShouldNotify(t *testing.T) {
+	options := notificationOptions{threshold: 10 * time.Second, method: notificationOsc9}
+	testCases := []struct {
+		name     string
+		options  notificationOptions
+		realTime time.Duration
+		exitCode int
+		want     bool
+	}{
+		{
+			name:     "a long command",
+			options:  options,
+			realTime: 10 * time.Second,
+			exitCode: 1,
+			want:     true,
+		},
+		{
+			name:     "a short command",
+			options:  options,
+			realTime: 9 * time.Second,
+		},
+		{
+			name:     "an interrupted command",
+			options:  options,
+			realTime: time.Minute,
+			exitCode: exitCodeInterrupted,
+		},
+		{
+			name:     "disabled",
+			realTime: time.Minute,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.options.shouldNotify(tc.realTime, tc.exitCode))
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/at-ishikawa/go-shell/internal/syntax"
+)
+
+type redirection struct {
+	fd       int
+	operator syntax.RedirectionOperator
+	// target is a file path, or a file descriptor for duplication operators
+	target string
+}
+
+// newRedirections returns redirections for an operator.
+// &> and &>> are converted into redirections for both a stdout and a stderr
+func newRedirections(fd int, operator syntax.RedirectionOperator, target string) []redirection {
+	if operator == syntax.DuplicateOutput && fd == 1 && target != closedFdTarget {
+		// >&file is the same as &>file
+		if _, err := strconv.Atoi(target); err != nil {
+			operator = syntax.RedirectAllOutput
+		}
+	}
+
+	switch operator {
+	case syntax.RedirectAllOutput, syntax.AppendAllOutput:
+		outputOperator := syntax.RedirectOutput
+		if operator == syntax.AppendAllOutput {
+			outputOperator = syntax.RedirectAppend
+		}
+		return []redirection{
+			{fd: 1, operator: outputOperator, target: target},
+			{fd: 2, operator: syntax.DuplicateOutput, target: "1"},
+		}
+	}
+	return []redirection{
+		{fd: fd, operator: operator, target: target},
+	}
+}
+
+// closedFdTarget is the target of a duplication operator to close a file descriptor like >&-
+const closedFdTarget = "-"
+
+// applyRedirections returns stdin, stdout and stderr after applying redirections in order.
+// Only these file descriptors are supported, and closing one of them is not supported.
+// The returned openedFiles have to be closed by a caller after a command starts
+func applyRedirections(stdioFiles [3]*os.File, redirections []redirection) (result [3]*os.File, openedFiles []*os.File, err error) {
+	result = stdioFiles
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, f := range openedFiles {
+			f.Close()
+		}
+		openedFiles = nil
+	}()
+
+	for _, r := range redirections {
+		if r.fd < 0 {
+			return result, openedFiles, fmt.Errorf("%d: bad file descriptor", r.fd)
+		}
+		if r.fd >= len(result) {
+			return result, openedFiles, fmt.Errorf("unsupported redirection: %d%s: only file descriptors 0, 1 and 2 are supported", r.fd, r.operator)
+		}
+
+		switch r.operator {
+		case syntax.DuplicateInput, syntax.DuplicateOutput:
+			if r.target == closedFdTarget {
+				return result, openedFiles, fmt.Errorf("unsupported redirection: %d%s%s: closing a file descriptor is not supported", r.fd, r.operator, r.target)
+			}
+			targetFd, err := strconv.Atoi(r.target)
+			if err != nil || targetFd < 0 {
+				return result, openedFiles, fmt.Errorf("%s: bad file descriptor", r.target)
+			}
+			if targetFd >= len(result) {
+				return result, openedFiles, fmt.Errorf("unsupported redirection: %d%s%s: only file descriptors 0, 1 and 2 are supported", r.fd, r.operator, r.target)
+			}
+			result[r.fd] = result[targetFd]
+			continue
+		}
+
+		var flag int
+		switch r.operator {
+		case syntax.RedirectInput:
+			flag = os.O_RDONLY
+		case syntax.RedirectReadWrite:
+			flag = os.O_RDWR | os.O_CREATE
+		case syntax.RedirectOutput, syntax.RedirectClobber:
+			flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		case syntax.RedirectAppend:
+			flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		default:
+			return result, openedFiles, fmt.Errorf("unsupported redirection: %s", r.operator)
+		}
+		f, err := os.OpenFile(r.target, flag, 0644)
+		if err != nil {
+			return result, openedFiles, err
+		}
+		openedFiles = append(openedFiles, f)
+		result[r.fd] = f
+	}
+	return result, openedFiles, nil
+}
@@ -0,0 +1,184 @@
+package shell
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/at-ishikawa/go-shell/internal/syntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRedirections(t *testing.T) {
+	testCases := []struct {
+		name     string
+		fd       int
+		operator syntax.RedirectionOperator
+		target   string
+		want     []redirection
+	}{
+		{
+			name:     "redirect a stderr",
+			fd:       2,
+			operator: syntax.RedirectOutput,
+			target:   "file",
+			want: []redirection{
+				{fd: 2, operator: syntax.RedirectOutput, target: "file"},
+			},
+		},
+		{
+			name:     "duplicate a stdout to a stderr",
+			fd:       2,
+			operator: syntax.DuplicateOutput,
+			target:   "1",
+			want: []redirection{
+				{fd: 2, operator: syntax.DuplicateOutput, target: "1"},
+			},
+		},
+		{
+			name:     "redirect both a stdout and a stderr",
+			fd:       1,
+			operator: syntax.RedirectAllOutput,
+			target:   "file",
+			want: []redirection{
+				{fd: 1, operator: syntax.RedirectOutput, target: "file"},
+				{fd: 2, operator: syntax.DuplicateOutput, target: "1"},
+			},
+		},
+		{
+			name:     "append both a stdout and a stderr",
+			fd:       1,
+			operator: syntax.AppendAllOutput,
+			target:   "file",
+			want: []redirection{
+				{fd: 1, operator: syntax.RedirectAppend, target: "file"},
+				{fd: 2, operator: syntax.DuplicateOutput, target: "1"},
+			},
+		},
+		{
+			name:     ">& with a file is the same as &>",
+			fd:       1,
+			operator: syntax.DuplicateOutput,
+			target:   "file",
+			want: []redirection{
+				{fd: 1, operator: syntax.RedirectOutput, target: "file"},
+				{fd: 2, operator: syntax.DuplicateOutput, target: "1"},
+			},
+		},
+		{
+			name:     ">&- closes a stdout instead of writing into a file",
+			fd:       1,
+			operator: syntax.DuplicateOutput,
+			target:   "-",
+			want: []redirection{
+				{fd: 1, operator: syntax.DuplicateOutput, target: "-"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := newRedirections(tc.fd, tc.operator, tc.target)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestApplyRedirections(t *testing.T) {
+	tempDir := t.TempDir()
+	existingFile := filepath.Join(tempDir, "existing")
+	require.NoError(t, os.WriteFile(existingFile, []byte("existing"), 0644))
+
+	stdioFiles := [3]*os.File{os.Stdin, os.Stdout, os.Stderr}
+	testCases := []struct {
+		name         string
+		redirections []redirection
+
+		wantFileNames [3]string
+		wantErr       error
+	}{
+		{
+			name:          "no redirection",
+			wantFileNames: [3]string{os.Stdin.Name(), os.Stdout.Name(), os.Stderr.Name()},
+		},
+		{
+			name: "redirect a stdout and then duplicate it to a stderr",
+			redirections: []redirection{
+				{fd: 1, operator: syntax.RedirectOutput, target: existingFile},
+				{fd: 2, operator: syntax.DuplicateOutput, target: "1"},
+			},
+			wantFileNames: [3]string{os.Stdin.Name(), existingFile, existingFile},
+		},
+		{
+			name: "duplicate a stderr before redirecting a stdout",
+			redirections: []redirection{
+				{fd: 2, operator: syntax.DuplicateOutput, target: "1"},
+				{fd: 1, operator: syntax.RedirectOutput, target: existingFile},
+			},
+			wantFileNames: [3]string{os.Stdin.Name(), existingFile, os.Stdout.Name()},
+		},
+		{
+			name: "redirect a stdin",
+			redirections: []redirection{
+				{fd: 0, operator: syntax.RedirectInput, target: existingFile},
+			},
+			wantFileNames: [3]string{existingFile, os.Stdout.Name(), os.Stderr.Name()},
+		},
+		{
+			name: "no file for a stdin",
+			redirections: []redirection{
+				{fd: 0, operator: syntax.RedirectInput, target: filepath.Join(tempDir, "unknown")},
+			},
+			wantErr: &fs.PathError{
+				Op:   "open",
+				Path: filepath.Join(tempDir, "unknown"),
+				Err:  errors.New("no such file or directory"),
+			},
+		},
+		{
+			name: "unsupported file descriptor",
+			redirections: []redirection{
+				{fd: 3, operator: syntax.RedirectOutput, target: existingFile},
+			},
+			wantErr: errors.New("unsupported redirection: 3>: only file descriptors 0, 1 and 2 are supported"),
+		},
+		{
+			name: "duplicate an unsupported file descriptor",
+			redirections: []redirection{
+				{fd: 1, operator: syntax.RedirectOutput, target: existingFile},
+				{fd: 2, operator: syntax.DuplicateOutput, target: "3"},
+			},
+			wantErr: errors.New("unsupported redirection: 2>&3: only file descriptors 0, 1 and 2 are supported"),
+		},
+		{
+			name: "close a file descriptor",
+			redirections: []redirection{
+				{fd: 1, operator: syntax.DuplicateOutput, target: "-"},
+			},
+			wantErr: errors.New("unsupported redirection: 1>&-: closing a file descriptor is not supported"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, gotOpenedFiles, gotErr := applyRedirections(stdioFiles, tc.redirections)
+			defer func() {
+				for _, f := range gotOpenedFiles {
+					f.Close()
+				}
+			}()
+			if tc.wantErr != nil {
+				assert.EqualError(t, gotErr, tc.wantErr.Error())
+				assert.Empty(t, gotOpenedFiles)
+				return
+			}
+			assert.NoError(t, gotErr)
+			for i, f := range got {
+				assert.Equal(t, tc.wantFileNames[i], f.Name())
+			}
+		})
+	}
+}
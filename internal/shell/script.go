@@ -0,0 +1,127 @@
+package shell
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/at-ishikawa/go-shell/internal/syntax"
+)
+
+// Script runs commands without a terminal, like go-shell -c, a script file or a piped stdin.
+// There is no prompt, history or job control
+type Script struct {
+	stdioFiles    [3]*os.File
+	commandRunner *commandRunner
+}
+
+// NewScript returns a shell where name is $0 and args are positional parameters
+func NewScript(inFile *os.File, outFile *os.File, errorFile *os.File, name string, args []string, options Options) (Script, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return Script{}, err
+	}
+	commandRunner := newCommandRunner(homeDir, options.IsPipefail)
+	commandRunner.isNonInteractive = true
+	commandRunner.name = name
+	commandRunner.positionalParameters = args
+
+	return Script{
+		stdioFiles:    [3]*os.File{inFile, outFile, errorFile},
+		commandRunner: commandRunner,
+	}, nil
+}
+
+// RunCommand runs commands in a string and returns the exit status of the last command
+func (s Script) RunCommand(command string) int {
+	exitCode, err := s.commandRunner.runInput(command, s.stdioFiles)
+	s.commandRunner.writeError(s.stdioFiles[2], err)
+	return exitCode
+}
+
+// Run reads and runs commands one by one until EOF, and returns the exit status of the last command.
+// It stops at a syntax error or Ctrl-C
+func (s Script) Run(reader io.Reader) int {
+	return s.commandRunner.runScript(reader, s.stdioFiles)
+}
+
+// rcFileName is the startup file in the config directory, which runs before the first prompt
+const rcFileName = "rc"
+
+// loadStartupFiles sources startup files in the config directory if they exist
+func (cr *commandRunner) loadStartupFiles(configDir string, stdioFiles [3]*os.File) {
+	for _, fileName := range []string{aliasFileName, rcFileName} {
+		filePath := configDir + "/" + fileName
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			continue
+		}
+		if _, err := cr.sourceFile(filePath, nil, stdioFiles); err != nil {
+			fmt.Fprintln(stdioFiles[2], err)
+		}
+	}
+}
+
+// sourceFile runs the source command, which runs commands in a file in the current shell.
+// Positional parameters are replaced with args while the file runs if args exist
+func (cr *commandRunner) sourceFile(filePath string, args []string, stdioFiles [3]*os.File) (int, error) {
+	file, err := os.Open(cr.absPath(filePath))
+	if err != nil {
+		return 1, fmt.Errorf("source: %w", err)
+	}
+	defer file.Close()
+
+	parentStdioFiles := cr.stdioFiles
+	positionalParameters := cr.positionalParameters
+	if len(args) > 0 {
+		cr.positionalParameters = args
+	}
+	cr.sourceDepth++
+	defer func() {
+		cr.stdioFiles = parentStdioFiles
+		cr.positionalParameters = positionalParameters
+		cr.sourceDepth--
+	}()
+
+	exitCode := cr.runScript(file, stdioFiles)
+	if cr.flow.kind == flowReturn {
+		exitCode = cr.flow.exitCode
+		cr.flow = flowControl{}
+	}
+	return exitCode, nil
+}
+
+func (cr *commandRunner) runScript(reader io.Reader, stdioFiles [3]*os.File) int {
+	bufferedReader := bufio.NewReader(reader)
+	var inputCommand string
+	for {
+		line, readErr := bufferedReader.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			fmt.Fprintln(stdioFiles[2], readErr)
+			return 1
+		}
+		inputCommand += line
+		// A command continues on the next lines until it's complete, like if without fi
+		if readErr == nil && isIncompleteCommand(inputCommand) {
+			continue
+		}
+
+		if strings.TrimSpace(inputCommand) != "" {
+			exitCode, err := cr.runInput(inputCommand, stdioFiles)
+			cr.writeError(stdioFiles[2], err)
+			var syntaxError *syntax.SyntaxError
+			if errors.As(err, &syntaxError) || exitCode == exitCodeInterrupted {
+				return exitCode
+			}
+			if cr.flow.kind == flowReturn || cr.flow.kind == flowExit {
+				return exitCode
+			}
+		}
+		inputCommand = ""
+		if readErr == io.EOF {
+			return cr.lastExitCode
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package shell
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScript_Run(t *testing.T) {
+	testCases := []struct {
+		name    string
+		command string
+		script  string
+		args    []string
+
+		wantOutput   string
+		wantExitCode int
+	}{
+		{
+			name:       "run a command string with positional parameters",
+			command:    `echo $0 $# "$1"`,
+			args:       []string{"a b", "c"},
+			wantOutput: "name 2 a b\n",
+		},
+		{
+			name:         "the exit status of the last command",
+			command:      `true; sh -c 'exit 3'`,
+			wantExitCode: 3,
+		},
+		{
+			name:       "run a script with multiple lines",
+			script:     "for a in \"$@\"\ndo\n  echo $a\ndone\necho $0",
+			args:       []string{"1", "2"},
+			wantOutput: "1\n2\nname\n",
+		},
+		{
+			name:         "exit stops a script",
+			script:       "echo a\nexit 4\necho b\n",
+			wantOutput:   "a\n",
+			wantExitCode: 4,
+		},
+		{
+			name:         "stop at a syntax error",
+			script:       "echo a\nfi\necho b\n",
+			wantOutput:   "a\n",
+			wantExitCode: 2,
+		},
+		{
+			name:         "an incomplete command at the end",
+			script:       "echo a\nif true; then\n",
+			wantOutput:   "a\n",
+			wantExitCode: 2,
+		},
+		{
+			name:       "jobs aren't in their own process groups",
+			script:     "sh -c 'test $(ps -o pgid= -p $$) = $(ps -o pgid= -p $PPID)' && echo same",
+			wantOutput: "same\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := os.CreateTemp("", "output")
+			require.NoError(t, err)
+			defer os.Remove(out.Name())
+			defer out.Close()
+
+			s, err := NewScript(os.Stdin, out, os.Stderr, "name", tc.args, Options{})
+			require.NoError(t, err)
+			var got int
+			if tc.command != "" {
+				got = s.RunCommand(tc.command)
+			} else {
+				got = s.Run(strings.NewReader(tc.script))
+			}
+			assert.Equal(t, tc.wantExitCode, got)
+
+			gotOutput, err := os.ReadFile(out.Name())
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantOutput, string(gotOutput))
+		})
+	}
+}
+
+func TestScript_ErrorOutput(t *testing.T) {
+	testCases := []struct {
+		name    string
+		command string
+		script  string
+
+		wantErrorOutput string
+		wantExitCode    int
+	}{
+		{
+			name:    "a failed command before ||",
+			command: `false || true`,
+		},
+		{
+			name:         "a failed command at the end of a command string",
+			command:      `true; false`,
+			wantExitCode: 1,
+		},
+		{
+			name:         "a failed command at the end of a script",
+			script:       "false && echo a\nfalse\n",
+			wantExitCode: 1,
+		},
+		{
+			name:         "a failed command substitution",
+			command:      `echo $(false)`,
+			wantExitCode: 0,
+		},
+		{
+			name:            "an error of the shell",
+			command:         `cd /nonexistent-dir; true`,
+			wantErrorOutput: "chdir /nonexistent-dir: no such file or directory\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := os.CreateTemp("", "output")
+			require.NoError(t, err)
+			defer os.Remove(out.Name())
+			defer out.Close()
+			errorOut, err := os.CreateTemp("", "error")
+			require.NoError(t, err)
+			defer os.Remove(errorOut.Name())
+			defer errorOut.Close()
+
+			s, err := NewScript(os.Stdin, out, errorOut, "name", nil, Options{})
+			require.NoError(t, err)
+			var got int
+			if tc.command != "" {
+				got = s.RunCommand(tc.command)
+			} else {
+				got = s.Run(strings.NewReader(tc.script))
+			}
+			assert.Equal(t, tc.wantExitCode, got)
+
+			gotErrorOutput, err := os.ReadFile(errorOut.Name())
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantErrorOutput, string(gotErrorOutput))
+		})
+	}
+}
+
+func TestCommandRunner_SourceFile(t *testing.T) {
+	dir := t.TempDir()
+	scriptPath := dir + "/script.gsh"
+	require.NoError(t, os.WriteFile(scriptPath, []byte(`A=sourced
+greet() {
+  echo hello $1
+}
+echo $# $1
+if [ "$1" = early ]; then
+  return 3
+fi
+echo end
+`), 0644))
+
+	testCases := []struct {
+		name         string
+		inputCommand string
+
+		wantOutput   string
+		wantExitCode int
+		wantErr      bool
+	}{
+		{
+			name:         "variables and functions remain in the current shell",
+			inputCommand: "source " + scriptPath + "; echo $A; greet world",
+			wantOutput:   "0\nend\nsourced\nhello world\n",
+		},
+		{
+			name:         "arguments are positional parameters",
+			inputCommand: ". " + scriptPath + " a b > " + dir + "/out; cat " + dir + "/out",
+			wantOutput:   "2 a\nend\n",
+		},
+		{
+			name:         "return from a sourced file",
+			inputCommand: "source " + scriptPath + " early; echo $?",
+			wantOutput:   "1 early\n3\n",
+		},
+		{
+			name:         "a file which doesn't exist",
+			inputCommand: "source " + dir + "/unknown",
+			wantExitCode: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "no file name",
+			inputCommand: "source",
+			wantExitCode: 2,
+			wantErr:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := os.CreateTemp("", "output")
+			require.NoError(t, err)
+			defer os.Remove(out.Name())
+			defer out.Close()
+
+			cr := newCommandRunner("/home/user", false)
+			gotExitCode, gotErr := cr.runInput(tc.inputCommand, [3]*os.File{os.Stdin, out, os.Stderr})
+			assert.Equal(t, tc.wantExitCode, gotExitCode)
+			assert.Equal(t, tc.wantErr, gotErr != nil)
+
+			gotOutput, err := os.ReadFile(out.Name())
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantOutput, string(gotOutput))
+		})
+	}
+}
+
+func TestCommandRunner_LoadStartupFiles(t *testing.T) {
+	configDir := t.TempDir()
+	require.NoError(t, os.WriteFile(configDir+"/"+aliasFileName, []byte("alias ll='ls -l'\n"), 0644))
+	require.NoError(t, os.WriteFile(configDir+"/"+rcFileName, []byte(`# comment
+alias la='ls -a'
+PS1='[$USER_NAME] $ '
+USER_NAME=user
+`), 0644))
+
+	cr := newCommandRunner("/home/user", false)
+	assert.Equal(t, "", cr.prompt())
+	cr.loadStartupFiles(configDir, [3]*os.File{os.Stdin, os.Stdout, os.Stderr})
+	assert.Equal(t, map[string]string{
+		"ll": "ls -l",
+		"la": "ls -a",
+	}, cr.aliases)
+	assert.Equal(t, "[user] $ ", cr.prompt())
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/at-ishikawa/go-shell/internal/completion"
 	"github.com/at-ishikawa/go-shell/internal/config"
 	"go.uber.org/zap"
 )
@@ -13,11 +14,12 @@ import (
 type Shell struct {
 	logger        *zap.Logger
 	terminal      terminal
-	commandRunner commandRunner
+	commandRunner *commandRunner
 }
 
 type Options struct {
-	IsDebug bool
+	IsDebug    bool
+	IsPipefail bool
 }
 
 func NewShell(inFile *os.File, outFile *os.File, errorFile *os.File, options Options) (Shell, error) {
@@ -60,7 +62,16 @@ func NewShell(inFile *os.File, outFile *os.File, errorFile *os.File, options Opt
 	if err := commandHistory.LoadFile(); err != nil {
 		return Shell{}, fmt.Errorf("failed to load a history file: %w", err)
 	}
-	suggester, err := newCommandSuggester(&commandHistory, homeDir, logger)
+	commandRunner := newCommandRunner(homeDir, options.IsPipefail)
+	commandRunner.history = &commandHistory
+	directoryHistory := config.NewDirectoryHistory(conf)
+	commandRunner.directoryHistory = &directoryHistory
+	completionUi, err := completion.NewTcellCompletion()
+	if err != nil {
+		return Shell{}, err
+	}
+	commandRunner.completionUi = completionUi
+	suggester, err := newCommandSuggester(&commandHistory, homeDir, commandRunner.aliases, commandRunner.getDirectoryStack, logger)
 	if err != nil {
 		return Shell{}, err
 	}
@@ -77,15 +88,18 @@ func NewShell(inFile *os.File, outFile *os.File, errorFile *os.File, options Opt
 		return Shell{}, fmt.Errorf("failed to initialize a terminal: %w", err)
 	}
 
+	commandRunner.loadStartupFiles(conf.GetPath(), [3]*os.File{inFile, outFile, errorFile})
+
 	return Shell{
 		logger:        logger,
 		terminal:      terminal,
-		commandRunner: newCommandRunner(homeDir),
+		commandRunner: commandRunner,
 	}, nil
 }
 
+// Run runs a shell until exit, and returns the exit status given to exit
 // https://hackernoon.com/today-i-learned-making-a-simple-interactive-shell-application-in-golang-aa83adcb266a
-func (s Shell) Run() error {
+func (s Shell) Run() (int, error) {
 	defer func() {
 		if err := s.logger.Sync(); err != nil {
 			s.logger.Error("Failed to zap.Logger.sync", zap.Error(err))
@@ -97,7 +111,7 @@ func (s Shell) Run() error {
 		}
 	}()
 	if err := s.terminal.makeRaw(); err != nil {
-		return err
+		return 1, err
 	}
 
 	invalidateTermRaw := func(f func() (int, error)) (int, error) {
@@ -112,13 +126,41 @@ func (s Shell) Run() error {
 
 		return exitCode, err
 	}
-	return s.run(invalidateTermRaw)
+	if err := s.run(invalidateTermRaw); err != nil {
+		return 1, err
+	}
+	return s.commandRunner.flow.exitCode, nil
 }
 
 func (s Shell) run(wrapped func(func() (int, error)) (int, error)) error {
-	return s.terminal.start(func(inputCommand string) (int, error) {
-		return wrapped(func() (int, error) {
+	return s.terminal.start(func(inputCommand string) (commandResult, error) {
+		dir, _ := os.Getwd()
+		startedAt := time.Now()
+		exitCode, err := wrapped(func() (int, error) {
 			return s.commandRunner.run(inputCommand, &s.terminal)
 		})
+		result := commandResult{
+			historyCommand: s.commandRunner.historyCommand(inputCommand),
+			exitCode:       exitCode,
+			executionTime:  s.commandRunner.lastExecutionTime,
+			notification:   s.commandRunner.notificationOptions(),
+			dir:            dir,
+			startedAt:      startedAt,
+		}
+		if s.commandRunner.flow.kind == flowExit {
+			if err != nil {
+				fmt.Fprintln(s.terminal.stdErr.file, err)
+			}
+			return result, errExit
+		}
+		return result, err
+	}, func() string {
+		s.terminal.history.SetLocalOrder(s.commandRunner.options.isLocalHistory)
+		s.terminal.history.SetLocation(s.commandRunner.historyLocation())
+		var jobReport strings.Builder
+		s.commandRunner.reportJobs(&jobReport)
+		// The terminal is in raw mode while waiting for an input
+		fmt.Fprint(s.terminal.stdErr.file, strings.ReplaceAll(jobReport.String(), "\n", "\r\n"))
+		return s.commandRunner.prompt()
 	})
 }
@@ -0,0 +1,83 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/at-ishikawa/go-shell/internal/expansion"
+)
+
+// shellOptions are options which can be changed by shopt
+type shellOptions struct {
+	// isNullGlob removes patterns matching no file
+	isNullGlob bool
+	// isFailGlob makes patterns matching no file an error
+	isFailGlob bool
+	// isCorrect asks whether a similar command runs instead of a command which isn't found
+	isCorrect bool
+	// isLocalHistory shows commands of the current shell before ones of other shells in a history
+	isLocalHistory bool
+	globOptions    expansion.GlobOptions
+}
+
+func (o *shellOptions) values() map[string]*bool {
+	return map[string]*bool{
+		"correct":      &o.isCorrect,
+		"dotglob":      &o.globOptions.IsDotGlob,
+		"failglob":     &o.isFailGlob,
+		"globstar":     &o.globOptions.IsGlobStar,
+		"localhistory": &o.isLocalHistory,
+		"nullglob":     &o.isNullGlob,
+	}
+}
+
+// shopt runs the shopt command.
+// shopt -s enables options, shopt -u disables them, and shopt without a flag shows them
+func (o *shellOptions) shopt(args []string, stdout *os.File) error {
+	values := o.values()
+
+	var value *bool
+	if len(args) > 0 {
+		switch args[0] {
+		case "-s":
+			enabled := true
+			value = &enabled
+			args = args[1:]
+		case "-u":
+			disabled := false
+			value = &disabled
+			args = args[1:]
+		}
+	}
+	for _, name := range args {
+		if _, ok := values[name]; !ok {
+			return fmt.Errorf("shopt: %s: invalid shell option name", name)
+		}
+	}
+
+	names := args
+	if len(names) == 0 {
+		if value != nil {
+			return nil
+		}
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		if value != nil {
+			*values[name] = *value
+			continue
+		}
+		status := "off"
+		if *values[name] {
+			status = "on"
+		}
+		if _, err := fmt.Fprintf(stdout, "%-15s\t%s\n", name, status); err != nil {
+			return fmt.Errorf("shopt: %w", err)
+		}
+	}
+	return nil
+}
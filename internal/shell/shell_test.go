@@ -72,7 +72,7 @@ func TestShell_Run(t *testing.T) {
 		return Shell{
 			logger:        logger,
 			terminal:      terminal,
-			commandRunner: commandRunner{},
+			commandRunner: &commandRunner{},
 		}
 	}
 
@@ -114,15 +114,14 @@ func TestShell_Run(t *testing.T) {
 				done <- true
 			}()
 
-			for index, command := range tc.inputCommands {
+			for _, command := range tc.inputCommands {
 				got, err := tmpFile.Write(command)
 				require.Equal(t, len(command), got)
 				require.NoError(t, err)
 
-				if index < len(tc.inputCommands)-1 {
-					written <- true
-					<-read
-				}
+				// exit is also a command, which stops a shell
+				written <- true
+				<-read
 			}
 			<-done
 		})
@@ -134,6 +133,7 @@ func TestShell_Run(t *testing.T) {
 			inputCommands [][]byte
 			signal        syscall.Signal
 			assertFunc    func(t *testing.T, f func())
+			wantJobs      int
 		}{
 			{
 				name: "Ctrl-C",
@@ -157,8 +157,12 @@ func TestShell_Run(t *testing.T) {
 				},
 				signal: syscall.SIGTSTP,
 				assertFunc: func(t *testing.T, f func()) {
-					assert.PanicsWithValue(t, "Pausing a process has not been implemented yet", f)
+					time := measureTime(f)
+					if time.Seconds() >= 2 {
+						assert.Fail(t, "sleep 2 should be stopped")
+					}
 				},
+				wantJobs: 1,
 			},
 		}
 
@@ -199,6 +203,9 @@ func TestShell_Run(t *testing.T) {
 								// Send the signal to the test process
 								syscall.Kill(syscall.Getpid(), tc.signal)
 								<-read
+							} else {
+								written <- true
+								<-read
 							}
 						}
 						done <- true
@@ -215,6 +222,11 @@ func TestShell_Run(t *testing.T) {
 					assert.NoError(t, gotErr)
 					<-done
 				})
+
+				assert.Len(t, s.commandRunner.jobs, tc.wantJobs)
+				for _, j := range s.commandRunner.jobs {
+					syscall.Kill(-j.pgid, syscall.SIGKILL)
+				}
 			})
 		}
 	})
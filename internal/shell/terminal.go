@@ -1,12 +1,14 @@
 package shell
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 	"unicode"
 	"unicode/utf8"
 
@@ -14,6 +16,7 @@ import (
 	"github.com/at-ishikawa/go-shell/internal/keyboard"
 	"github.com/at-ishikawa/go-shell/internal/plugin"
 	"github.com/at-ishikawa/go-shell/internal/plugin/kubectl"
+	"github.com/at-ishikawa/go-shell/internal/syntax"
 	"go.uber.org/zap"
 )
 
@@ -26,7 +29,9 @@ type terminal struct {
 	candidateCommand string
 	commandSuggester commandSuggester
 	history          *config.History
-	logger           *zap.Logger
+	// historyChannel is closed or sent when the last command is stored into the history
+	historyChannel chan struct{}
+	logger         *zap.Logger
 }
 
 func newTerminal(
@@ -86,22 +91,42 @@ func (term *terminal) readPrompt() (string, error) {
 	return fmt.Sprintf("[%s|%s] $ ", kubeCtx, kubeNamespace), nil
 }
 
-func (term *terminal) start(f func(inputCommand string) (int, error)) error {
+// errExit is returned by a command to stop the shell
+var errExit = errors.New("exit")
+
+// commandResult is the result of an input, which is stored into a history
+type commandResult struct {
+	// historyCommand is stored into a history instead of the input
+	historyCommand string
+	exitCode       int
+	executionTime  *config.ExecutionTime
+	notification   notificationOptions
+	// dir is the working directory where the command started
+	dir       string
+	startedAt time.Time
+}
+
+// start reads and runs commands until a command returns errExit.
+// beforePrompt is called every time before a prompt is shown, and returns a prompt or an empty string for the default one
+func (term *terminal) start(f func(inputCommand string) (commandResult, error), beforePrompt func() string) error {
 	interruptSignals := make(chan os.Signal, 1)
 	defer signal.Stop(interruptSignals)
-	signal.Notify(interruptSignals, syscall.SIGINT)
+	signal.Notify(interruptSignals, syscall.SIGINT, syscall.SIGTSTP)
 	go func() {
-		// Don't cancel a shell when the child command is canceled
+		// Don't cancel or stop a shell when the child command is canceled or stopped
 		for {
 			<-interruptSignals
 		}
 	}()
 
-	var historyChannel chan struct{}
 	for {
-		prompt, err := term.readPrompt()
-		if err != nil {
-			fmt.Println(err)
+		prompt := beforePrompt()
+		if prompt == "" {
+			var err error
+			prompt, err = term.readPrompt()
+			if err != nil {
+				fmt.Println(err)
+			}
 		}
 		if prompt != "" {
 			term.setPrompt(prompt)
@@ -116,34 +141,57 @@ func (term *terminal) start(f func(inputCommand string) (int, error)) error {
 		if inputCommand == "" {
 			continue
 		}
-		if inputCommand == "exit" {
+		// wait for the previous stored history process will be done
+		term.waitHistory()
+
+		result, err := f(inputCommand)
+		if errors.Is(err, errExit) {
 			break
 		}
-
-		exitCode, err := f(inputCommand)
 		if err != nil {
 			fmt.Fprintln(term.stdErr.file, err)
 		}
+		if result.executionTime != nil && result.notification.shouldNotify(result.executionTime.Real, result.exitCode) {
+			writeNotification(term.out.file, result.notification.method, result.historyCommand, result.exitCode, result.executionTime.Real)
+		}
 
-		context, err := term.commandSuggester.getContext(inputCommand)
+		context, err := term.commandSuggester.getContext(result.historyCommand)
 		if err != nil {
 			term.logger.Error("failed term.commandSuggester.getContext: %w", zap.Error(err))
 		}
 
-		// wait for the previous stored history process will be done
-		if historyChannel != nil {
-			<-historyChannel
-		}
-		// In order to avoid storing commands with syntax error, do not store commands failed
-		historyChannel = term.history.Sync(inputCommand, exitCode, context, term.logger)
-	}
-	if historyChannel != nil {
-		<-historyChannel
+		// A failed command is also stored with its exit status, like one with a syntax error
+		term.historyChannel = term.history.Sync(config.Execution{
+			Command:    result.historyCommand,
+			Dir:        result.dir,
+			StartedAt:  result.startedAt,
+			Time:       result.executionTime,
+			ExitStatus: result.exitCode,
+			Context:    context,
+		}, term.logger)
 	}
+	term.waitHistory()
 
 	return nil
 }
 
+func (term *terminal) waitHistory() {
+	if term.historyChannel != nil {
+		<-term.historyChannel
+		term.historyChannel = nil
+	}
+}
+
+// refreshHistory reads commands which other shells stored, after the last command of this shell is stored.
+// It's called when a prompt is shown and a user looks for a command in the history,
+// and the history file is read only if its size changed
+func (term *terminal) refreshHistory() {
+	term.waitHistory()
+	if err := term.history.Refresh(); err != nil {
+		term.logger.Error("Failed to refresh a history", zap.Error(err))
+	}
+}
+
 func (term *terminal) updateInputCommand(str string) string {
 	term.candidateCommand = ""
 	return str
@@ -162,6 +210,7 @@ func (term *terminal) moveCursorBackward(inputCommand string) {
 }
 
 func (term *terminal) showPreviousCommandFromHistory(inputCommand string) string {
+	term.refreshHistory()
 	previousCommand := term.history.Previous()
 	if previousCommand != "" {
 		inputCommand = term.updateInputCommand(previousCommand)
@@ -170,6 +219,7 @@ func (term *terminal) showPreviousCommandFromHistory(inputCommand string) string
 }
 
 func (term *terminal) showNextCommandFromHistory(inputCommand string) string {
+	term.refreshHistory()
 	nextCommand, ok := term.history.Next()
 	if ok {
 		inputCommand = term.updateInputCommand(nextCommand)
@@ -228,6 +278,7 @@ func (term *terminal) handleShortcutKey(inputCommand string, keyEvent keyboard.K
 			term.out.cursor++
 			break
 		case keyboard.R:
+			term.refreshHistory()
 			var err error
 			inputCommand, err = term.suggest(inputCommand, func(arg plugin.SuggestArg) ([]string, error) {
 				return term.commandSuggester.suggestHistory(arg)
@@ -311,7 +362,7 @@ func (term *terminal) handleShortcutKey(inputCommand string, keyEvent keyboard.K
 		break
 	case keyboard.Tab:
 		suggested, err := term.suggest(inputCommand, func(arg plugin.SuggestArg) ([]string, error) {
-			return term.commandSuggester.suggestCommand(inputCommand, arg)
+			return term.commandSuggester.suggestCommand(arg)
 		})
 		if err != nil {
 			term.logger.Error("Failed to suggest", zap.Error(err))
@@ -330,7 +381,8 @@ func (term *terminal) handleShortcutKey(inputCommand string, keyEvent keyboard.K
 		} else {
 			inputCommand = inputCommand + string(keyEvent.Rune)
 		}
-		term.candidateCommand = term.history.StartWith(inputCommand, 0)
+		// Candidates use the history refreshed at the prompt instead of reading it on each key
+		term.candidateCommand = term.history.StartWith(inputCommand)
 		if inputCommand == term.candidateCommand {
 			term.candidateCommand = ""
 		}
@@ -339,11 +391,20 @@ func (term *terminal) handleShortcutKey(inputCommand string, keyEvent keyboard.K
 	return inputCommand, nil
 }
 
+// continuationPrompt is shown for the next line of an incomplete command like an unclosed quote
+const continuationPrompt = "> "
+
 func (term *terminal) getInputCommand() (string, error) {
 	term.out.initNewLine()
 	term.out.setCursor(0)
+	prompt := term.out.prompt
+	defer term.setPrompt(prompt)
 
 	term.candidateCommand = ""
+	term.refreshHistory()
+	term.history.ResetNavigation()
+	// previousLines are lines of an incomplete command before the current line
+	previousLines := ""
 	inputCommand := ""
 	for {
 		keyEvent, err := term.in.Read()
@@ -352,6 +413,7 @@ func (term *terminal) getInputCommand() (string, error) {
 		if err == io.EOF {
 			term.out.writeLine(inputCommand, "")
 			term.out.newLine()
+			inputCommand = previousLines + inputCommand
 			break
 		} else if err != nil {
 			term.out.writeLine(inputCommand, "")
@@ -360,7 +422,16 @@ func (term *terminal) getInputCommand() (string, error) {
 		if keyEvent.KeyCode == keyboard.Enter {
 			term.out.writeLine(inputCommand, "")
 			term.out.newLine()
-			break
+			inputCommand = previousLines + inputCommand
+			if !isIncompleteCommand(inputCommand) {
+				break
+			}
+			previousLines = inputCommand + "\n"
+			inputCommand = ""
+			term.candidateCommand = ""
+			term.setPrompt(continuationPrompt)
+			term.out.initNewLine()
+			continue
 		}
 		if keyEvent.IsControlPressed && keyEvent.KeyCode == keyboard.C {
 			term.out.writeLine(inputCommand, "")
@@ -386,40 +457,62 @@ func (term *terminal) getInputCommand() (string, error) {
 	return inputCommand, nil
 }
 
+// isIncompleteCommand returns true if a command can be valid with more lines, like if without fi
+func isIncompleteCommand(inputCommand string) bool {
+	_, err := syntax.Parse(inputCommand)
+	var syntaxError *syntax.SyntaxError
+	return errors.As(err, &syntaxError) && syntaxError.IsIncomplete
+}
+
 func (term *terminal) suggest(inputCommand string, suggestFunc func(plugin.SuggestArg) ([]string, error)) (string, error) {
-	// move these logics to terminal
-	var currentArgToken string
-	var previousArgs string
-	if len(inputCommand) > 1 {
-		previousChar := inputCommand[len(inputCommand)+term.out.cursor-1]
-		if previousChar != ' ' {
-			lastSpaceIndex := strings.LastIndex(inputCommand, " ")
-			if lastSpaceIndex != -1 {
-				currentArgToken = inputCommand[lastSpaceIndex:]
-				previousArgs = inputCommand[:lastSpaceIndex]
-			} else {
-				currentArgToken = inputCommand
+	cursorIndex := len(inputCommand) + term.out.cursor
+	commandBeforeCursor := inputCommand[:cursorIndex]
+	commandAfterCursor := inputCommand[cursorIndex:]
+
+	// Tokens are returned even if the command is incomplete, like an unclosed quote
+	tokens, _ := syntax.Tokenize(commandBeforeCursor)
+	// Suggest only for the words of the current command in a pipeline or a list
+	var words []syntax.Token
+	for _, token := range tokens {
+		switch token.Type {
+		case syntax.WordToken:
+			words = append(words, token)
+		case syntax.NewlineToken:
+			words = nil
+		case syntax.OperatorToken:
+			switch token.Value {
+			case "|", "||", "&&", ";", "&", "(", ")", ";;":
+				words = nil
 			}
 		}
 	}
 
+	var currentArgToken string
+	replacedIndex := len(commandBeforeCursor)
+	if len(words) > 0 {
+		lastWord := words[len(words)-1]
+		if lastWord.End == len(commandBeforeCursor) {
+			currentArgToken = lastWord.Word.Unquoted()
+			replacedIndex = lastWord.Pos
+		}
+	}
+	args := make([]string, 0, len(words))
+	for _, word := range words {
+		args = append(args, word.Word.Unquoted())
+	}
+
 	arg := plugin.SuggestArg{
 		Command:         inputCommand,
-		Args:            strings.Fields(inputCommand),
+		Args:            args,
 		History:         term.history,
-		CurrentArgToken: strings.TrimSpace(currentArgToken),
+		CurrentArgToken: currentArgToken,
 	}
 	suggested, err := suggestFunc(arg)
 	if err != nil {
 		return inputCommand, err
 	}
 	if len(suggested) > 0 {
-		if previousArgs != "" {
-			inputCommand = previousArgs + " " + strings.Join(suggested, " ")
-		} else {
-			inputCommand = inputCommand + strings.Join(suggested, " ")
-		}
-		inputCommand = inputCommand + " "
+		inputCommand = commandBeforeCursor[:replacedIndex] + strings.Join(suggested, " ") + " " + commandAfterCursor
 	}
 	return inputCommand, nil
 }
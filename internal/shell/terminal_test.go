@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/at-ishikawa/go-shell/internal/config"
@@ -84,16 +85,38 @@ func TestGetNextWord(t *testing.T) {
 func TestTerminal_getInputCommand(t *testing.T) {
 	testCases := []struct {
 		name        string
-		keyCodes    keyboard.Code
+		input       []byte
 		wantCommand string
+		wantPrompt  string
 	}{
 		{
-			name:     "Enter only",
-			keyCodes: keyboard.Enter,
+			name:  "Enter only",
+			input: keyboard.Enter.Bytes(),
 		},
 		{
-			name:     "Control C",
-			keyCodes: keyboard.ControlC,
+			name:  "Control C",
+			input: keyboard.ControlC.Bytes(),
+		},
+		{
+			name:        "a command",
+			input:       append([]byte("ls"), keyboard.Enter.Bytes()...),
+			wantCommand: "ls",
+		},
+		{
+			name: "an incomplete command continues on the next line",
+			input: bytes.Join([][]byte{
+				[]byte("if true"),
+				[]byte("then echo 'a"),
+				[]byte("b'; fi"),
+			}, keyboard.Enter.Bytes()),
+			wantCommand: "if true\nthen echo 'a\nb'; fi",
+		},
+		{
+			name: "Control C cancels all lines",
+			input: bytes.Join([][]byte{
+				[]byte("for a in b"),
+				keyboard.ControlC.Bytes(),
+			}, keyboard.Enter.Bytes()),
 		},
 	}
 
@@ -101,15 +124,19 @@ func TestTerminal_getInputCommand(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			term := terminal{
 				in: input{
-					// Currently, this only reads the first letter
-					reader:     bufio.NewReaderSize(bytes.NewReader(tc.keyCodes.Bytes()), 1),
-					bufferSize: 8,
+					reader:     bufio.NewReader(iotest.OneByteReader(bytes.NewReader(tc.input))),
+					bufferSize: 1,
 				},
-				logger: zap.NewNop(),
+				out: output{
+					prompt: "$ ",
+				},
+				history: &config.History{},
+				logger:  zap.NewNop(),
 			}
 			got, gotErr := term.getInputCommand()
 			assert.NoError(t, gotErr)
 			assert.Equal(t, tc.wantCommand, got)
+			assert.Equal(t, "$ ", term.out.prompt)
 		})
 	}
 }
@@ -1013,6 +1040,64 @@ func TestTerminal_HandleShortcutKey(t *testing.T) {
 
 				wantCommand: "ls /tmp ",
 			},
+			{
+				name: "suggest for the current command in a pipeline",
+
+				inputCommand: "kubectl get pods | gr",
+				keyEvent: keyboard.KeyEvent{
+					KeyCode: keyboard.Tab,
+				},
+
+				mockCommandSuggester: func(mockController *gomock.Controller) commandSuggester {
+					mockKubectlPlugin := plugin.NewMockPlugin(mockController)
+					mockPlugin := plugin.NewMockPlugin(mockController)
+					mockPlugin.EXPECT().Suggest(plugin.SuggestArg{
+						Command:         "kubectl get pods | gr",
+						Args:            []string{"gr"},
+						CurrentArgToken: "gr",
+					}).Return([]string{"grep"}, nil).Times(1)
+					mockCommandSuggester := commandSuggester{
+						plugins: map[string]plugin.Plugin{
+							"kubectl": mockKubectlPlugin,
+						},
+						defaultPlugin: mockPlugin,
+					}
+					return mockCommandSuggester
+				},
+
+				wantCommand: "kubectl get pods | grep ",
+			},
+			{
+				name: "suggest for a quoted argument before the cursor",
+				terminal: terminal{
+					out: output{
+						cursor: -3,
+					},
+				},
+
+				inputCommand: `git commit -m "a b" -s`,
+				keyEvent: keyboard.KeyEvent{
+					KeyCode: keyboard.Tab,
+				},
+
+				mockCommandSuggester: func(mockController *gomock.Controller) commandSuggester {
+					mockPlugin := plugin.NewMockPlugin(mockController)
+					mockPlugin.EXPECT().Suggest(plugin.SuggestArg{
+						Command:         `git commit -m "a b" -s`,
+						Args:            []string{"git", "commit", "-m", "a b"},
+						CurrentArgToken: "a b",
+					}).Return([]string{"message"}, nil).Times(1)
+					mockCommandSuggester := commandSuggester{
+						plugins: map[string]plugin.Plugin{
+							"git": mockPlugin,
+						},
+					}
+					return mockCommandSuggester
+				},
+
+				wantCommand: "git commit -m message  -s",
+				wantCursor:  -3,
+			},
 		}
 
 		for _, tc := range testCases {
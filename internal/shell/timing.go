@@ -0,0 +1,105 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/at-ishikawa/go-shell/internal/config"
+)
+
+// cpuUsage is the total CPU time of processes which the shell waited for.
+// It's shared with subshells because they wait for processes concurrently with the shell
+type cpuUsage struct {
+	mu     sync.Mutex
+	user   time.Duration
+	system time.Duration
+}
+
+// add adds the CPU time of a process reported by wait4
+func (u *cpuUsage) add(rusage syscall.Rusage) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.user += time.Duration(rusage.Utime.Nano())
+	u.system += time.Duration(rusage.Stime.Nano())
+}
+
+func (u *cpuUsage) get() (time.Duration, time.Duration) {
+	if u == nil {
+		return 0, 0
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.user, u.system
+}
+
+// shellCPUTime returns the user and system CPU time of the shell process itself,
+// which includes builtins, functions and compound commands
+func shellCPUTime() (time.Duration, time.Duration) {
+	var self syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &self); err != nil {
+		return 0, 0
+	}
+	return time.Duration(self.Utime.Nano()), time.Duration(self.Stime.Nano())
+}
+
+// cpuTime returns the user and system CPU time of the shell and processes which it waited for
+func (cr *commandRunner) cpuTime() (time.Duration, time.Duration) {
+	user, system := shellCPUTime()
+	childrenUser, childrenSystem := cr.cpuUsage.get()
+	return user + childrenUser, system + childrenSystem
+}
+
+// addCPUTime adds the CPU time of processes in a job which exited, and each process is counted only once
+func (cr *commandRunner) addCPUTime(j *job) {
+	for _, p := range j.processes {
+		if !p.isDone {
+			continue
+		}
+		cr.cpuUsage.add(p.rusage)
+		p.rusage = syscall.Rusage{}
+	}
+}
+
+// measureExecutionTime runs f and returns how long it took including commands which f waited for.
+// Unlike the CPU time of RUSAGE_CHILDREN, the one of background jobs reaped while f runs isn't included
+func (cr *commandRunner) measureExecutionTime(f func()) *config.ExecutionTime {
+	startedAt := time.Now()
+	startUser, startSystem := cr.cpuTime()
+	f()
+	endUser, endSystem := cr.cpuTime()
+	return &config.ExecutionTime{
+		Real:   time.Since(startedAt),
+		User:   endUser - startUser,
+		System: endSystem - startSystem,
+	}
+}
+
+// writeExecutionTime writes times like bash, or in the POSIX format with isPortable
+func writeExecutionTime(w io.Writer, executionTime *config.ExecutionTime, isPortable bool) {
+	if isPortable {
+		fmt.Fprintf(w, "real %.2f\nuser %.2f\nsys %.2f\n",
+			executionTime.Real.Seconds(),
+			executionTime.User.Seconds(),
+			executionTime.System.Seconds(),
+		)
+		return
+	}
+	fmt.Fprintf(w, "\nreal\t%s\nuser\t%s\nsys\t%s\n",
+		formatMinutes(executionTime.Real),
+		formatMinutes(executionTime.User),
+		formatMinutes(executionTime.System),
+	)
+}
+
+// formatMinutes formats a duration like 1m2.345s
+func formatMinutes(d time.Duration) string {
+	minutes := int(d / time.Minute)
+	seconds := (d % time.Minute).Seconds()
+	return fmt.Sprintf("%dm%.3fs", minutes, seconds)
+}
@@ -0,0 +1,139 @@
+package shell
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/at-ishikawa/go-shell/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteExecutionTime(t *testing.T) {
+	executionTime := &config.ExecutionTime{
+		Real:   61*time.Second + 234*time.Millisecond,
+		User:   500 * time.Millisecond,
+		System: 5 * time.Millisecond,
+	}
+	testCases := []struct {
+		name       string
+		isPortable bool
+		want       string
+	}{
+		{
+			name: "the bash format",
+			want: "\nreal\t1m1.234s\nuser\t0m0.500s\nsys\t0m0.005s\n",
+		},
+		{
+			name:       "the POSIX format",
+			isPortable: true,
+			want:       "real 61.23\nuser 0.50\nsys 0.01\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got bytes.Buffer
+			writeExecutionTime(&got, executionTime, tc.isPortable)
+			assert.Equal(t, tc.want, got.String())
+		})
+	}
+}
+
+func TestCommandRunner_TimedPipeline(t *testing.T) {
+	testCases := []struct {
+		name         string
+		inputCommand string
+
+		wantOutput      string
+		wantErrorOutput string
+		wantExitCode    int
+	}{
+		{
+			name:            "time a pipeline",
+			inputCommand:    `time echo a | tr a-z A-Z`,
+			wantOutput:      "A\n",
+			wantErrorOutput: `^\nreal\t0m0\.\d{3}s\nuser\t0m0\.\d{3}s\nsys\t0m0\.\d{3}s\n$`,
+		},
+		{
+			name:            "time in the POSIX format",
+			inputCommand:    `time -p sleep 0.1`,
+			wantErrorOutput: `^real 0\.(1|2)\d\nuser 0\.\d{2}\nsys 0\.\d{2}\n$`,
+		},
+		{
+			name:            "the CPU time of a process which the shell waited for",
+			inputCommand:    `time -p sh -c 'i=0; while [ $i -lt 100000 ]; do i=$((i+1)); done'`,
+			wantErrorOutput: `^real \d+\.\d{2}\nuser (0\.(0[1-9]|[1-9]\d)|[1-9]\d*\.\d{2})\nsys \d+\.\d{2}\n$`,
+		},
+		{
+			name:            "the exit status of a timed pipeline",
+			inputCommand:    `time ! true; time false`,
+			wantErrorOutput: `^(\nreal.+\nuser.+\nsys.+\n){2}$`,
+			wantExitCode:    1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := os.CreateTemp("", "output")
+			require.NoError(t, err)
+			defer os.Remove(out.Name())
+			defer out.Close()
+			errorOut, err := os.CreateTemp("", "error")
+			require.NoError(t, err)
+			defer os.Remove(errorOut.Name())
+			defer errorOut.Close()
+
+			cr := newCommandRunner("/home/user", false)
+			gotExitCode, _ := cr.runInput(tc.inputCommand, [3]*os.File{os.Stdin, out, errorOut})
+			assert.Equal(t, tc.wantExitCode, gotExitCode)
+
+			gotOutput, err := os.ReadFile(out.Name())
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantOutput, string(gotOutput))
+			gotErrorOutput, err := os.ReadFile(errorOut.Name())
+			require.NoError(t, err)
+			assert.Regexp(t, tc.wantErrorOutput, string(gotErrorOutput))
+		})
+	}
+}
+
+func TestCommandRunner_addCPUTime(t *testing.T) {
+	cr := newCommandRunner("/home/user", false)
+	j := &job{
+		processes: []*jobProcess{
+			{pid: 1, isDone: true, rusage: syscall.Rusage{Utime: syscall.Timeval{Sec: 1}, Stime: syscall.Timeval{Usec: 2000}}},
+			{pid: 2, isStopped: true, rusage: syscall.Rusage{Utime: syscall.Timeval{Sec: 10}}},
+			{isDone: true},
+		},
+	}
+	cr.addCPUTime(j)
+	// A process already counted isn't added again when a stopped job continues and exits
+	cr.addCPUTime(j)
+
+	gotUser, gotSystem := cr.cpuUsage.get()
+	assert.Equal(t, time.Second, gotUser)
+	assert.Equal(t, 2*time.Millisecond, gotSystem)
+}
+
+func TestCommandRunner_ExecutionTimeVariables(t *testing.T) {
+	cr := newCommandRunner("/home/user", false)
+	require.NoError(t, cr.setVariable("PS1", "${COMMAND_REAL_TIME}s $ "))
+	assert.Equal(t, "s $ ", cr.prompt())
+
+	cr.lastExecutionTime = &config.ExecutionTime{
+		Real:   1500 * time.Millisecond,
+		User:   20 * time.Millisecond,
+		System: 3 * time.Millisecond,
+	}
+	assert.Equal(t, "1.500s $ ", cr.prompt())
+	for name, want := range map[string]string{
+		"COMMAND_USER_TIME":   "0.020",
+		"COMMAND_SYSTEM_TIME": "0.003",
+	} {
+		got, ok := cr.getVariable(name)
+		assert.True(t, ok)
+		assert.Equal(t, want, got)
+	}
+}
@@ -0,0 +1,127 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/at-ishikawa/go-shell/internal/syntax"
+)
+
+// getVariable returns a value of a special parameter, a shell variable, or an environment variable.
+// Exported variables are stored in the environment variables of the shell process, or the ones of an isolated subshell
+func (cr *commandRunner) getVariable(name string) (string, bool) {
+	switch name {
+	case "?":
+		return strconv.Itoa(cr.lastExitCode), true
+	case "$":
+		return strconv.Itoa(os.Getpid()), true
+	case "!":
+		if cr.lastBackgroundPid == 0 {
+			return "", false
+		}
+		return strconv.Itoa(cr.lastBackgroundPid), true
+	case "0":
+		if cr.name == "" {
+			return os.Args[0], true
+		}
+		return cr.name, true
+	case "#":
+		return strconv.Itoa(len(cr.positionalParameters)), true
+	case "@", "*":
+		return strings.Join(cr.positionalParameters, " "), true
+	case "PWD":
+		if dir, err := cr.currentDir(); err == nil {
+			return dir, true
+		}
+	case "COMMAND_REAL_TIME", "COMMAND_USER_TIME", "COMMAND_SYSTEM_TIME":
+		// Seconds which the last input took, like for a prompt
+		if cr.lastExecutionTime == nil {
+			return "", false
+		}
+		duration := map[string]time.Duration{
+			"COMMAND_REAL_TIME":   cr.lastExecutionTime.Real,
+			"COMMAND_USER_TIME":   cr.lastExecutionTime.User,
+			"COMMAND_SYSTEM_TIME": cr.lastExecutionTime.System,
+		}[name]
+		return strconv.FormatFloat(duration.Seconds(), 'f', 3, 64), true
+	}
+	if index, err := strconv.Atoi(name); err == nil {
+		if index < 1 || index > len(cr.positionalParameters) {
+			return "", false
+		}
+		return cr.positionalParameters[index-1], true
+	}
+	if value, ok := cr.variables[name]; ok {
+		return value, true
+	}
+	return cr.lookupEnv(name)
+}
+
+// prompt returns $PS1 where variables like $PWD are expanded, or an empty string if PS1 isn't set
+func (cr *commandRunner) prompt() string {
+	ps1, ok := cr.getVariable("PS1")
+	if !ok {
+		return ""
+	}
+	return os.Expand(ps1, func(name string) string {
+		value, _ := cr.getVariable(name)
+		return value
+	})
+}
+
+func (cr *commandRunner) setVariable(name string, value string) error {
+	if !syntax.IsName(name) {
+		return fmt.Errorf("%s: not a valid identifier", name)
+	}
+	if _, ok := cr.lookupEnv(name); ok {
+		return cr.setEnv(name, value)
+	}
+	if cr.variables == nil {
+		cr.variables = make(map[string]string)
+	}
+	cr.variables[name] = value
+	return nil
+}
+
+// exportVariable moves a shell variable into environment variables so that child processes inherit it
+func (cr *commandRunner) exportVariable(name string) error {
+	if !syntax.IsName(name) {
+		return fmt.Errorf("%s: not a valid identifier", name)
+	}
+	value, ok := cr.variables[name]
+	if !ok {
+		return nil
+	}
+	delete(cr.variables, name)
+	return cr.setEnv(name, value)
+}
+
+// export runs the export command.
+// Without arguments, it writes all exported variables
+func (cr *commandRunner) export(args []string, stdout *os.File) error {
+	if len(args) == 0 {
+		for _, env := range cr.environ() {
+			name, value, _ := strings.Cut(env, "=")
+			if _, err := fmt.Fprintf(stdout, "export %s=%s\n", name, strconv.Quote(value)); err != nil {
+				return fmt.Errorf("export: %w", err)
+			}
+		}
+		return nil
+	}
+
+	for _, arg := range args {
+		name, value, hasValue := strings.Cut(arg, "=")
+		if hasValue {
+			if err := cr.setVariable(name, value); err != nil {
+				return err
+			}
+		}
+		if err := cr.exportVariable(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
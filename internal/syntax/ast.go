@@ -0,0 +1,290 @@
+package syntax
+
+import "strings"
+
+// List is a sequence of and-or lists separated by ;, & or newlines
+type List struct {
+	Items []*AndOr
+}
+
+type AndOrOperator string
+
+const (
+	AndOperator AndOrOperator = "&&"
+	OrOperator  AndOrOperator = "||"
+)
+
+// AndOr is pipelines joined with && or ||
+type AndOr struct {
+	Pipelines []*Pipeline
+	// Operators[i] is the operator between Pipelines[i] and Pipelines[i+1]
+	Operators    []AndOrOperator
+	IsBackground bool
+}
+
+type Pipeline struct {
+	Commands  []Command
+	IsNegated bool
+	// IsTimed is true for time pipeline, which writes how long the pipeline took
+	IsTimed bool
+	// IsPortableTime is true for time -p, which writes times in the POSIX format
+	IsPortableTime bool
+}
+
+type Command interface {
+	commandNode()
+}
+
+type SimpleCommand struct {
+	Assignments  []*Assignment
+	Words        []*Word
+	Redirections []*Redirection
+}
+
+// Assignment is NAME=value before a command name
+type Assignment struct {
+	Name  string
+	Value *Word
+}
+
+type Subshell struct {
+	List         *List
+	Redirections []*Redirection
+}
+
+// BraceGroup is { list; }
+type BraceGroup struct {
+	List         *List
+	Redirections []*Redirection
+}
+
+// IfClause is if list; then list; [elif list; then list;]... [else list;] fi
+type IfClause struct {
+	// Conditions[i] is the condition of Bodies[i], for if and each elif
+	Conditions   []*List
+	Bodies       []*List
+	Else         *List
+	Redirections []*Redirection
+}
+
+// ForClause is for name [in word...]; do list; done.
+// Without in, it iterates over positional parameters
+type ForClause struct {
+	Name         string
+	Words        []*Word
+	HasIn        bool
+	Body         *List
+	Redirections []*Redirection
+}
+
+// WhileClause is while list; do list; done, or until list; do list; done
+type WhileClause struct {
+	Condition    *List
+	Body         *List
+	IsUntil      bool
+	Redirections []*Redirection
+}
+
+// CaseClause is case word in [(]pattern[|pattern]...) list;; ... esac
+type CaseClause struct {
+	Word         *Word
+	Items        []*CaseItem
+	Redirections []*Redirection
+}
+
+type CaseItem struct {
+	Patterns []*Word
+	Body     *List
+}
+
+// FunctionDefinition is name() compound-command
+type FunctionDefinition struct {
+	Name string
+	Body Command
+}
+
+func (*SimpleCommand) commandNode()      {}
+func (*Subshell) commandNode()           {}
+func (*BraceGroup) commandNode()         {}
+func (*IfClause) commandNode()           {}
+func (*ForClause) commandNode()          {}
+func (*WhileClause) commandNode()        {}
+func (*CaseClause) commandNode()         {}
+func (*FunctionDefinition) commandNode() {}
+
+type RedirectionOperator string
+
+const (
+	RedirectInput     RedirectionOperator = "<"
+	RedirectOutput    RedirectionOperator = ">"
+	RedirectClobber   RedirectionOperator = ">|"
+	RedirectAppend    RedirectionOperator = ">>"
+	RedirectReadWrite RedirectionOperator = "<>"
+	DuplicateInput    RedirectionOperator = "<&"
+	DuplicateOutput   RedirectionOperator = ">&"
+	RedirectAllOutput RedirectionOperator = "&>"
+	AppendAllOutput   RedirectionOperator = "&>>"
+)
+
+type Redirection struct {
+	Fd       int
+	Operator RedirectionOperator
+	Target   *Word
+}
+
+// Word is a shell word which consists of quoted and unquoted parts
+type Word struct {
+	Parts []WordPart
+}
+
+type WordPart interface {
+	wordPart()
+}
+
+// Literal is an unquoted string
+type Literal struct {
+	Value string
+}
+
+// SingleQuoted is a string in single quotes, ANSI-C quotes, or a character escaped by a backslash
+type SingleQuoted struct {
+	Value string
+}
+
+type DoubleQuoted struct {
+	Parts []WordPart
+}
+
+type ParameterOperator string
+
+const (
+	// ${#NAME}
+	LengthOperator ParameterOperator = "#"
+
+	// ${NAME:-word} and ${NAME-word}
+	DefaultValueOperator      ParameterOperator = ":-"
+	UnsetDefaultValueOperator ParameterOperator = "-"
+	// ${NAME:=word} and ${NAME=word}
+	AssignDefaultOperator      ParameterOperator = ":="
+	UnsetAssignDefaultOperator ParameterOperator = "="
+	// ${NAME:?word} and ${NAME?word}
+	ErrorOperator      ParameterOperator = ":?"
+	UnsetErrorOperator ParameterOperator = "?"
+	// ${NAME:+word} and ${NAME+word}
+	AlternativeValueOperator      ParameterOperator = ":+"
+	UnsetAlternativeValueOperator ParameterOperator = "+"
+)
+
+// ParameterExpansion is $NAME or ${NAME...}.
+// Name can be a special parameter like ? or a positional parameter like 1
+type ParameterExpansion struct {
+	Name     string
+	Operator ParameterOperator
+	Word     *Word
+}
+
+// CommandSubstitution is $(...) or `...`
+type CommandSubstitution struct {
+	List *List
+	// Source is the original string including $( and )
+	Source string
+}
+
+func (*Literal) wordPart()             {}
+func (*SingleQuoted) wordPart()        {}
+func (*DoubleQuoted) wordPart()        {}
+func (*ParameterExpansion) wordPart()  {}
+func (*CommandSubstitution) wordPart() {}
+
+// Unquoted returns the string of the word after the quote removal
+func (w *Word) Unquoted() string {
+	var sb strings.Builder
+	writeUnquoted(&sb, w.Parts)
+	return sb.String()
+}
+
+func writeUnquoted(sb *strings.Builder, parts []WordPart) {
+	for _, part := range parts {
+		switch p := part.(type) {
+		case *Literal:
+			sb.WriteString(p.Value)
+		case *SingleQuoted:
+			sb.WriteString(p.Value)
+		case *DoubleQuoted:
+			writeUnquoted(sb, p.Parts)
+		case *ParameterExpansion:
+			sb.WriteString(p.String())
+		case *CommandSubstitution:
+			sb.WriteString(p.Source)
+		}
+	}
+}
+
+func (p *ParameterExpansion) String() string {
+	if p.Operator == "" {
+		return "$" + p.Name
+	}
+	if p.Operator == LengthOperator {
+		return "${#" + p.Name + "}"
+	}
+	var word string
+	if p.Word != nil {
+		word = p.Word.Unquoted()
+	}
+	return "${" + p.Name + string(p.Operator) + word + "}"
+}
+
+// Fields returns the unquoted words of a simple command
+func (c *SimpleCommand) Fields() []string {
+	fields := make([]string, 0, len(c.Words))
+	for _, w := range c.Words {
+		fields = append(fields, w.Unquoted())
+	}
+	return fields
+}
+
+// SimpleCommands returns all simple commands in a list including ones in compound commands
+func (l *List) SimpleCommands() []*SimpleCommand {
+	if l == nil {
+		return nil
+	}
+	var result []*SimpleCommand
+	for _, andOr := range l.Items {
+		for _, pipeline := range andOr.Pipelines {
+			for _, command := range pipeline.Commands {
+				result = append(result, simpleCommandsOf(command)...)
+			}
+		}
+	}
+	return result
+}
+
+func simpleCommandsOf(command Command) []*SimpleCommand {
+	var result []*SimpleCommand
+	switch c := command.(type) {
+	case *SimpleCommand:
+		result = append(result, c)
+	case *Subshell:
+		result = append(result, c.List.SimpleCommands()...)
+	case *BraceGroup:
+		result = append(result, c.List.SimpleCommands()...)
+	case *IfClause:
+		for i, condition := range c.Conditions {
+			result = append(result, condition.SimpleCommands()...)
+			result = append(result, c.Bodies[i].SimpleCommands()...)
+		}
+		result = append(result, c.Else.SimpleCommands()...)
+	case *ForClause:
+		result = append(result, c.Body.SimpleCommands()...)
+	case *WhileClause:
+		result = append(result, c.Condition.SimpleCommands()...)
+		result = append(result, c.Body.SimpleCommands()...)
+	case *CaseClause:
+		for _, item := range c.Items {
+			result = append(result, item.Body.SimpleCommands()...)
+		}
+	case *FunctionDefinition:
+		result = append(result, simpleCommandsOf(c.Body)...)
+	}
+	return result
+}
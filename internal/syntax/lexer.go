@@ -0,0 +1,574 @@
+package syntax
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type TokenType int
+
+const (
+	EOFToken TokenType = iota
+	WordToken
+	IONumberToken
+	OperatorToken
+	NewlineToken
+)
+
+type Token struct {
+	Type TokenType
+	// Value is the source text of a token
+	Value string
+	Word  *Word
+	Pos   int
+	End   int
+}
+
+// SyntaxError is an error for an invalid input.
+// IsIncomplete is true if an input can be valid by appending more lines
+type SyntaxError struct {
+	Message      string
+	IsIncomplete bool
+}
+
+func (e *SyntaxError) Error() string {
+	return e.Message
+}
+
+func newUnexpectedTokenError(token Token) *SyntaxError {
+	switch token.Type {
+	case EOFToken:
+		return newUnexpectedEOFError()
+	case NewlineToken:
+		return &SyntaxError{Message: "syntax error near unexpected token `newline'"}
+	}
+	return &SyntaxError{Message: fmt.Sprintf("syntax error near unexpected token `%s'", token.Value)}
+}
+
+func newUnexpectedEOFError() *SyntaxError {
+	return &SyntaxError{
+		Message:      "syntax error: unexpected end of file",
+		IsIncomplete: true,
+	}
+}
+
+func newUnmatchedQuoteError(quote string) *SyntaxError {
+	return &SyntaxError{
+		Message:      fmt.Sprintf("unexpected EOF while looking for matching `%s'", quote),
+		IsIncomplete: true,
+	}
+}
+
+// operators are sorted to match the longest one first
+var operators = []string{
+	"&>>", "<<-",
+	"&&", "||", ";;", "&>", "<<", "<&", "<>", ">>", ">&", ">|",
+	"&", "|", ";", "(", ")", "<", ">",
+}
+
+func isMetaChar(c byte) bool {
+	return strings.IndexByte(" \t\n|&;()<>", c) >= 0
+}
+
+type lexer struct {
+	input string
+	pos   int
+}
+
+// Tokenize splits an input into tokens.
+// Even if an input is invalid, it returns tokens until the error including the incomplete token
+func Tokenize(input string) ([]Token, error) {
+	l := lexer{input: input}
+	var tokens []Token
+	for {
+		token, err := l.next()
+		if token.End > token.Pos {
+			tokens = append(tokens, token)
+		}
+		if err != nil {
+			return tokens, err
+		}
+		if token.Type == EOFToken {
+			return tokens, nil
+		}
+	}
+}
+
+func (l *lexer) next() (Token, error) {
+	l.skipBlanks()
+	if l.pos >= len(l.input) {
+		return Token{Type: EOFToken, Pos: l.pos, End: l.pos}, nil
+	}
+
+	start := l.pos
+	c := l.input[l.pos]
+	if c == '\n' {
+		l.pos++
+		return Token{Type: NewlineToken, Value: "\n", Pos: start, End: l.pos}, nil
+	}
+	if isMetaChar(c) {
+		for _, operator := range operators {
+			if strings.HasPrefix(l.input[l.pos:], operator) {
+				l.pos += len(operator)
+				return Token{Type: OperatorToken, Value: operator, Pos: start, End: l.pos}, nil
+			}
+		}
+	}
+	return l.readWord()
+}
+
+func (l *lexer) skipBlanks() {
+	for l.pos < len(l.input) {
+		switch c := l.input[l.pos]; {
+		case c == ' ' || c == '\t':
+			l.pos++
+		case c == '\\' && strings.HasPrefix(l.input[l.pos:], "\\\n"):
+			l.pos += 2
+		case c == '#':
+			for l.pos < len(l.input) && l.input[l.pos] != '\n' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) readWord() (Token, error) {
+	start := l.pos
+	word, err := l.readWordParts(isMetaChar)
+	token := Token{Type: WordToken, Value: l.input[start:l.pos], Word: word, Pos: start, End: l.pos}
+	if err != nil {
+		return token, err
+	}
+
+	if l.pos < len(l.input) && (l.input[l.pos] == '<' || l.input[l.pos] == '>') {
+		if _, err := strconv.Atoi(token.Value); err == nil {
+			token.Type = IONumberToken
+			token.Word = nil
+		}
+	}
+	return token, nil
+}
+
+// readWordParts reads a word until isEnd returns true for an unquoted character
+func (l *lexer) readWordParts(isEnd func(byte) bool) (*Word, error) {
+	word := &Word{}
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		if isEnd(c) {
+			break
+		}
+
+		switch {
+		case c == '\\':
+			if l.pos+1 >= len(l.input) {
+				l.pos++
+				return word, newUnexpectedEOFError()
+			}
+			if l.input[l.pos+1] == '\n' {
+				l.pos += 2
+				continue
+			}
+			_, size := utf8.DecodeRuneInString(l.input[l.pos+1:])
+			word.appendSingleQuoted(l.input[l.pos+1 : l.pos+1+size])
+			l.pos += 1 + size
+		case c == '\'':
+			l.pos++
+			end := strings.IndexByte(l.input[l.pos:], '\'')
+			if end < 0 {
+				word.appendSingleQuoted(l.input[l.pos:])
+				l.pos = len(l.input)
+				return word, newUnmatchedQuoteError("'")
+			}
+			word.appendSingleQuoted(l.input[l.pos : l.pos+end])
+			l.pos += end + 1
+		case c == '"':
+			l.pos++
+			part, err := l.readDoubleQuoted()
+			word.Parts = append(word.Parts, part)
+			if err != nil {
+				return word, err
+			}
+		case strings.HasPrefix(l.input[l.pos:], "$'"):
+			l.pos += 2
+			value, err := l.readAnsiCQuoted()
+			word.appendSingleQuoted(value)
+			if err != nil {
+				return word, err
+			}
+		case strings.HasPrefix(l.input[l.pos:], `$"`):
+			// Locale-specific translation isn't supported, so it's the same as double quotes
+			l.pos += 2
+			part, err := l.readDoubleQuoted()
+			word.Parts = append(word.Parts, part)
+			if err != nil {
+				return word, err
+			}
+		case c == '$':
+			part, err := l.readExpansion()
+			if err != nil {
+				return word, err
+			}
+			if part == nil {
+				word.appendLiteral("$")
+				l.pos++
+				continue
+			}
+			word.Parts = append(word.Parts, part)
+		case c == '`':
+			part, err := l.readBackquoted()
+			if err != nil {
+				return word, err
+			}
+			word.Parts = append(word.Parts, part)
+		default:
+			word.appendLiteral(l.input[l.pos : l.pos+1])
+			l.pos++
+		}
+	}
+	return word, nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isSpecialParameter(c byte) bool {
+	return strings.IndexByte("?$!#@*-", c) >= 0
+}
+
+// IsName returns true if a string can be used as a variable name
+func IsName(str string) bool {
+	if str == "" || !isNameStart(str[0]) {
+		return false
+	}
+	for i := 1; i < len(str); i++ {
+		if !isNameChar(str[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// readExpansion reads $(...), $NAME, ${...}, or a special parameter like $?.
+// It returns nil if the $ is just a literal
+func (l *lexer) readExpansion() (WordPart, error) {
+	if l.pos+1 >= len(l.input) {
+		return nil, nil
+	}
+	c := l.input[l.pos+1]
+	switch {
+	case c == '(':
+		start := l.pos
+		l.pos += 2
+		part, err := l.readCommandSubstitution()
+		if err != nil {
+			return nil, err
+		}
+		part.Source = l.input[start:l.pos]
+		return part, nil
+	case c == '{':
+		l.pos += 2
+		return l.readBracedParameterExpansion()
+	case isNameStart(c):
+		end := l.pos + 1
+		for end < len(l.input) && isNameChar(l.input[end]) {
+			end++
+		}
+		part := &ParameterExpansion{Name: l.input[l.pos+1 : end]}
+		l.pos = end
+		return part, nil
+	case isDigit(c), isSpecialParameter(c):
+		l.pos += 2
+		return &ParameterExpansion{Name: string(c)}, nil
+	}
+	return nil, nil
+}
+
+// readCommandSubstitution reads commands until the matching ) after $(
+func (l *lexer) readCommandSubstitution() (*CommandSubstitution, error) {
+	var tokens []Token
+	depth := 0
+	for {
+		token, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if token.Type == EOFToken {
+			return nil, newUnmatchedQuoteError(")")
+		}
+		if token.Type == OperatorToken && token.Value == "(" {
+			depth++
+		}
+		if token.Type == OperatorToken && token.Value == ")" {
+			if depth == 0 {
+				break
+			}
+			depth--
+		}
+		tokens = append(tokens, token)
+	}
+
+	list, err := parseTokens(tokens)
+	if err != nil {
+		return nil, err
+	}
+	return &CommandSubstitution{List: list}, nil
+}
+
+// readBackquoted reads commands in `...`.
+// A backslash followed by $, ` or \ is removed before commands are parsed
+func (l *lexer) readBackquoted() (*CommandSubstitution, error) {
+	start := l.pos
+	// skip `
+	l.pos++
+	var sb strings.Builder
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		l.pos++
+		if c == '`' {
+			list, err := Parse(sb.String())
+			if err != nil {
+				return nil, err
+			}
+			return &CommandSubstitution{List: list, Source: l.input[start:l.pos]}, nil
+		}
+		if c == '\\' && l.pos < len(l.input) && strings.IndexByte("$`\\", l.input[l.pos]) >= 0 {
+			c = l.input[l.pos]
+			l.pos++
+		}
+		sb.WriteByte(c)
+	}
+	return nil, newUnmatchedQuoteError("`")
+}
+
+// readBracedParameterExpansion reads ${...} after ${
+func (l *lexer) readBracedParameterExpansion() (*ParameterExpansion, error) {
+	part := &ParameterExpansion{}
+	if strings.HasPrefix(l.input[l.pos:], "#") && !strings.HasPrefix(l.input[l.pos:], "#}") {
+		part.Operator = LengthOperator
+		l.pos++
+	}
+
+	nameEnd := l.pos
+	if nameEnd < len(l.input) {
+		switch c := l.input[nameEnd]; {
+		case isNameStart(c):
+			for nameEnd < len(l.input) && isNameChar(l.input[nameEnd]) {
+				nameEnd++
+			}
+		case isDigit(c):
+			for nameEnd < len(l.input) && isDigit(l.input[nameEnd]) {
+				nameEnd++
+			}
+		case isSpecialParameter(c):
+			nameEnd++
+		}
+	}
+	part.Name = l.input[l.pos:nameEnd]
+	l.pos = nameEnd
+
+	if part.Operator == "" {
+		for _, operator := range []ParameterOperator{
+			DefaultValueOperator,
+			AssignDefaultOperator,
+			ErrorOperator,
+			AlternativeValueOperator,
+			UnsetDefaultValueOperator,
+			UnsetAssignDefaultOperator,
+			UnsetErrorOperator,
+			UnsetAlternativeValueOperator,
+		} {
+			if strings.HasPrefix(l.input[l.pos:], string(operator)) {
+				part.Operator = operator
+				l.pos += len(operator)
+
+				word, err := l.readWordParts(func(c byte) bool {
+					return c == '}'
+				})
+				if err != nil {
+					return nil, err
+				}
+				part.Word = word
+				break
+			}
+		}
+	}
+
+	if l.pos >= len(l.input) {
+		return nil, newUnmatchedQuoteError("}")
+	}
+	if part.Name == "" || l.input[l.pos] != '}' {
+		return nil, &SyntaxError{Message: "bad substitution"}
+	}
+	l.pos++
+	return part, nil
+}
+
+// readDoubleQuoted reads a string until the closing double quote
+func (l *lexer) readDoubleQuoted() (*DoubleQuoted, error) {
+	doubleQuoted := &DoubleQuoted{}
+	var sb strings.Builder
+	flush := func() {
+		if sb.Len() > 0 {
+			doubleQuoted.Parts = append(doubleQuoted.Parts, &Literal{Value: sb.String()})
+			sb.Reset()
+		}
+	}
+
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			flush()
+			return doubleQuoted, nil
+		case '$':
+			part, err := l.readExpansion()
+			if err != nil {
+				return nil, err
+			}
+			if part != nil {
+				flush()
+				doubleQuoted.Parts = append(doubleQuoted.Parts, part)
+				continue
+			}
+		case '`':
+			part, err := l.readBackquoted()
+			if err != nil {
+				return nil, err
+			}
+			flush()
+			doubleQuoted.Parts = append(doubleQuoted.Parts, part)
+			continue
+		case '\\':
+			if l.pos+1 < len(l.input) {
+				next := l.input[l.pos+1]
+				if next == '\n' {
+					l.pos += 2
+					continue
+				}
+				if strings.IndexByte("$`\"\\", next) >= 0 {
+					sb.WriteByte(next)
+					l.pos += 2
+					continue
+				}
+			}
+		}
+		sb.WriteByte(c)
+		l.pos++
+	}
+	flush()
+	return doubleQuoted, newUnmatchedQuoteError(`"`)
+}
+
+// readAnsiCQuoted reads a string in $'...' and decodes backslash escapes
+func (l *lexer) readAnsiCQuoted() (string, error) {
+	var sb strings.Builder
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		l.pos++
+		if c == '\'' {
+			return sb.String(), nil
+		}
+		if c != '\\' || l.pos >= len(l.input) {
+			sb.WriteByte(c)
+			continue
+		}
+
+		escaped := l.input[l.pos]
+		l.pos++
+		switch escaped {
+		case 'a':
+			sb.WriteByte('\a')
+		case 'b':
+			sb.WriteByte('\b')
+		case 'e', 'E':
+			sb.WriteByte(0x1b)
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'v':
+			sb.WriteByte('\v')
+		case '\\', '\'', '"', '?':
+			sb.WriteByte(escaped)
+		case 'c':
+			if l.pos < len(l.input) {
+				sb.WriteByte(l.input[l.pos] & 0x1f)
+				l.pos++
+			}
+		case 'x', 'u', 'U':
+			maxDigits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[escaped]
+			value, ok := l.readNumber(16, maxDigits)
+			if !ok {
+				sb.WriteByte('\\')
+				sb.WriteByte(escaped)
+			} else if escaped == 'x' {
+				sb.WriteByte(byte(value))
+			} else {
+				sb.WriteRune(rune(value))
+			}
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			l.pos--
+			value, _ := l.readNumber(8, 3)
+			sb.WriteByte(byte(value))
+		default:
+			sb.WriteByte('\\')
+			sb.WriteByte(escaped)
+		}
+	}
+	return sb.String(), newUnmatchedQuoteError("'")
+}
+
+// readNumber reads a number with the base up to maxDigits
+func (l *lexer) readNumber(base int, maxDigits int) (uint64, bool) {
+	end := l.pos
+	for end < len(l.input) && end-l.pos < maxDigits {
+		if _, err := strconv.ParseUint(l.input[end:end+1], base, 8); err != nil {
+			break
+		}
+		end++
+	}
+	if end == l.pos {
+		return 0, false
+	}
+	value, _ := strconv.ParseUint(l.input[l.pos:end], base, 32)
+	l.pos = end
+	return value, true
+}
+
+func (w *Word) appendLiteral(value string) {
+	if len(w.Parts) > 0 {
+		if last, ok := w.Parts[len(w.Parts)-1].(*Literal); ok {
+			last.Value += value
+			return
+		}
+	}
+	w.Parts = append(w.Parts, &Literal{Value: value})
+}
+
+func (w *Word) appendSingleQuoted(value string) {
+	if len(w.Parts) > 0 {
+		if last, ok := w.Parts[len(w.Parts)-1].(*SingleQuoted); ok {
+			last.Value += value
+			return
+		}
+	}
+	w.Parts = append(w.Parts, &SingleQuoted{Value: value})
+}
@@ -0,0 +1,239 @@
+package syntax
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		want    []Token
+		wantErr error
+	}{
+		{
+			name:  "words and operators",
+			input: "ls -l|wc&&echo done;",
+			want: []Token{
+				{Type: WordToken, Value: "ls", Word: literalWord("ls"), Pos: 0, End: 2},
+				{Type: WordToken, Value: "-l", Word: literalWord("-l"), Pos: 3, End: 5},
+				{Type: OperatorToken, Value: "|", Pos: 5, End: 6},
+				{Type: WordToken, Value: "wc", Word: literalWord("wc"), Pos: 6, End: 8},
+				{Type: OperatorToken, Value: "&&", Pos: 8, End: 10},
+				{Type: WordToken, Value: "echo", Word: literalWord("echo"), Pos: 10, End: 14},
+				{Type: WordToken, Value: "done", Word: literalWord("done"), Pos: 15, End: 19},
+				{Type: OperatorToken, Value: ";", Pos: 19, End: 20},
+			},
+		},
+		{
+			name:  "redirections with a file descriptor",
+			input: "cmd 2>&1 >>out",
+			want: []Token{
+				{Type: WordToken, Value: "cmd", Word: literalWord("cmd"), Pos: 0, End: 3},
+				{Type: IONumberToken, Value: "2", Pos: 4, End: 5},
+				{Type: OperatorToken, Value: ">&", Pos: 5, End: 7},
+				{Type: WordToken, Value: "1", Word: literalWord("1"), Pos: 7, End: 8},
+				{Type: OperatorToken, Value: ">>", Pos: 9, End: 11},
+				{Type: WordToken, Value: "out", Word: literalWord("out"), Pos: 11, End: 14},
+			},
+		},
+		{
+			name:  "newlines, comments and line continuations",
+			input: "echo a \\\n b # comment\nls",
+			want: []Token{
+				{Type: WordToken, Value: "echo", Word: literalWord("echo"), Pos: 0, End: 4},
+				{Type: WordToken, Value: "a", Word: literalWord("a"), Pos: 5, End: 6},
+				{Type: WordToken, Value: "b", Word: literalWord("b"), Pos: 10, End: 11},
+				{Type: NewlineToken, Value: "\n", Pos: 21, End: 22},
+				{Type: WordToken, Value: "ls", Word: literalWord("ls"), Pos: 22, End: 24},
+			},
+		},
+		{
+			name:  "an unclosed quote",
+			input: `echo "abc`,
+			want: []Token{
+				{Type: WordToken, Value: "echo", Word: literalWord("echo"), Pos: 0, End: 4},
+				{Type: WordToken, Value: `"abc`, Word: &Word{Parts: []WordPart{
+					&DoubleQuoted{Parts: []WordPart{&Literal{Value: "abc"}}},
+				}}, Pos: 5, End: 9},
+			},
+			wantErr: &SyntaxError{
+				Message:      "unexpected EOF while looking for matching `\"'",
+				IsIncomplete: true,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, gotErr := Tokenize(tc.input)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, tc.wantErr, gotErr)
+		})
+	}
+}
+
+func TestTokenize_Word(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		want  *Word
+	}{
+		{
+			name:  "single quotes",
+			input: `'a "b" \c'`,
+			want:  &Word{Parts: []WordPart{&SingleQuoted{Value: `a "b" \c`}}},
+		},
+		{
+			name:  "double quotes with escapes",
+			input: `"a \"b\" \c \\ \$"`,
+			want: &Word{Parts: []WordPart{
+				&DoubleQuoted{Parts: []WordPart{&Literal{Value: `a "b" \c \ $`}}},
+			}},
+		},
+		{
+			name:  "backslash escapes",
+			input: `a\ b\"c`,
+			want: &Word{Parts: []WordPart{
+				&Literal{Value: "a"},
+				&SingleQuoted{Value: " "},
+				&Literal{Value: "b"},
+				&SingleQuoted{Value: `"`},
+				&Literal{Value: "c"},
+			}},
+		},
+		{
+			name:  "concatenated quotes",
+			input: `-m"a b"'c'`,
+			want: &Word{Parts: []WordPart{
+				&Literal{Value: "-m"},
+				&DoubleQuoted{Parts: []WordPart{&Literal{Value: "a b"}}},
+				&SingleQuoted{Value: "c"},
+			}},
+		},
+		{
+			name:  "ANSI-C quotes",
+			input: `$'a\tb\n\x41\101あ\'\q'`,
+			want:  &Word{Parts: []WordPart{&SingleQuoted{Value: "a\tb\nAAあ'\\q"}}},
+		},
+		{
+			name:  "empty quotes",
+			input: `''`,
+			want:  &Word{Parts: []WordPart{&SingleQuoted{}}},
+		},
+		{
+			name:  "multibyte characters",
+			input: `あ\い`,
+			want: &Word{Parts: []WordPart{
+				&Literal{Value: "あ"},
+				&SingleQuoted{Value: "い"},
+			}},
+		},
+		{
+			name:  "parameter expansions",
+			input: `$HOME/a$?$1${PATH}"$A-b"$`,
+			want: &Word{Parts: []WordPart{
+				&ParameterExpansion{Name: "HOME"},
+				&Literal{Value: "/a"},
+				&ParameterExpansion{Name: "?"},
+				&ParameterExpansion{Name: "1"},
+				&ParameterExpansion{Name: "PATH"},
+				&DoubleQuoted{Parts: []WordPart{
+					&ParameterExpansion{Name: "A"},
+					&Literal{Value: "-b"},
+				}},
+				&Literal{Value: "$"},
+			}},
+		},
+		{
+			name:  "parameter expansions with operators",
+			input: `${#A}${B:-"x y" $C}${D+${E}}`,
+			want: &Word{Parts: []WordPart{
+				&ParameterExpansion{Name: "A", Operator: LengthOperator},
+				&ParameterExpansion{Name: "B", Operator: DefaultValueOperator, Word: &Word{Parts: []WordPart{
+					&DoubleQuoted{Parts: []WordPart{&Literal{Value: "x y"}}},
+					&Literal{Value: " "},
+					&ParameterExpansion{Name: "C"},
+				}}},
+				&ParameterExpansion{Name: "D", Operator: UnsetAlternativeValueOperator, Word: &Word{Parts: []WordPart{
+					&ParameterExpansion{Name: "E"},
+				}}},
+			}},
+		},
+		{
+			name:  "command substitutions",
+			input: "$(echo a)\"`echo \\$A`\"",
+			want: &Word{Parts: []WordPart{
+				&CommandSubstitution{
+					List: &List{Items: []*AndOr{
+						{Pipelines: []*Pipeline{{Commands: []Command{&SimpleCommand{
+							Words: []*Word{
+								{Parts: []WordPart{&Literal{Value: "echo"}}},
+								{Parts: []WordPart{&Literal{Value: "a"}}},
+							},
+						}}}}},
+					}},
+					Source: "$(echo a)",
+				},
+				&DoubleQuoted{Parts: []WordPart{
+					&CommandSubstitution{
+						List: &List{Items: []*AndOr{
+							{Pipelines: []*Pipeline{{Commands: []Command{&SimpleCommand{
+								Words: []*Word{
+									{Parts: []WordPart{&Literal{Value: "echo"}}},
+									{Parts: []WordPart{&ParameterExpansion{Name: "A"}}},
+								},
+							}}}}},
+						}},
+						Source: "`echo \\$A`",
+					},
+				}},
+			}},
+		},
+		{
+			name:  "nested command substitutions",
+			input: "$(echo $(pwd))",
+			want: &Word{Parts: []WordPart{
+				&CommandSubstitution{
+					List: &List{Items: []*AndOr{
+						{Pipelines: []*Pipeline{{Commands: []Command{&SimpleCommand{
+							Words: []*Word{
+								{Parts: []WordPart{&Literal{Value: "echo"}}},
+								{Parts: []WordPart{&CommandSubstitution{
+									List: &List{Items: []*AndOr{
+										{Pipelines: []*Pipeline{{Commands: []Command{&SimpleCommand{
+											Words: []*Word{{Parts: []WordPart{&Literal{Value: "pwd"}}}},
+										}}}}},
+									}},
+									Source: "$(pwd)",
+								}}},
+							},
+						}}}}},
+					}},
+					Source: "$(echo $(pwd))",
+				},
+			}},
+		},
+		{
+			name:  "escaped dollars",
+			input: `\$A'$B'`,
+			want: &Word{Parts: []WordPart{
+				&SingleQuoted{Value: "$"},
+				&Literal{Value: "A"},
+				&SingleQuoted{Value: "$B"},
+			}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, gotErr := Tokenize(tc.input)
+			assert.NoError(t, gotErr)
+			if assert.Len(t, got, 1) {
+				assert.Equal(t, tc.want, got[0].Word)
+			}
+		})
+	}
+}
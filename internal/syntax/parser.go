@@ -0,0 +1,717 @@
+package syntax
+
+import (
+	"strconv"
+	"strings"
+)
+
+type parser struct {
+	tokens  []Token
+	pos     int
+	aliases map[string]string
+	// expandedAliases are aliases expanded for the current command to avoid recursive expansions
+	expandedAliases map[string]bool
+}
+
+// Parse parses an input into a list of commands
+func Parse(input string) (*List, error) {
+	return ParseWithAliases(input, nil)
+}
+
+// ParseWithAliases parses an input after replacing the first word of each command with its alias
+func ParseWithAliases(input string, aliases map[string]string) (*List, error) {
+	tokens, err := Tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	return parseTokensWithAliases(tokens, aliases)
+}
+
+func parseTokens(tokens []Token) (*List, error) {
+	return parseTokensWithAliases(tokens, nil)
+}
+
+func parseTokensWithAliases(tokens []Token, aliases map[string]string) (*List, error) {
+	p := parser{tokens: tokens, aliases: aliases}
+	list, err := p.parseList(func(token Token) bool {
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token.Type != EOFToken {
+		return nil, newUnexpectedTokenError(token)
+	}
+	return list, nil
+}
+
+func (p *parser) peek() Token {
+	return p.peekAt(0)
+}
+
+// peekAt returns the token after offset tokens from the current one
+func (p *parser) peekAt(offset int) Token {
+	if p.pos+offset >= len(p.tokens) {
+		var end int
+		if len(p.tokens) > 0 {
+			end = p.tokens[len(p.tokens)-1].End
+		}
+		return Token{Type: EOFToken, Pos: end, End: end}
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *parser) isOperator(values ...string) bool {
+	token := p.peek()
+	if token.Type != OperatorToken {
+		return false
+	}
+	for _, value := range values {
+		if token.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isReservedWord returns true if the current token is one of reserved words.
+// Reserved words are recognized only where a command name can be
+func (p *parser) isReservedWord(values ...string) bool {
+	return isReservedWordToken(p.peek(), values...)
+}
+
+func isReservedWordToken(token Token, values ...string) bool {
+	if token.Type != WordToken || len(token.Word.Parts) != 1 {
+		return false
+	}
+	literal, ok := token.Word.Parts[0].(*Literal)
+	if !ok {
+		return false
+	}
+	for _, value := range values {
+		if literal.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// reservedWords are words which have special meanings at the position of a command name
+var reservedWords = []string{
+	"!", "{", "}", "case", "do", "done", "elif", "else", "esac", "fi", "for", "function", "if", "in", "then", "time", "until", "while",
+}
+
+// IsReservedWord returns true if a word is a reserved word like if or for
+func IsReservedWord(word string) bool {
+	for _, reservedWord := range reservedWords {
+		if word == reservedWord {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) skipNewlines() {
+	for p.peek().Type == NewlineToken {
+		p.pos++
+	}
+}
+
+// parseList parses and-or lists until EOF or a token for isEnd
+func (p *parser) parseList(isEnd func(Token) bool) (*List, error) {
+	list := &List{}
+	for {
+		p.skipNewlines()
+		if token := p.peek(); token.Type == EOFToken || isEnd(token) {
+			return list, nil
+		}
+
+		andOr, err := p.parseAndOr()
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, andOr)
+
+		token := p.peek()
+		switch {
+		case p.isOperator(";"), token.Type == NewlineToken:
+			p.pos++
+		case p.isOperator("&"):
+			andOr.IsBackground = true
+			p.pos++
+		case token.Type == EOFToken, isEnd(token):
+			return list, nil
+		default:
+			return nil, newUnexpectedTokenError(token)
+		}
+	}
+}
+
+func (p *parser) parseAndOr() (*AndOr, error) {
+	pipeline, err := p.parsePipeline()
+	if err != nil {
+		return nil, err
+	}
+	andOr := &AndOr{
+		Pipelines: []*Pipeline{pipeline},
+	}
+	for p.isOperator(string(AndOperator), string(OrOperator)) {
+		andOr.Operators = append(andOr.Operators, AndOrOperator(p.peek().Value))
+		p.pos++
+		p.skipNewlines()
+
+		pipeline, err := p.parsePipeline()
+		if err != nil {
+			return nil, err
+		}
+		andOr.Pipelines = append(andOr.Pipelines, pipeline)
+	}
+	return andOr, nil
+}
+
+func (p *parser) parsePipeline() (*Pipeline, error) {
+	pipeline := &Pipeline{}
+	if token := p.peek(); token.Type == WordToken && token.Value == "time" {
+		pipeline.IsTimed = true
+		p.pos++
+		if token := p.peek(); token.Type == WordToken && token.Value == "-p" {
+			pipeline.IsPortableTime = true
+			p.pos++
+		}
+	}
+	if token := p.peek(); token.Type == WordToken && token.Value == "!" {
+		pipeline.IsNegated = true
+		p.pos++
+	}
+
+	for {
+		command, err := p.parseCommand()
+		if err != nil {
+			return nil, err
+		}
+		pipeline.Commands = append(pipeline.Commands, command)
+
+		if !p.isOperator("|") {
+			return pipeline, nil
+		}
+		p.pos++
+		p.skipNewlines()
+	}
+}
+
+// expandAlias replaces the current word token with tokens of its alias.
+// It returns false if the token isn't an alias
+func (p *parser) expandAlias() (bool, error) {
+	token := p.peek()
+	if token.Type != WordToken || len(token.Word.Parts) != 1 {
+		return false, nil
+	}
+	literal, ok := token.Word.Parts[0].(*Literal)
+	if !ok || p.expandedAliases[literal.Value] {
+		return false, nil
+	}
+	value, ok := p.aliases[literal.Value]
+	if !ok {
+		return false, nil
+	}
+
+	aliasTokens, err := Tokenize(value)
+	if err != nil {
+		return false, err
+	}
+	if p.expandedAliases == nil {
+		p.expandedAliases = make(map[string]bool)
+	}
+	p.expandedAliases[literal.Value] = true
+
+	tokens := make([]Token, 0, len(p.tokens)+len(aliasTokens)-1)
+	tokens = append(tokens, p.tokens[:p.pos]...)
+	tokens = append(tokens, aliasTokens...)
+	tokens = append(tokens, p.tokens[p.pos+1:]...)
+	p.tokens = tokens
+	return true, nil
+}
+
+func (p *parser) parseCommand() (Command, error) {
+	p.expandedAliases = nil
+	for {
+		isExpanded, err := p.expandAlias()
+		if err != nil {
+			return nil, err
+		}
+		if !isExpanded {
+			break
+		}
+	}
+
+	switch {
+	case p.isOperator("("):
+		return p.parseSubshell()
+	case p.isReservedWord("{", "if", "for", "while", "until", "case"):
+		return p.parseCompoundCommand()
+	case p.isReservedWord("function"), p.isFunctionDefinition():
+		return p.parseFunctionDefinition()
+	case p.isReservedWord("then", "else", "elif", "fi", "do", "done", "esac", "}"):
+		return nil, newUnexpectedTokenError(p.peek())
+	}
+	return p.parseSimpleCommand()
+}
+
+func (p *parser) parseSubshell() (*Subshell, error) {
+	// skip (
+	p.pos++
+	list, err := p.parseList(func(token Token) bool {
+		return token.Type == OperatorToken && token.Value == ")"
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOperator(")") {
+		return nil, newUnexpectedTokenError(p.peek())
+	}
+	if len(list.Items) == 0 {
+		return nil, newUnexpectedTokenError(p.peek())
+	}
+	p.pos++
+
+	redirections, err := p.parseRedirections()
+	if err != nil {
+		return nil, err
+	}
+	return &Subshell{
+		List:         list,
+		Redirections: redirections,
+	}, nil
+}
+
+// parseCompoundCommand parses a compound command starting with a reserved word, and redirections for it
+func (p *parser) parseCompoundCommand() (Command, error) {
+	var command Command
+	var redirections *[]*Redirection
+	switch {
+	case p.isReservedWord("{"):
+		braceGroup, err := p.parseBraceGroup()
+		if err != nil {
+			return nil, err
+		}
+		command, redirections = braceGroup, &braceGroup.Redirections
+	case p.isReservedWord("if"):
+		ifClause, err := p.parseIfClause()
+		if err != nil {
+			return nil, err
+		}
+		command, redirections = ifClause, &ifClause.Redirections
+	case p.isReservedWord("for"):
+		forClause, err := p.parseForClause()
+		if err != nil {
+			return nil, err
+		}
+		command, redirections = forClause, &forClause.Redirections
+	case p.isReservedWord("while", "until"):
+		whileClause, err := p.parseWhileClause()
+		if err != nil {
+			return nil, err
+		}
+		command, redirections = whileClause, &whileClause.Redirections
+	case p.isReservedWord("case"):
+		caseClause, err := p.parseCaseClause()
+		if err != nil {
+			return nil, err
+		}
+		command, redirections = caseClause, &caseClause.Redirections
+	default:
+		return nil, newUnexpectedTokenError(p.peek())
+	}
+
+	var err error
+	*redirections, err = p.parseRedirections()
+	if err != nil {
+		return nil, err
+	}
+	return command, nil
+}
+
+// parseCompoundList parses a list which isn't empty until one of reserved words
+func (p *parser) parseCompoundList(ends ...string) (*List, error) {
+	list, err := p.parseList(func(token Token) bool {
+		return isReservedWordToken(token, ends...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !p.isReservedWord(ends...) || len(list.Items) == 0 {
+		return nil, newUnexpectedTokenError(p.peek())
+	}
+	return list, nil
+}
+
+func (p *parser) parseBraceGroup() (*BraceGroup, error) {
+	// skip {
+	p.pos++
+	list, err := p.parseCompoundList("}")
+	if err != nil {
+		return nil, err
+	}
+	p.pos++
+	return &BraceGroup{List: list}, nil
+}
+
+func (p *parser) parseIfClause() (*IfClause, error) {
+	clause := &IfClause{}
+	for {
+		// skip if or elif
+		p.pos++
+		condition, err := p.parseCompoundList("then")
+		if err != nil {
+			return nil, err
+		}
+		p.pos++
+		body, err := p.parseCompoundList("elif", "else", "fi")
+		if err != nil {
+			return nil, err
+		}
+		clause.Conditions = append(clause.Conditions, condition)
+		clause.Bodies = append(clause.Bodies, body)
+		if !p.isReservedWord("elif") {
+			break
+		}
+	}
+
+	if p.isReservedWord("else") {
+		p.pos++
+		elseBody, err := p.parseCompoundList("fi")
+		if err != nil {
+			return nil, err
+		}
+		clause.Else = elseBody
+	}
+	// skip fi
+	p.pos++
+	return clause, nil
+}
+
+func (p *parser) parseForClause() (*ForClause, error) {
+	// skip for
+	p.pos++
+	token := p.peek()
+	if token.Type != WordToken || !IsName(token.Value) {
+		return nil, newUnexpectedTokenError(token)
+	}
+	clause := &ForClause{Name: token.Value}
+	p.pos++
+
+	p.skipNewlines()
+	if p.isReservedWord("in") {
+		clause.HasIn = true
+		p.pos++
+		for p.peek().Type == WordToken {
+			clause.Words = append(clause.Words, p.peek().Word)
+			p.pos++
+		}
+		if token := p.peek(); !p.isOperator(";") && token.Type != NewlineToken {
+			return nil, newUnexpectedTokenError(token)
+		}
+		p.pos++
+	} else if p.isOperator(";") {
+		p.pos++
+	}
+	p.skipNewlines()
+
+	body, err := p.parseDoGroup()
+	if err != nil {
+		return nil, err
+	}
+	clause.Body = body
+	return clause, nil
+}
+
+func (p *parser) parseWhileClause() (*WhileClause, error) {
+	clause := &WhileClause{
+		IsUntil: p.isReservedWord("until"),
+	}
+	// skip while or until
+	p.pos++
+	condition, err := p.parseCompoundList("do")
+	if err != nil {
+		return nil, err
+	}
+	clause.Condition = condition
+
+	body, err := p.parseDoGroup()
+	if err != nil {
+		return nil, err
+	}
+	clause.Body = body
+	return clause, nil
+}
+
+// parseDoGroup parses do list; done
+func (p *parser) parseDoGroup() (*List, error) {
+	if !p.isReservedWord("do") {
+		return nil, newUnexpectedTokenError(p.peek())
+	}
+	p.pos++
+	body, err := p.parseCompoundList("done")
+	if err != nil {
+		return nil, err
+	}
+	p.pos++
+	return body, nil
+}
+
+func (p *parser) parseCaseClause() (*CaseClause, error) {
+	// skip case
+	p.pos++
+	token := p.peek()
+	if token.Type != WordToken {
+		return nil, newUnexpectedTokenError(token)
+	}
+	clause := &CaseClause{Word: token.Word}
+	p.pos++
+	p.skipNewlines()
+	if !p.isReservedWord("in") {
+		return nil, newUnexpectedTokenError(p.peek())
+	}
+	p.pos++
+	p.skipNewlines()
+
+	for !p.isReservedWord("esac") {
+		item := &CaseItem{}
+		if p.isOperator("(") {
+			p.pos++
+		}
+		for {
+			token := p.peek()
+			if token.Type != WordToken {
+				return nil, newUnexpectedTokenError(token)
+			}
+			item.Patterns = append(item.Patterns, token.Word)
+			p.pos++
+			if !p.isOperator("|") {
+				break
+			}
+			p.pos++
+		}
+		if !p.isOperator(")") {
+			return nil, newUnexpectedTokenError(p.peek())
+		}
+		p.pos++
+
+		body, err := p.parseList(func(token Token) bool {
+			return (token.Type == OperatorToken && token.Value == ";;") || isReservedWordToken(token, "esac")
+		})
+		if err != nil {
+			return nil, err
+		}
+		item.Body = body
+		clause.Items = append(clause.Items, item)
+
+		if !p.isOperator(";;") {
+			if !p.isReservedWord("esac") {
+				return nil, newUnexpectedTokenError(p.peek())
+			}
+			break
+		}
+		p.pos++
+		p.skipNewlines()
+	}
+	// skip esac
+	p.pos++
+	return clause, nil
+}
+
+// isFunctionDefinition returns true for name() at the current token
+func (p *parser) isFunctionDefinition() bool {
+	token := p.peek()
+	if token.Type != WordToken || len(token.Word.Parts) != 1 {
+		return false
+	}
+	if _, ok := token.Word.Parts[0].(*Literal); !ok {
+		return false
+	}
+	if _, ok := ParseAssignment(token.Word); ok {
+		return false
+	}
+	next := p.peekAt(1)
+	return next.Type == OperatorToken && next.Value == "("
+}
+
+// parseFunctionDefinition parses name() compound-command or function name [()] compound-command
+func (p *parser) parseFunctionDefinition() (*FunctionDefinition, error) {
+	isFunctionKeyword := p.isReservedWord("function")
+	if isFunctionKeyword {
+		p.pos++
+	}
+	token := p.peek()
+	if token.Type != WordToken {
+		return nil, newUnexpectedTokenError(token)
+	}
+	definition := &FunctionDefinition{Name: token.Word.Unquoted()}
+	p.pos++
+
+	if !isFunctionKeyword || p.isOperator("(") {
+		if !p.isOperator("(") {
+			return nil, newUnexpectedTokenError(p.peek())
+		}
+		p.pos++
+		if !p.isOperator(")") {
+			return nil, newUnexpectedTokenError(p.peek())
+		}
+		p.pos++
+	}
+	p.skipNewlines()
+
+	var err error
+	switch {
+	case p.isOperator("("):
+		definition.Body, err = p.parseSubshell()
+	case p.isReservedWord("{", "if", "for", "while", "until", "case"):
+		definition.Body, err = p.parseCompoundCommand()
+	default:
+		err = newUnexpectedTokenError(p.peek())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return definition, nil
+}
+
+func (p *parser) parseRedirections() ([]*Redirection, error) {
+	var redirections []*Redirection
+	for p.isRedirection() {
+		redirection, err := p.parseRedirection()
+		if err != nil {
+			return nil, err
+		}
+		redirections = append(redirections, redirection)
+	}
+	return redirections, nil
+}
+
+func (p *parser) parseSimpleCommand() (*SimpleCommand, error) {
+	command := &SimpleCommand{}
+	for {
+		token := p.peek()
+		if token.Type == WordToken {
+			if len(command.Words) == 0 {
+				if assignment, ok := ParseAssignment(token.Word); ok {
+					command.Assignments = append(command.Assignments, assignment)
+					p.pos++
+					continue
+				}
+				if len(command.Assignments) > 0 {
+					isExpanded, err := p.expandAlias()
+					if err != nil {
+						return nil, err
+					}
+					if isExpanded {
+						continue
+					}
+				}
+			}
+			command.Words = append(command.Words, token.Word)
+			p.pos++
+			continue
+		}
+		if p.isRedirection() {
+			redirection, err := p.parseRedirection()
+			if err != nil {
+				return nil, err
+			}
+			command.Redirections = append(command.Redirections, redirection)
+			continue
+		}
+		break
+	}
+
+	if len(command.Assignments) == 0 && len(command.Words) == 0 && len(command.Redirections) == 0 {
+		return nil, newUnexpectedTokenError(p.peek())
+	}
+	return command, nil
+}
+
+// ParseAssignment returns an assignment if a word is NAME=value
+func ParseAssignment(word *Word) (*Assignment, bool) {
+	if len(word.Parts) == 0 {
+		return nil, false
+	}
+	literal, ok := word.Parts[0].(*Literal)
+	if !ok {
+		return nil, false
+	}
+	index := strings.IndexByte(literal.Value, '=')
+	if index < 0 || !IsName(literal.Value[:index]) {
+		return nil, false
+	}
+
+	value := &Word{}
+	if rest := literal.Value[index+1:]; rest != "" {
+		value.Parts = append(value.Parts, &Literal{Value: rest})
+	}
+	value.Parts = append(value.Parts, word.Parts[1:]...)
+	return &Assignment{
+		Name:  literal.Value[:index],
+		Value: value,
+	}, true
+}
+
+func (p *parser) isRedirection() bool {
+	if p.peek().Type == IONumberToken {
+		return true
+	}
+	return p.isOperator(
+		string(RedirectInput),
+		string(RedirectOutput),
+		string(RedirectClobber),
+		string(RedirectAppend),
+		string(RedirectReadWrite),
+		string(DuplicateInput),
+		string(DuplicateOutput),
+		string(RedirectAllOutput),
+		string(AppendAllOutput),
+		"<<",
+		"<<-",
+	)
+}
+
+func (p *parser) parseRedirection() (*Redirection, error) {
+	fd := -1
+	if token := p.peek(); token.Type == IONumberToken {
+		var err error
+		fd, err = strconv.Atoi(token.Value)
+		if err != nil {
+			return nil, newUnexpectedTokenError(token)
+		}
+		p.pos++
+	}
+
+	operatorToken := p.peek()
+	if operatorToken.Value == "<<" || operatorToken.Value == "<<-" {
+		return nil, &SyntaxError{Message: "here-documents are not supported"}
+	}
+	operator := RedirectionOperator(operatorToken.Value)
+	if fd < 0 {
+		switch operator {
+		case RedirectInput, RedirectReadWrite, DuplicateInput:
+			fd = 0
+		default:
+			fd = 1
+		}
+	}
+	p.pos++
+
+	target := p.peek()
+	if target.Type != WordToken {
+		if target.Type == EOFToken {
+			return nil, newUnexpectedTokenError(Token{Type: NewlineToken})
+		}
+		return nil, newUnexpectedTokenError(target)
+	}
+	p.pos++
+
+	return &Redirection{
+		Fd:       fd,
+		Operator: operator,
+		Target:   target.Word,
+	}, nil
+}
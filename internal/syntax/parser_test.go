@@ -0,0 +1,435 @@
+package syntax
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func literalWord(value string) *Word {
+	return &Word{Parts: []WordPart{&Literal{Value: value}}}
+}
+
+func simpleCommand(fields ...string) *SimpleCommand {
+	command := &SimpleCommand{}
+	for _, field := range fields {
+		command.Words = append(command.Words, literalWord(field))
+	}
+	return command
+}
+
+// commandList returns a list where each command is an and-or list
+func commandList(commands ...Command) *List {
+	list := &List{}
+	for _, command := range commands {
+		list.Items = append(list.Items, &AndOr{
+			Pipelines: []*Pipeline{{Commands: []Command{command}}},
+		})
+	}
+	return list
+}
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		want    *List
+		wantErr error
+	}{
+		{
+			name:  "empty",
+			input: " # comment",
+			want:  &List{},
+		},
+		{
+			name:  "simple command",
+			input: "ls -l",
+			want: &List{Items: []*AndOr{
+				{Pipelines: []*Pipeline{
+					{Commands: []Command{simpleCommand("ls", "-l")}},
+				}},
+			}},
+		},
+		{
+			name:  "pipeline",
+			input: "! ls | grep a |\n wc",
+			want: &List{Items: []*AndOr{
+				{Pipelines: []*Pipeline{
+					{
+						Commands: []Command{
+							simpleCommand("ls"),
+							simpleCommand("grep", "a"),
+							simpleCommand("wc"),
+						},
+						IsNegated: true,
+					},
+				}},
+			}},
+		},
+		{
+			name:  "timed pipeline",
+			input: "time -p ! ls | wc",
+			want: &List{Items: []*AndOr{
+				{Pipelines: []*Pipeline{
+					{
+						Commands: []Command{
+							simpleCommand("ls"),
+							simpleCommand("wc"),
+						},
+						IsNegated:      true,
+						IsTimed:        true,
+						IsPortableTime: true,
+					},
+				}},
+			}},
+		},
+		{
+			name:  "lists",
+			input: "make && ./app || echo failed; git fetch &\ngit status",
+			want: &List{Items: []*AndOr{
+				{
+					Pipelines: []*Pipeline{
+						{Commands: []Command{simpleCommand("make")}},
+						{Commands: []Command{simpleCommand("./app")}},
+						{Commands: []Command{simpleCommand("echo", "failed")}},
+					},
+					Operators: []AndOrOperator{AndOperator, OrOperator},
+				},
+				{
+					Pipelines: []*Pipeline{
+						{Commands: []Command{simpleCommand("git", "fetch")}},
+					},
+					IsBackground: true,
+				},
+				{
+					Pipelines: []*Pipeline{
+						{Commands: []Command{simpleCommand("git", "status")}},
+					},
+				},
+			}},
+		},
+		{
+			name:  "redirections",
+			input: "> out cmd 2>&1 < in",
+			want: &List{Items: []*AndOr{
+				{Pipelines: []*Pipeline{
+					{Commands: []Command{&SimpleCommand{
+						Words: []*Word{literalWord("cmd")},
+						Redirections: []*Redirection{
+							{Fd: 1, Operator: RedirectOutput, Target: literalWord("out")},
+							{Fd: 2, Operator: DuplicateOutput, Target: literalWord("1")},
+							{Fd: 0, Operator: RedirectInput, Target: literalWord("in")},
+						},
+					}}},
+				}},
+			}},
+		},
+		{
+			name:  "subshell",
+			input: "(cd dir; make) > log",
+			want: &List{Items: []*AndOr{
+				{Pipelines: []*Pipeline{
+					{Commands: []Command{&Subshell{
+						List: &List{Items: []*AndOr{
+							{Pipelines: []*Pipeline{{Commands: []Command{simpleCommand("cd", "dir")}}}},
+							{Pipelines: []*Pipeline{{Commands: []Command{simpleCommand("make")}}}},
+						}},
+						Redirections: []*Redirection{
+							{Fd: 1, Operator: RedirectOutput, Target: literalWord("log")},
+						},
+					}}},
+				}},
+			}},
+		},
+		{
+			name:  "assignments",
+			input: "A=1 B= C=$A env D=2",
+			want: &List{Items: []*AndOr{
+				{Pipelines: []*Pipeline{
+					{Commands: []Command{&SimpleCommand{
+						Assignments: []*Assignment{
+							{Name: "A", Value: literalWord("1")},
+							{Name: "B", Value: &Word{}},
+							{Name: "C", Value: &Word{Parts: []WordPart{&ParameterExpansion{Name: "A"}}}},
+						},
+						Words: []*Word{literalWord("env"), literalWord("D=2")},
+					}}},
+				}},
+			}},
+		},
+		{
+			name:  "brace group",
+			input: "{ cd dir; make; } > log",
+			want: commandList(&BraceGroup{
+				List: commandList(simpleCommand("cd", "dir"), simpleCommand("make")),
+				Redirections: []*Redirection{
+					{Fd: 1, Operator: RedirectOutput, Target: literalWord("log")},
+				},
+			}),
+		},
+		{
+			name:  "if clause",
+			input: "if test -f a; then echo a\nelif test -f b\nthen echo b; else echo c; fi",
+			want: commandList(&IfClause{
+				Conditions: []*List{
+					commandList(simpleCommand("test", "-f", "a")),
+					commandList(simpleCommand("test", "-f", "b")),
+				},
+				Bodies: []*List{
+					commandList(simpleCommand("echo", "a")),
+					commandList(simpleCommand("echo", "b")),
+				},
+				Else: commandList(simpleCommand("echo", "c")),
+			}),
+		},
+		{
+			name:  "for clause",
+			input: "for ns in a b\ndo kubectl -n $ns get pods; done",
+			want: commandList(&ForClause{
+				Name:  "ns",
+				Words: []*Word{literalWord("a"), literalWord("b")},
+				HasIn: true,
+				Body: commandList(&SimpleCommand{
+					Words: []*Word{
+						literalWord("kubectl"),
+						literalWord("-n"),
+						{Parts: []WordPart{&ParameterExpansion{Name: "ns"}}},
+						literalWord("get"),
+						literalWord("pods"),
+					},
+				}),
+			}),
+		},
+		{
+			name:  "for clause without in",
+			input: "for arg; do echo $arg; done",
+			want: commandList(&ForClause{
+				Name: "arg",
+				Body: commandList(&SimpleCommand{
+					Words: []*Word{
+						literalWord("echo"),
+						{Parts: []WordPart{&ParameterExpansion{Name: "arg"}}},
+					},
+				}),
+			}),
+		},
+		{
+			name:  "while and until clauses",
+			input: "while true; do break; done; until false; do continue; done",
+			want: commandList(
+				&WhileClause{
+					Condition: commandList(simpleCommand("true")),
+					Body:      commandList(simpleCommand("break")),
+				},
+				&WhileClause{
+					Condition: commandList(simpleCommand("false")),
+					Body:      commandList(simpleCommand("continue")),
+					IsUntil:   true,
+				},
+			),
+		},
+		{
+			name:  "case clause",
+			input: "case $1 in\n(a|b) echo ab;;\nc) ;;\n*) echo other\nesac",
+			want: commandList(&CaseClause{
+				Word: &Word{Parts: []WordPart{&ParameterExpansion{Name: "1"}}},
+				Items: []*CaseItem{
+					{
+						Patterns: []*Word{literalWord("a"), literalWord("b")},
+						Body:     commandList(simpleCommand("echo", "ab")),
+					},
+					{
+						Patterns: []*Word{literalWord("c")},
+						Body:     &List{},
+					},
+					{
+						Patterns: []*Word{literalWord("*")},
+						Body:     commandList(simpleCommand("echo", "other")),
+					},
+				},
+			}),
+		},
+		{
+			name:  "function definitions",
+			input: "greet() {\n echo hello; }; function bye { echo bye; }",
+			want: commandList(
+				&FunctionDefinition{
+					Name: "greet",
+					Body: &BraceGroup{List: commandList(simpleCommand("echo", "hello"))},
+				},
+				&FunctionDefinition{
+					Name: "bye",
+					Body: &BraceGroup{List: commandList(simpleCommand("echo", "bye"))},
+				},
+			),
+		},
+		{
+			name:  "reserved words are only recognized as a command name",
+			input: "echo if then fi",
+			want:  commandList(simpleCommand("echo", "if", "then", "fi")),
+		},
+		{
+			name:    "incomplete if clause",
+			input:   "if true; then\necho a",
+			wantErr: &SyntaxError{Message: "syntax error: unexpected end of file", IsIncomplete: true},
+		},
+		{
+			name:    "incomplete function definition",
+			input:   "f()",
+			wantErr: &SyntaxError{Message: "syntax error: unexpected end of file", IsIncomplete: true},
+		},
+		{
+			name:    "unexpected reserved word",
+			input:   "echo a; fi",
+			wantErr: &SyntaxError{Message: "syntax error near unexpected token `fi'"},
+		},
+		{
+			name:    "empty brace group",
+			input:   "{ }",
+			wantErr: &SyntaxError{Message: "syntax error near unexpected token `}'"},
+		},
+		{
+			name:    "bad substitution",
+			input:   "echo ${A B}",
+			wantErr: &SyntaxError{Message: "bad substitution"},
+		},
+		{
+			name:    "unclosed parameter expansion",
+			input:   "echo ${A:-b",
+			wantErr: &SyntaxError{Message: "unexpected EOF while looking for matching `}'", IsIncomplete: true},
+		},
+		{
+			name:    "unexpected token",
+			input:   "ls | | wc",
+			wantErr: &SyntaxError{Message: "syntax error near unexpected token `|'"},
+		},
+		{
+			name:    "no file for a redirection",
+			input:   "ls >",
+			wantErr: &SyntaxError{Message: "syntax error near unexpected token `newline'"},
+		},
+		{
+			name:    "empty subshell",
+			input:   "()",
+			wantErr: &SyntaxError{Message: "syntax error near unexpected token `)'"},
+		},
+		{
+			name:    "incomplete pipeline",
+			input:   "ls |",
+			wantErr: &SyntaxError{Message: "syntax error: unexpected end of file", IsIncomplete: true},
+		},
+		{
+			name:    "incomplete subshell",
+			input:   "(ls",
+			wantErr: &SyntaxError{Message: "syntax error: unexpected end of file", IsIncomplete: true},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, gotErr := Parse(tc.input)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, tc.wantErr, gotErr)
+		})
+	}
+}
+
+func TestParseWithAliases(t *testing.T) {
+	aliases := map[string]string{
+		"ls":  "ls -G",
+		"ll":  "ls -l",
+		"kgp": "kubectl get pods | grep",
+		"e":   "echo",
+	}
+	testCases := []struct {
+		name    string
+		input   string
+		want    *List
+		wantErr error
+	}{
+		{
+			name:  "an alias referring to itself",
+			input: "ls dir",
+			want: &List{Items: []*AndOr{
+				{Pipelines: []*Pipeline{
+					{Commands: []Command{simpleCommand("ls", "-G", "dir")}},
+				}},
+			}},
+		},
+		{
+			name:  "an alias referring to another alias",
+			input: "ll",
+			want: &List{Items: []*AndOr{
+				{Pipelines: []*Pipeline{
+					{Commands: []Command{simpleCommand("ls", "-G", "-l")}},
+				}},
+			}},
+		},
+		{
+			name:  "an alias with a pipeline",
+			input: "kgp app",
+			want: &List{Items: []*AndOr{
+				{Pipelines: []*Pipeline{
+					{Commands: []Command{
+						simpleCommand("kubectl", "get", "pods"),
+						simpleCommand("grep", "app"),
+					}},
+				}},
+			}},
+		},
+		{
+			name:  "only command names are expanded",
+			input: "e ll && A=1 e 'e'",
+			want: &List{Items: []*AndOr{
+				{
+					Pipelines: []*Pipeline{
+						{Commands: []Command{simpleCommand("echo", "ll")}},
+						{Commands: []Command{&SimpleCommand{
+							Assignments: []*Assignment{{Name: "A", Value: literalWord("1")}},
+							Words: []*Word{
+								literalWord("echo"),
+								{Parts: []WordPart{&SingleQuoted{Value: "e"}}},
+							},
+						}}},
+					},
+					Operators: []AndOrOperator{AndOperator},
+				},
+			}},
+		},
+		{
+			name:  "a quoted command name isn't expanded",
+			input: "'ll'",
+			want: &List{Items: []*AndOr{
+				{Pipelines: []*Pipeline{
+					{Commands: []Command{&SimpleCommand{
+						Words: []*Word{{Parts: []WordPart{&SingleQuoted{Value: "ll"}}}},
+					}}},
+				}},
+			}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, gotErr := ParseWithAliases(tc.input, aliases)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, tc.wantErr, gotErr)
+		})
+	}
+}
+
+func TestList_SimpleCommands(t *testing.T) {
+	list, err := Parse(`kubectl get pods | grep "a b" && (cd dir; make)`)
+	assert.NoError(t, err)
+
+	var got [][]string
+	for _, command := range list.SimpleCommands() {
+		got = append(got, command.Fields())
+	}
+	assert.Equal(t, [][]string{
+		{"kubectl", "get", "pods"},
+		{"grep", "a b"},
+		{"cd", "dir"},
+		{"make"},
+	}, got)
+}